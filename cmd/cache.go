@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/spf13/cobra"
+)
+
+// NewCacheCmd creates a command to manage the local caches
+func NewCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of dataset columns",
+		Long: `Manage the cache of dataset columns.
+
+Columns fetched from Honeycomb are cached in the cache directory next to the config file
+(default $HOME/.hccli/cache) keyed by environment and dataset. Entries expire after columnCache.ttl (default 1h);
+set columnCache.disabled to turn the cache off or pass --refresh to bypass it for a single command.`,
+	}
+
+	cmd.AddCommand(NewCacheStatusCmd())
+	cmd.AddCommand(NewCacheClearCmd())
+	return cmd
+}
+
+// NewCacheStatusCmd creates a command to print the cached entries
+func NewCacheStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "List the cached columns and whether they have expired",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				cache := pkg.NewColumnCache(*app.Config)
+				entries, err := cache.List()
+				if err != nil {
+					return err
+				}
+				now := time.Now()
+				status := cacheStatus{Dir: cache.Dir, TTL: cache.TTL.String(), Entries: make([]cacheEntryStatus, 0, len(entries))}
+				for _, e := range entries {
+					status.Entries = append(status.Entries, cacheEntryStatus{
+						Environment: e.Environment,
+						Dataset:     e.Dataset,
+						Columns:     len(e.Columns),
+						FetchedAt:   e.FetchedAt,
+						Expired:     cache.Expired(e, now),
+					})
+				}
+
+				return app.Print(status, func(w io.Writer) error {
+					fmt.Fprintf(w, "Cache: %v\nTTL: %v\n\n", cache.Dir, cache.TTL)
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "ENVIRONMENT\tDATASET\tCOLUMNS\tAGE\tEXPIRED")
+					for _, e := range status.Entries {
+						age := now.Sub(e.FetchedAt).Round(time.Second)
+						fmt.Fprintf(tw, "%s\t%s\t%d\t%v\t%v\n", e.Environment, e.Dataset, e.Columns, age, e.Expired)
+					}
+					return tw.Flush()
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// NewCacheClearCmd creates a command to clear the cache
+func NewCacheClearCmd() *cobra.Command {
+	var dataset string
+	cmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove cached columns",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				removed, err := pkg.NewColumnCache(*app.Config).Clear(dataset)
+				if err != nil {
+					return err
+				}
+				return app.Print(cacheClearResult{Removed: removed}, func(w io.Writer) error {
+					fmt.Fprintf(w, "Removed %d cached entries\n", removed)
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "Only remove the cached columns of this dataset")
+	return cmd
+}
+
+// cacheStatus is the result of hccli cache status.
+type cacheStatus struct {
+	Dir     string             `json:"dir"`
+	TTL     string             `json:"ttl"`
+	Entries []cacheEntryStatus `json:"entries"`
+}
+
+// cacheEntryStatus describes the cached columns of a single dataset.
+type cacheEntryStatus struct {
+	Environment string    `json:"environment"`
+	Dataset     string    `json:"dataset"`
+	Columns     int       `json:"columns"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+	Expired     bool      `json:"expired"`
+}
+
+// cacheClearResult is the result of hccli cache clear.
+type cacheClearResult struct {
+	Removed int `json:"removed"`
+}
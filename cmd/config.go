@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
+	"github.com/jlewi/hccli/pkg/app"
 	"github.com/jlewi/hccli/pkg/config"
+	"github.com/jlewi/hccli/pkg/secrets"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -19,48 +27,82 @@ func NewConfigCmd() *cobra.Command {
 	}
 
 	cmd.AddCommand(NewConfigSetCmd())
+	cmd.AddCommand(NewConfigUnsetCmd())
 	cmd.AddCommand(NewConfigGetCmd())
+	cmd.AddCommand(NewConfigKeysCmd())
+	cmd.AddCommand(NewConfigEditCmd())
+	cmd.AddCommand(NewConfigUseProfileCmd())
+	cmd.AddCommand(NewConfigProfilesCmd())
+	cmd.AddCommand(NewConfigSchemaCmd())
 	return cmd
 }
 
 // NewConfigSetCmd creates a command to configure various settings
 func NewConfigSetCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:  "set <name>=<value>",
+		Use:   "set <name>=<value>",
+		Short: "Set a configuration value; use --profile to set it in a profile",
+		Long: `Set a configuration value; use --profile to set it in a profile.
+
+Values that are YAML lists or maps are stored as structures and <name>+=<value> appends to a list e.g.
+
+  hccli config set columnSelection.include=[service.name,http.route]
+  hccli config set columnSelection.include+=k8s.pod.name
+  hccli config set 'columnCache={ttl: 6h}'
+
+The previous configuration is saved with the suffix .bak.`,
 		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 
 			err := func() error {
+				app := app.NewApp()
+				if err := app.SetOutput(cmd); err != nil {
+					return err
+				}
 				if err := config.InitViper(cmd); err != nil {
 					return err
 				}
 
-				parts := strings.Split(args[0], "=")
+				// N.B. Only split on the first = since values such as URLs can contain =.
+				parts := strings.SplitN(args[0], "=", 2)
 				if len(parts) < 2 {
 					return errors.New("Invalid argument; argument is not in the form <name>=<value>")
 				}
-				name := parts[0]
+				name, value := parts[0], parts[1]
+				appendValue := strings.HasSuffix(name, "+")
+				name = strings.TrimSuffix(name, "+")
+				if !config.IsKnownKey(name) {
+					return errors.Errorf("Unknown configuration key %v; run hccli config keys to see the supported keys", name)
+				}
 
-				// N.B. We use a switch state because in the future if we have associated arrays we will need to
-				// special case them because viper doesn't support them.
-				var cfg *config.Config
-				switch name {
-				default:
-					value := parts[1]
-					viper.Set(name, value)
-					cfg = config.GetConfig()
+				// Modify the file rather than the merged configuration so profiles, flags and environment
+				// variables don't get persisted.
+				cfgFile := config.ConfigFile()
+				v, err := config.ReadConfigFile(cfgFile)
+				if err != nil {
+					return err
 				}
 
-				cfgFile := viper.ConfigFileUsed()
-				if cfgFile == "" {
-					cfgFile = config.DefaultConfigFile()
+				// With --profile the value is set as an override in that profile.
+				if profile := viper.GetString(config.ProfileFlagName); profile != "" {
+					name = "profiles." + profile + "." + name
+				}
+
+				if err := config.SetValue(v, name, value, appendValue); err != nil {
+					return err
+				}
+				doc, err := config.ReadConfigDocument(cfgFile)
+				if err != nil {
+					return err
+				}
+				if err := config.SetNodeValue(doc, name, v.Get(name)); err != nil {
+					return err
 				}
-				fmt.Printf("Writing configuration to %s\n", cfgFile)
-				return cfg.Write(cfgFile)
+				return writeConfig(app, v, doc, cfgFile, name)
 			}()
 
 			if err != nil {
-				fmt.Printf("Error running request;\n %+v\n", err)
+				app.ReportError(cmd, err)
 				os.Exit(1)
 			}
 		},
@@ -69,27 +111,423 @@ func NewConfigSetCmd() *cobra.Command {
 	return cmd
 }
 
+// NewConfigUnsetCmd creates a command to remove a configuration value
+func NewConfigUnsetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unset <name>",
+		Short: "Remove a configuration value so the default is used; use --profile to remove it from a profile",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.SetOutput(cmd); err != nil {
+					return err
+				}
+				if err := config.InitViper(cmd); err != nil {
+					return err
+				}
+
+				name := args[0]
+				if profile := viper.GetString(config.ProfileFlagName); profile != "" {
+					name = "profiles." + profile + "." + name
+				}
+
+				cfgFile := config.ConfigFile()
+				v, err := config.ReadConfigFile(cfgFile)
+				if err != nil {
+					return err
+				}
+				// Unknown keys can be removed as long as they are set e.g. to fix a typo.
+				if !config.IsKnownKey(args[0]) && !v.IsSet(name) {
+					return errors.Errorf("Unknown configuration key %v; run hccli config keys to see the supported keys", args[0])
+				}
+				v, err = config.UnsetValue(v, name)
+				if err != nil {
+					return err
+				}
+				doc, err := config.ReadConfigDocument(cfgFile)
+				if err != nil {
+					return err
+				}
+				if err := config.UnsetNodeValue(doc, name); err != nil {
+					return err
+				}
+				return writeConfig(app, v, doc, cfgFile, name)
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// configWriteResult is the result of commands that change a configuration value.
+type configWriteResult struct {
+	File     string   `json:"file"`
+	Key      string   `json:"key"`
+	Warnings []string `json:"warnings"`
+}
+
+// writeConfig validates the configuration in v, writes doc to cfgFile and prints the result of changing key.
+// v and doc are the same configuration; doc is written so comments and unknown keys are preserved.
+func writeConfig(a *app.App, v *viper.Viper, doc *yaml.Node, cfgFile string, key string) error {
+	cfg, err := config.FromViper(v)
+	if err != nil {
+		return err
+	}
+	// Problems are reported but don't prevent writing since fixing them can take several calls.
+	result := configWriteResult{File: cfgFile, Key: key, Warnings: append(cfg.IsValid(), cfg.CheckFiles()...)}
+	if err := config.WriteDocument(cfgFile, doc); err != nil {
+		return err
+	}
+	return a.Print(result, func(w io.Writer) error {
+		for _, p := range result.Warnings {
+			fmt.Fprintf(w, "Warning: %s\n", p)
+		}
+		fmt.Fprintf(w, "Wrote configuration to %s\n", cfgFile)
+		return nil
+	})
+}
+
 // NewConfigGetCmd  creates a command to get the configuration
 func NewConfigGetCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "get",
-		Short: "Get the configuration",
+		Short: "Get the configuration with the overrides of the active profile applied",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.SetOutput(cmd); err != nil {
+					return err
+				}
+				if err := config.InitViper(cmd); err != nil {
+					return err
+				}
+				if err := config.ApplyProfile(); err != nil {
+					return err
+				}
+				// URLs can embed credentials e.g. basic auth for the AI endpoint so the passwords in every URL are
+				// redacted including the ones in profiles.
+				b, err := yaml.Marshal(config.GetConfig())
+				if err != nil {
+					return errors.Wrapf(err, "Failed to serialize configuration")
+				}
+				var n yaml.Node
+				if err := yaml.Unmarshal(b, &n); err != nil {
+					return errors.Wrapf(err, "Failed to serialize configuration")
+				}
+				secrets.RedactYAML(&n)
+
+				if app.Structured() {
+					redacted := make(map[string]interface{})
+					if err := n.Decode(&redacted); err != nil {
+						return errors.Wrapf(err, "Failed to serialize configuration")
+					}
+					return app.Print(redacted, nil)
+				}
+
+				b, err = yaml.Marshal(&n)
+				if err != nil {
+					return errors.Wrapf(err, "Failed to serialize configuration")
+				}
+				fmt.Fprint(app.Out, string(b))
+				return nil
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigUseProfileCmd creates a command to change the current profile
+func NewConfigUseProfileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "use-profile <name>",
+		Short: "Set the profile used when --profile isn't specified",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.SetOutput(cmd); err != nil {
+					return err
+				}
+				if err := config.InitViper(cmd); err != nil {
+					return err
+				}
+
+				cfgFile := config.ConfigFile()
+				v, err := config.ReadConfigFile(cfgFile)
+				if err != nil {
+					return err
+				}
+				cfg, err := config.FromViper(v)
+				if err != nil {
+					return err
+				}
+
+				name := strings.ToLower(args[0])
+				if _, ok := cfg.Profiles[name]; !ok {
+					return errors.Errorf("Profile %v isn't defined in %v; define it with hccli config set --profile=%v <name>=<value>", args[0], cfgFile, args[0])
+				}
+				doc, err := config.ReadConfigDocument(cfgFile)
+				if err != nil {
+					return err
+				}
+				if err := config.SetNodeValue(doc, "currentProfile", name); err != nil {
+					return err
+				}
+				if err := config.WriteDocument(cfgFile, doc); err != nil {
+					return err
+				}
+				return app.Print(configProfile{Name: name, Current: true, Overrides: sortedKeys(cfg.Profiles[name])}, func(w io.Writer) error {
+					fmt.Fprintf(w, "Switched to profile %s\n", name)
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigProfilesCmd creates a command to list the profiles
+func NewConfigProfilesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profiles",
+		Short: "List the profiles; the active profile is marked with *",
 		Run: func(cmd *cobra.Command, args []string) {
 			err := func() error {
+				app := app.NewApp()
+				if err := app.SetOutput(cmd); err != nil {
+					return err
+				}
 				if err := config.InitViper(cmd); err != nil {
 					return err
 				}
 				cfg := config.GetConfig()
+				active := strings.ToLower(config.ActiveProfile())
+
+				names := make([]string, 0, len(cfg.Profiles))
+				for name := range cfg.Profiles {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				profiles := make([]configProfile, 0, len(names))
+				for _, name := range names {
+					profiles = append(profiles, configProfile{Name: name, Current: name == active, Overrides: sortedKeys(cfg.Profiles[name])})
+				}
 
-				if err := yaml.NewEncoder(os.Stdout).Encode(cfg); err != nil {
+				return app.Print(profiles, func(w io.Writer) error {
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "CURRENT\tNAME\tOVERRIDES")
+					for _, p := range profiles {
+						current := ""
+						if p.Current {
+							current = "*"
+						}
+						fmt.Fprintf(tw, "%s\t%s\t%s\n", current, p.Name, strings.Join(p.Overrides, ","))
+					}
+					return tw.Flush()
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigSchemaCmd creates a command to print the JSON schema of the configuration file
+func NewConfigSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON schema of the configuration file",
+		Long: `Print the JSON schema of the configuration file.
+
+Editors such as VSCode can use the schema to validate and autocomplete the configuration file e.g.
+
+  hccli config schema > ~/.hccli/config.schema.json
+
+and add the following to the top of ~/.hccli/config.yaml
+
+  # yaml-language-server: $schema=./config.schema.json`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				a := app.NewApp()
+				if err := a.SetOutput(cmd); err != nil {
 					return err
 				}
+				// The schema is JSON unless yaml output is requested.
+				if a.Output == app.OutputText {
+					a.Output = app.OutputJSON
+				}
+				return a.Print(config.Schema(), nil)
+			}()
 
-				return nil
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigKeysCmd creates a command to list the configuration keys
+func NewConfigKeysCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "List the configuration keys with their current values and where the values come from",
+		Long: `List the configuration keys with their current values and where the values come from.
+
+The source is one of flag, env (HCCLI_<KEY> with . replaced by _), profile, file or default.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.SetOutput(cmd); err != nil {
+					return err
+				}
+				if err := config.InitViper(cmd); err != nil {
+					return err
+				}
+				if err := config.ApplyProfile(); err != nil {
+					return err
+				}
+				file, err := config.ReadConfigFile(config.ConfigFile())
+				if err != nil {
+					return err
+				}
+
+				keys := make([]configKey, 0)
+				for _, k := range config.Keys() {
+					// Objects are listed through their fields.
+					if k.Type == "object" && !k.IsMap {
+						continue
+					}
+					value := ""
+					if k.IsMap {
+						value = strings.Join(sortedKeys(viper.GetStringMap(k.Name)), ",")
+					} else if v := viper.Get(k.Name); v != nil {
+						value = secrets.RedactURL(fmt.Sprint(v))
+					}
+					keys = append(keys, configKey{Key: k.Name, Value: value, Source: config.KeySource(cmd, file, k.Name), Description: k.Description})
+				}
+
+				return app.Print(keys, func(w io.Writer) error {
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE\tDESCRIPTION")
+					for _, k := range keys {
+						fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", k.Key, k.Value, k.Source, k.Description)
+					}
+					return tw.Flush()
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigEditCmd creates a command to edit the configuration file
+func NewConfigEditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit",
+		Short: "Edit the configuration file with $VISUAL or $EDITOR",
+		Long: `Edit the configuration file with $VISUAL or $EDITOR; vi is used if neither is set.
+
+The file is validated when the editor exits. If it has problems you can edit it again; the configuration file
+isn't changed until the edits are valid. The previous configuration is saved with the suffix .bak.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				if err := config.InitViper(cmd); err != nil {
+					return err
+				}
+				cfgFile := config.ConfigFile()
+				original, err := os.ReadFile(cfgFile)
+				if err != nil && !os.IsNotExist(err) {
+					return errors.Wrapf(err, "Failed to read config file %v", cfgFile)
+				}
+
+				// Edit a temporary copy so the configuration isn't changed until it is valid.
+				tmp, err := os.CreateTemp("", "hccli-config-*.yaml")
+				if err != nil {
+					return errors.Wrapf(err, "Failed to create temporary file")
+				}
+				defer os.Remove(tmp.Name())
+				if _, err := tmp.Write(original); err != nil {
+					return errors.Wrapf(err, "Failed to write temporary file")
+				}
+				if err := tmp.Close(); err != nil {
+					return errors.Wrapf(err, "Failed to write temporary file")
+				}
+
+				stdin := bufio.NewReader(os.Stdin)
+				for {
+					if err := runEditor(tmp.Name()); err != nil {
+						return err
+					}
+					edited, err := os.ReadFile(tmp.Name())
+					if err != nil {
+						return errors.Wrapf(err, "Failed to read edited configuration")
+					}
+					if bytes.Equal(edited, original) {
+						fmt.Println("Configuration unchanged")
+						return nil
+					}
+
+					v, err := config.ReadConfigFile(tmp.Name())
+					var problems []string
+					var cfg *config.Config
+					if err == nil {
+						cfg, err = config.FromViper(v)
+					}
+					if err != nil {
+						problems = []string{err.Error()}
+					} else {
+						problems = append(cfg.IsValid(), config.ValidateKeys(v.AllKeys())...)
+					}
+					if len(problems) == 0 {
+						// The edits are written as is so comments and formatting are kept.
+						fmt.Printf("Writing configuration to %s\n", cfgFile)
+						return config.WriteFile(cfgFile, edited)
+					}
+
+					fmt.Printf("The configuration has problems:\n%s\n", strings.Join(problems, "\n"))
+					fmt.Print("Edit again? [Y/n] ")
+					answer, _ := stdin.ReadString('\n')
+					if strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "n") {
+						return errors.New("Configuration wasn't changed because it has problems")
+					}
+				}
 			}()
 
 			if err != nil {
-				fmt.Printf("Error running request;\n %+v\n", err)
+				app.ReportError(cmd, err)
 				os.Exit(1)
 			}
 		},
@@ -97,3 +535,49 @@ func NewConfigGetCmd() *cobra.Command {
 
 	return cmd
 }
+
+// runEditor opens the file in the user's editor and waits for it to exit.
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// The editor can include arguments e.g. "code --wait".
+	parts := strings.Fields(editor)
+	c := exec.Command(parts[0], append(parts[1:], path)...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return errors.Wrapf(err, "Failed to run editor %v", editor)
+	}
+	return nil
+}
+
+// configProfile describes a profile in the output of hccli config profiles.
+type configProfile struct {
+	Name    string `json:"name"`
+	Current bool   `json:"current"`
+	// Overrides are the keys the profile sets.
+	Overrides []string `json:"overrides"`
+}
+
+// configKey describes a key in the output of hccli config keys.
+type configKey struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Source      string `json:"source"`
+	Description string `json:"description"`
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
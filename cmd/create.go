@@ -1,25 +1,23 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-
-	"github.com/go-logr/zapr"
-	"github.com/pkg/errors"
-	"go.uber.org/zap"
+	"text/tabwriter"
+	"time"
 
 	"github.com/jlewi/hccli/pkg"
 	"github.com/jlewi/hccli/pkg/app"
 	"github.com/jlewi/hydros/pkg/util"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 // NewCreateQuery creates a command to generate queries
 func NewCreateQuery() *cobra.Command {
 	var dataset string
-	var query string
-	var queryFile string
+	var qFlags queryFlags
 	cmd := &cobra.Command{
 		Use: "createquery",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -32,53 +30,75 @@ func NewCreateQuery() *cobra.Command {
 					return err
 				}
 
-				log := zapr.NewLogger(zap.L())
 				logVersion()
 
-				if (query == "" && queryFile == "") || (query != "" && queryFile != "") {
-					return errors.New("Exactly one of --query and --query-file must be specified")
+				hcq, err := qFlags.read(app.Config, time.Now())
+				if err != nil {
+					return err
+				}
+
+				hc, err := pkg.NewHoneycombClient(*app.Config)
+				if err != nil {
+					return err
 				}
 
-				if queryFile != "" {
-					data, err := os.ReadFile(queryFile)
+				datasets := pkg.ParseDatasets(dataset)
+				if len(datasets) == 1 {
+					qid, err := hc.CreateQuery(datasets[0], *hcq)
+					if err != nil {
+						return err
+					}
+					created := pkg.CreatedQuery{Dataset: datasets[0], QueryID: qid}
+					created.URL, err = queryURL(app.Config, *hcq, datasets[0])
 					if err != nil {
-						return errors.Wrapf(err, "Error reading query file %v", queryFile)
+						return err
 					}
-					query = string(data)
+					return printCreatedQuery(app, *hcq, created)
 				}
 
-				hcq := &pkg.HoneycombQuery{}
-
-				if err := json.Unmarshal([]byte(query), hcq); err != nil {
-					log.Error(err, "Error unmarshalling query", "query", query)
-					return errors.Wrapf(err, "Error unmarshalling query")
+				// Create the query in each dataset and report the results together.
+				result := pkg.CreateQueryResult{Query: *hcq, Queries: make([]pkg.CreatedQuery, 0, len(datasets))}
+				failed := 0
+				for _, d := range datasets {
+					created := pkg.CreatedQuery{Dataset: d}
+					qid, err := hc.CreateQuery(d, *hcq)
+					if err != nil {
+						failed++
+						created.Error = err.Error()
+					} else {
+						created.QueryID = qid
+						created.URL, err = queryURL(app.Config, *hcq, d)
+						if err != nil {
+							return err
+						}
+					}
+					result.Queries = append(result.Queries, created)
 				}
-
-				hc, err := pkg.NewHoneycombClient(*app.Config)
-				if err != nil {
+				if err := app.Print(result, func(w io.Writer) error {
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "DATASET\tQUERY ID\tERROR")
+					for _, q := range result.Queries {
+						fmt.Fprintf(tw, "%s\t%s\t%s\n", q.Dataset, q.QueryID, q.Error)
+					}
+					return tw.Flush()
+				}); err != nil {
 					return err
 				}
-
-				qid, err := hc.CreateQuery(dataset, *hcq)
-				if err != nil {
-					return err
+				if failed > 0 {
+					return errors.Errorf("Failed to create the query in %d of %d datasets", failed, len(datasets))
 				}
-
-				fmt.Printf("Created query :\n%v\n", qid)
-
 				return nil
 			}()
 
 			if err != nil {
-				fmt.Printf("Error running request;\n %+v\n", err)
+				app.ReportError(cmd, err)
 				os.Exit(1)
 			}
 		},
 	}
 
-	cmd.Flags().StringVarP(&query, "query", "", "", "The honeycomb query")
-	cmd.Flags().StringVarP(&queryFile, "query-file", "", "", "A file containing the honeycomb query")
-	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "The dataset slug to create the query in")
+	qFlags.addFlags(cmd)
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "The dataset slug to create the query in. Use __all__ for an environment wide query or a comma separated list of slugs to create the query in each dataset.")
 
 	util.IgnoreError(cmd.MarkFlagRequired("dataset"))
 	return cmd
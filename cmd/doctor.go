@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// NewDoctorCmd creates a command to check the configuration and connectivity
+func NewDoctorCmd() *cobra.Command {
+	var chromePort int
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the configuration and connectivity to Honeycomb, the translator and Chrome",
+		Long: `Check the configuration and connectivity to Honeycomb, the translator and Chrome.
+
+Each check prints PASS, FAIL, WARN or SKIP; checks are skipped if the configuration doesn't use the service.
+WARN is used for problems that only affect optional features e.g. saving graphs with Chrome.
+The command exits with a non-zero status if any check fails.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				// N.B. We don't use app.LoadConfig because it fails on an invalid configuration and reporting the
+				// problems is one of the checks.
+				if err := config.InitViper(cmd); err != nil {
+					return err
+				}
+				if err := config.ApplyProfile(); err != nil {
+					return err
+				}
+				app := app.NewApp()
+				if err := app.SetOutput(cmd); err != nil {
+					return err
+				}
+				app.Config = config.GetConfig()
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				results := pkg.RunChecks(*app.Config, viper.AllKeys(), chromePort)
+
+				failed := 0
+				for _, r := range results {
+					if r.Status == pkg.CheckFail {
+						failed++
+					}
+				}
+				if err := app.Print(doctorResult{Checks: results}, func(w io.Writer) error {
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAILS")
+					for _, r := range results {
+						fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Status, r.Details)
+					}
+					return tw.Flush()
+				}); err != nil {
+					return err
+				}
+				if failed > 0 {
+					return errors.Errorf("%d of %d checks failed", failed, len(results))
+				}
+				return nil
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&chromePort, "port", "", 9222, "Port chrome developer tools is running on.")
+	return cmd
+}
+
+// doctorResult is the result of hccli doctor.
+type doctorResult struct {
+	Checks []pkg.CheckResult `json:"checks"`
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/jlewi/hydros/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewEvalCmd creates a command to evaluate the translator against a dataset of examples
+func NewEvalCmd() *cobra.Command {
+	var casesFile string
+	var format string
+	var outFile string
+	cmd := &cobra.Command{
+		Use:   "eval",
+		Short: "Evaluate the translator against a dataset of natural language questions and expected queries",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				log := zapr.NewLogger(zap.L())
+				logVersion()
+
+				cases, err := pkg.ReadEvalDataset(casesFile)
+				if err != nil {
+					return err
+				}
+				log.Info("Read evaluation dataset", "file", casesFile, "cases", len(cases))
+
+				translator, err := pkg.NewTranslator(*app.Config)
+				if err != nil {
+					return err
+				}
+
+				report := pkg.RunEval(translator, cases)
+
+				var output []byte
+				switch format {
+				case "markdown":
+					output = []byte(report.Markdown())
+				case "json":
+					output, err = json.MarshalIndent(report, "", "  ")
+					if err != nil {
+						return errors.Wrapf(err, "Failed to serialize report")
+					}
+				default:
+					return errors.Errorf("Unsupported format %v; format should be markdown or json", format)
+				}
+
+				if outFile != "" {
+					if err := os.WriteFile(outFile, output, 0644); err != nil {
+						return errors.Wrapf(err, "Failed to write report to %v", outFile)
+					}
+					log.Info("Wrote report", "file", outFile)
+				}
+
+				return app.Print(report, func(w io.Writer) error {
+					_, err := fmt.Fprintf(w, "%s\n", output)
+					return err
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&casesFile, "cases", "", "", "File containing the evaluation cases. Either a YAML list or JSONL file of {name, nlq, columns, expected}")
+	cmd.Flags().StringVarP(&format, "format", "", "markdown", "Format of the report written to --out-file and printed with --output text; markdown or json")
+	cmd.Flags().StringVarP(&outFile, "out-file", "", "", "File to write the report to")
+	util.IgnoreError(cmd.MarkFlagRequired("cases"))
+	return cmd
+}
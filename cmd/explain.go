@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewExplainCmd creates a command to describe a query in plain English
+func NewExplainCmd() *cobra.Command {
+	var flags queryFlags
+	var rich bool
+	cmd := &cobra.Command{
+		Use:   "explain",
+		Short: "Describe a query in plain English",
+		Long: `Describe a query in plain English e.g.
+
+  P99 of duration_ms for root spans where error exists, grouped by http.route, over the last 7 days
+
+The description is produced from templates so it is always the same for the same query. --rich asks the translator
+for a fuller explanation of what the query shows; this needs a chat model (translator.chat). The template is used
+if the translator can't explain queries.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+				log := zapr.NewLogger(zap.L())
+
+				q, err := flags.read(app.Config, time.Now())
+				if err != nil {
+					return err
+				}
+
+				result := pkg.ExplainResult{
+					Query:       *q,
+					Explanation: pkg.ExplainQuery(*q),
+					Explainer:   pkg.TemplateExplainer,
+					Warnings:    make([]string, 0),
+				}
+				if rich {
+					translator, err := pkg.NewTranslator(*app.Config)
+					if err != nil {
+						return err
+					}
+					name := pkg.TranslatorName(*app.Config)
+					if explainer, ok := translator.(pkg.Explainer); !ok {
+						result.Warnings = append(result.Warnings, fmt.Sprintf("Translator %v can't explain queries; configure translator.chat for richer explanations", name))
+					} else if t, err := pkg.RunExplainer(explainer, *q); err != nil {
+						log.Error(err, "Failed to explain query", "translator", name)
+						result.Warnings = append(result.Warnings, fmt.Sprintf("Translator %v failed to explain the query; %v", name, err))
+					} else {
+						result.Explanation = t.Output
+						result.Explainer = name
+						result.Model = t.Model
+					}
+				}
+
+				return app.Print(result, func(w io.Writer) error {
+					for _, p := range result.Warnings {
+						fmt.Fprintf(w, "Warning: %s\n", p)
+					}
+					fmt.Fprintln(w, result.Explanation)
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	flags.addFlags(cmd)
+	cmd.Flags().BoolVarP(&rich, "rich", "", false, "Ask the translator for a fuller explanation")
+	return cmd
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewFmtCmd creates a command to format queries
+func NewFmtCmd() *cobra.Command {
+	var format string
+	var write bool
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "fmt [files...]",
+		Short: "Format honeycomb queries in a canonical form",
+		Long: `Format honeycomb queries in a canonical form.
+
+Queries can be JSON, JSON with escaped quotes, YAML, python dictionaries or the text syntax. The output has sorted keys and
+empty fields and Honeycomb's defaults (filter_combination AND, limit 1000 and time_range 7200) removed. If no files are given the query is read from stdin.
+
+With --check the files aren't modified; instead the names of files that aren't formatted are printed
+and the command exits with a non-zero status.
+
+With --output json or yaml each query is printed as an object with the file, the parsed query and the query
+formatted in --format; a list when files are given. --check and --write print the files they report.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			app := app.NewApp()
+			results := make([]fmtQueryResult, 0, len(args))
+			unformatted, err := func() ([]string, error) {
+				if err := app.SetOutput(cmd); err != nil {
+					return nil, err
+				}
+				if write && check {
+					return nil, errors.New("Only one of --write and --check can be specified")
+				}
+
+				if len(args) == 0 {
+					if write || check {
+						return nil, errors.New("--write and --check require files")
+					}
+					data, err := io.ReadAll(os.Stdin)
+					if err != nil {
+						return nil, errors.Wrapf(err, "Failed to read query from stdin")
+					}
+					q, formatted, err := formatQuery(data, format)
+					if err != nil {
+						return nil, err
+					}
+					results = append(results, fmtQueryResult{Query: q, Formatted: string(formatted)})
+					return nil, nil
+				}
+
+				unformatted := make([]string, 0)
+				for _, f := range args {
+					data, err := os.ReadFile(f)
+					if err != nil {
+						return nil, errors.Wrapf(err, "Failed to read %v", f)
+					}
+					q, formatted, err := formatQuery(data, format)
+					if err != nil {
+						return nil, errors.Wrapf(err, "Failed to format %v", f)
+					}
+
+					switch {
+					case check:
+						if !bytes.Equal(data, formatted) {
+							unformatted = append(unformatted, f)
+						}
+					case write:
+						if bytes.Equal(data, formatted) {
+							continue
+						}
+						if err := os.WriteFile(f, formatted, 0644); err != nil {
+							return nil, errors.Wrapf(err, "Failed to write %v", f)
+						}
+						unformatted = append(unformatted, f)
+					default:
+						results = append(results, fmtQueryResult{File: f, Query: q, Formatted: string(formatted)})
+					}
+				}
+				return unformatted, nil
+			}()
+
+			if err != nil {
+				app.PrintError(err)
+				os.Exit(1)
+			}
+
+			if !write && !check {
+				var result interface{} = results
+				if len(args) == 0 {
+					result = results[0]
+				}
+				if err := app.Print(result, func(w io.Writer) error {
+					for _, r := range results {
+						if _, err := io.WriteString(w, r.Formatted); err != nil {
+							return err
+						}
+					}
+					return nil
+				}); err != nil {
+					app.PrintError(err)
+					os.Exit(1)
+				}
+				return
+			}
+			if err := app.Print(fmtResult{Unformatted: unformatted}, func(w io.Writer) error {
+				// Rewritten files aren't printed so --write is quiet like gofmt -w.
+				if write {
+					return nil
+				}
+				for _, f := range unformatted {
+					fmt.Fprintln(w, f)
+				}
+				return nil
+			}); err != nil {
+				app.PrintError(err)
+				os.Exit(1)
+			}
+			if check && len(unformatted) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "", pkg.FormatJSON, "Output format; json, compact, yaml or text")
+	cmd.Flags().BoolVarP(&write, "write", "w", false, "Rewrite the files in place")
+	cmd.Flags().BoolVarP(&check, "check", "", false, "Report files that aren't formatted and exit with a non-zero status if there are any")
+	return cmd
+}
+
+// fmtResult is the result of hccli fmt --check or --write.
+type fmtResult struct {
+	// Unformatted are the files that weren't formatted; with --write they have been rewritten.
+	Unformatted []string `json:"unformatted"`
+}
+
+// fmtQueryResult is a query formatted by hccli fmt.
+type fmtQueryResult struct {
+	// File is empty when the query is read from stdin.
+	File      string              `json:"file,omitempty"`
+	Query     *pkg.HoneycombQuery `json:"query"`
+	Formatted string              `json:"formatted"`
+}
+
+func formatQuery(data []byte, format string) (*pkg.HoneycombQuery, []byte, error) {
+	q, err := pkg.ParseAnyQuery(string(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	formatted, err := pkg.FormatQuery(*q, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return q, formatted, nil
+}
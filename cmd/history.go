@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewHistoryCmd creates a command to inspect the translation history
+func NewHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Inspect, replay and export past translations",
+		Long: `Inspect, replay and export past translations.
+
+Every nltoq call is recorded in the history directory next to the config file (default $HOME/.hccli/history)
+along with the columns, the translator, its raw output, the parsed query, latency and any errors.
+
+Entries are identified by their ID; any unique prefix of an ID can be used.`,
+	}
+
+	cmd.AddCommand(NewHistoryListCmd())
+	cmd.AddCommand(NewHistoryShowCmd())
+	cmd.AddCommand(NewHistoryReplayCmd())
+	cmd.AddCommand(NewHistoryExportCmd())
+	return cmd
+}
+
+// NewHistoryListCmd creates a command to list past translations
+func NewHistoryListCmd() *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List past translations; the most recent come last",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				history := &pkg.HistoryStore{Dir: app.Config.GetHistoryDir()}
+				entries, err := history.List()
+				if err != nil {
+					return err
+				}
+				if limit > 0 && len(entries) > limit {
+					entries = entries[len(entries)-limit:]
+				}
+
+				return app.Print(entries, func(w io.Writer) error {
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "ID\tDATASET\tLATENCY\tSTATUS\tNLQ")
+					for _, e := range entries {
+						fmt.Fprintf(tw, "%s\t%s\t%.2fs\t%s\t%s\n", e.ID, e.Dataset, e.Latency, historyStatus(e), e.NLQ)
+					}
+					return tw.Flush()
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Only list the most recent entries. 0 lists all entries.")
+	return cmd
+}
+
+// NewHistoryShowCmd creates a command to print a past translation
+func NewHistoryShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print a past translation",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				history := &pkg.HistoryStore{Dir: app.Config.GetHistoryDir()}
+				e, err := history.Get(args[0])
+				if err != nil {
+					return err
+				}
+
+				return app.Print(e, func(w io.Writer) error {
+					return printHistoryEntry(w, e)
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// printHistoryEntry prints the details of a translation.
+func printHistoryEntry(w io.Writer, e *pkg.HistoryEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID:\t%s\n", e.ID)
+	fmt.Fprintf(tw, "Time:\t%s\n", e.Time.Format(time.RFC3339))
+	fmt.Fprintf(tw, "NLQ:\t%s\n", e.NLQ)
+	fmt.Fprintf(tw, "Dataset:\t%s\n", e.Dataset)
+	fmt.Fprintf(tw, "Columns:\t%s\n", e.ColumnsHash)
+	fmt.Fprintf(tw, "Translator:\t%s\n", e.Translator)
+	fmt.Fprintf(tw, "Model:\t%s\n", e.Model)
+	fmt.Fprintf(tw, "Version:\t%s\n", e.Version)
+	fmt.Fprintf(tw, "Latency:\t%.3fs\n", e.Latency)
+	fmt.Fprintf(tw, "Predict time:\t%.3fs\n", e.PredictTime)
+	if e.ReplayOf != "" {
+		fmt.Fprintf(tw, "Replay of:\t%s\n", e.ReplayOf)
+	}
+	if e.Refines != nil {
+		fmt.Fprintf(tw, "Refines:\t%s\n", pkg.FormatTextQuery(*e.Refines))
+	}
+	if e.Error != "" {
+		fmt.Fprintf(tw, "Error:\t%s\n", e.Error)
+	}
+	if e.ParseError != "" {
+		fmt.Fprintf(tw, "Parse error:\t%s\n", e.ParseError)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nOutput:\n%s\n", e.Output)
+	return nil
+}
+
+// NewHistoryReplayCmd creates a command to rerun a past translation with the current translator
+func NewHistoryReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay <id>",
+		Short: "Translate a past question again with the current translator and show how the query changed",
+		Long: `Translate a past question again with the current translator and show how the query changed.
+
+The question is translated with the same columns as the original translation. The differences are semantic;
+see querydiff. The replay is recorded in the history as well.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				log := zapr.NewLogger(zap.L())
+				logVersion()
+
+				history := &pkg.HistoryStore{Dir: app.Config.GetHistoryDir()}
+				old, err := history.Get(args[0])
+				if err != nil {
+					return err
+				}
+				cols, err := history.Columns(old.ColumnsHash)
+				if err != nil {
+					return err
+				}
+
+				translator, err := pkg.NewTranslator(*app.Config)
+				if err != nil {
+					return err
+				}
+				var entry *pkg.HistoryEntry
+				if old.Refines != nil {
+					entry, err = pkg.RunRefinement(pkg.NewRefiner(translator), pkg.RefineInput{Query: *old.Refines, Instruction: old.NLQ, COLS: cols})
+				} else {
+					entry, err = pkg.RunTranslation(translator, pkg.QueryInput{NLQ: old.NLQ, COLS: cols})
+				}
+				entry.Dataset = old.Dataset
+				entry.Translator = pkg.TranslatorName(*app.Config)
+				entry.ReplayOf = old.ID
+				if err := history.Append(entry, cols); err != nil {
+					log.Error(err, "Failed to record translation in history")
+				}
+				if err != nil {
+					return err
+				}
+
+				result := pkg.ReplayResult{Original: old, Replay: entry}
+				if old.Query != nil && entry.Query != nil {
+					result.Differences = pkg.DiffQueries(*old.Query, *entry.Query)
+				}
+				return app.Print(result, func(w io.Writer) error {
+					fmt.Fprintf(w, "Replayed %s as %s\n", old.ID, entry.ID)
+					fmt.Fprintf(w, "Translator: %s -> %s\n", old.Translator, entry.Translator)
+					fmt.Fprintf(w, "Latency: %.2fs -> %.2fs\n", old.Latency, entry.Latency)
+
+					switch {
+					case old.Query == nil && entry.Query == nil:
+						fmt.Fprintf(w, "Neither output could be parsed as a query\nOld output:\n%s\nNew output:\n%s\n", old.Output, entry.Output)
+					case old.Query == nil:
+						fmt.Fprintf(w, "The old output couldn't be parsed as a query; the new query is:\n%s\n", entry.Output)
+					case entry.Query == nil:
+						fmt.Fprintf(w, "The new output couldn't be parsed as a query:\n%s\n", entry.Output)
+					case len(result.Differences) == 0:
+						fmt.Fprintln(w, "The queries are equivalent")
+					default:
+						for _, d := range result.Differences {
+							fmt.Fprintln(w, d.String())
+						}
+					}
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// NewHistoryExportCmd creates a command to export the history
+func NewHistoryExportCmd() *cobra.Command {
+	var format string
+	var outFile string
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the translation history as JSONL or CSV",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				history := &pkg.HistoryStore{Dir: app.Config.GetHistoryDir()}
+				entries, err := history.List()
+				if err != nil {
+					return err
+				}
+
+				var w io.Writer = app.Out
+				if outFile != "" {
+					f, err := os.Create(outFile)
+					if err != nil {
+						return errors.Wrapf(err, "Failed to create %v", outFile)
+					}
+					defer f.Close()
+					w = f
+				}
+
+				switch strings.ToLower(format) {
+				case "jsonl":
+					enc := json.NewEncoder(w)
+					for _, e := range entries {
+						if err := enc.Encode(e); err != nil {
+							return errors.Wrapf(err, "Failed to write history entry")
+						}
+					}
+					return nil
+				case "csv":
+					return pkg.WriteHistoryCSV(w, entries)
+				default:
+					return errors.Errorf("Unsupported format %v; format should be jsonl or csv", format)
+				}
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "", "jsonl", "Format of the export; jsonl or csv")
+	cmd.Flags().StringVarP(&outFile, "out-file", "", "", "File to write the export to. Defaults to stdout.")
+	return cmd
+}
+
+func historyStatus(e pkg.HistoryEntry) string {
+	switch {
+	case e.Error != "":
+		return "error"
+	case e.ParseError != "":
+		return "unparsed"
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/jlewi/hydros/pkg/util"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewLocalQuery creates a command to run queries against local event files
+func NewLocalQuery() *cobra.Command {
+	var eventsFile string
+	var qFlags queryFlags
+	var now string
+	var series bool
+	cmd := &cobra.Command{
+		Use:   "localquery",
+		Short: "Run a honeycomb query against a local file of JSON events",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				log := zapr.NewLogger(zap.L())
+				logVersion()
+
+				events, err := pkg.ReadEventsFile(eventsFile)
+				if err != nil {
+					return err
+				}
+				log.Info("Read events", "file", eventsFile, "count", len(events))
+
+				opts := pkg.LocalQueryOptions{Series: series}
+				switch now {
+				case "":
+				case "latest":
+					// Time windows exclude their end so move now past the latest event to include it.
+					opts.Now = pkg.LatestEventTime(events).Add(time.Second)
+				default:
+					t, err := time.Parse(time.RFC3339, now)
+					if err != nil {
+						return errors.Wrapf(err, "--now should be empty, latest or an RFC3339 timestamp")
+					}
+					opts.Now = t
+				}
+
+				queryNow := opts.Now
+				if queryNow.IsZero() {
+					queryNow = time.Now()
+				}
+				hcq, err := qFlags.read(app.Config, queryNow)
+				if err != nil {
+					return err
+				}
+
+				result, err := pkg.ExecuteLocalQuery(*hcq, events, opts)
+				if err != nil {
+					return err
+				}
+
+				out := pkg.LocalQueryResult{Query: *hcq, Columns: resultColumns(*hcq), Results: result.Results}
+				if series {
+					out.Series = result.Series
+				}
+				return app.Print(out, func(w io.Writer) error {
+					if err := printResultRows(w, out.Columns, out.Results); err != nil {
+						return err
+					}
+					if series {
+						fmt.Fprintln(w)
+						return printResultSeries(w, out.Columns, out.Series)
+					}
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&eventsFile, "events", "", "", "File containing newline delimited JSON events")
+	qFlags.addFlags(cmd)
+	cmd.Flags().StringVarP(&now, "now", "", "", "Time that relative time ranges are computed from. Either an RFC3339 timestamp or latest to use the timestamp of the most recent event. Defaults to the current time.")
+	cmd.Flags().BoolVarP(&series, "series", "", false, "Also print the time series for each group")
+	util.IgnoreError(cmd.MarkFlagRequired("events"))
+	return cmd
+}
+
+// resultColumns returns the names of the columns in the results of the query; breakdowns followed by calculations.
+func resultColumns(q pkg.HoneycombQuery) []string {
+	columns := make([]string, 0, len(q.Breakdowns)+len(q.Calculations))
+	columns = append(columns, q.Breakdowns...)
+	for _, c := range q.Calculations {
+		columns = append(columns, pkg.CalculationName(c))
+	}
+	if len(q.Calculations) == 0 {
+		columns = append(columns, "COUNT")
+	}
+	return columns
+}
+
+func printResultRows(w io.Writer, columns []string, rows []pkg.QueryResultRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, r := range rows {
+		fmt.Fprintln(tw, formatResultData(columns, r.Data))
+	}
+	return tw.Flush()
+}
+
+func printResultSeries(w io.Writer, columns []string, series []pkg.QueryResultSeries) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "time\t"+strings.Join(columns, "\t"))
+	for _, s := range series {
+		fmt.Fprintln(tw, s.Time.Format(time.RFC3339)+"\t"+formatResultData(columns, s.Data))
+	}
+	return tw.Flush()
+}
+
+func formatResultData(columns []string, data map[string]interface{}) string {
+	values := make([]string, 0, len(columns))
+	for _, c := range columns {
+		switch v := data[c].(type) {
+		case nil:
+			values = append(values, "-")
+		case []pkg.HeatmapBucket:
+			buckets := make([]string, 0, len(v))
+			for _, b := range v {
+				buckets = append(buckets, fmt.Sprintf("[%g,%g):%d", b.Min, b.Max, b.Count))
+			}
+			values = append(values, strings.Join(buckets, " "))
+		default:
+			values = append(values, fmt.Sprintf("%v", v))
+		}
+	}
+	return strings.Join(values, "\t")
+}
@@ -3,12 +3,15 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/go-logr/zapr"
 	"github.com/jlewi/hccli/pkg"
 	"github.com/jlewi/hccli/pkg/app"
+	"github.com/jlewi/hccli/pkg/config"
 	"github.com/jlewi/hydros/pkg/util"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -20,7 +23,10 @@ func NewNLToQuery() *cobra.Command {
 	var nlq string
 	var cols string
 	var dataset string
-	var output string
+	var outFile string
+	var save string
+	var refresh bool
+	var sampling samplingFlags
 	cmd := &cobra.Command{
 		Use: "nltoq",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -37,31 +43,26 @@ func NewNLToQuery() *cobra.Command {
 
 				logVersion()
 
-				var translator pkg.Translator
-				if app.Config.Replicate != nil {
-					log.Info("Using Replicate translator")
-					rc, err := pkg.NewReplicateClient(*app.Config)
-					if err != nil {
-						return err
-					}
-					translator = rc
-				} else {
-					log.Info("Using model on K8s")
-					translator = &pkg.Predictor{
-						Config: app.Config,
-					}
-				}
-
-				hc, err := pkg.NewHoneycombClient(*app.Config)
+				translator, err := pkg.NewTranslator(*app.Config)
 				if err != nil {
 					return err
 				}
+
 				if cols == "" {
-					if dataset == "" {
+					datasets := pkg.ParseDatasets(dataset)
+					if len(datasets) == 0 {
 						return errors.New("dataset must be specified if cols isn't specified")
 					}
+					hc, err := pkg.NewHoneycombClient(*app.Config)
+					if err != nil {
+						return err
+					}
 					log.Info("No columns specified; fetching columns from Honeycomb")
-					columns, err := hc.GetColumns(dataset)
+					datasets, err = pkg.ExpandDatasets(hc, datasets)
+					if err != nil {
+						return err
+					}
+					columns, err := pkg.UnionColumns(pkg.NewCachedColumnGetter(*app.Config, hc, refresh), datasets)
 					if err != nil {
 						return err
 					}
@@ -73,45 +74,84 @@ func NewNLToQuery() *cobra.Command {
 					}
 					log.Info("Fetched list of columns", "names", names)
 
-					b, err := json.Marshal(columns)
+					// Values are only sampled with an environment wide query when every dataset was asked for;
+					// otherwise each of the datasets is sampled.
+					sampleDatasets := datasets
+					if slices.Contains(pkg.ParseDatasets(dataset), pkg.AllDatasets) {
+						sampleDatasets = []string{pkg.AllDatasets}
+					}
+					cols, err = promptColumns(app.Config, hc, sampleDatasets, nlq, columns, sampling)
 					if err != nil {
-						return errors.Wrapf(err, "Failed to serialize columns")
+						return err
 					}
-					cols = string(b)
 				}
 
-				queryStr, err := translator.Translate(pkg.QueryInput{
+				entry, err := pkg.RunTranslation(translator, pkg.QueryInput{
 					NLQ:  nlq,
 					COLS: cols,
 				})
+				entry.Dataset = dataset
+				entry.Translator = pkg.TranslatorName(*app.Config)
+				history := &pkg.HistoryStore{Dir: app.Config.GetHistoryDir()}
+				if err := history.Append(entry, cols); err != nil {
+					log.Error(err, "Failed to record translation in history")
+				}
 				if err != nil {
 					return err
 				}
-				if queryStr != "" {
-					fmt.Printf("The query is:\n%v\n", queryStr)
-					// Escaped query is to support copying the query inside a notebook to the command to create the
-					// query
-					// This is a bit of a hack. We replace ' with " so on the command line we can enclose the whole
-					// thing in single quotes
-					escaped := queryStr
-					escaped = strings.Replace(escaped, "'", "\"", -1)
-					fmt.Printf("Escaped query :\n%v\n", escaped)
-				} else {
-					fmt.Printf("No query was returned:\n%v\n", err)
+				log.Info("Recorded translation in history", "id", entry.ID)
+
+				result := pkg.NewTranslationResult(entry)
+				queryStr := entry.Output
+				if save != "" {
+					if entry.Query == nil {
+						return errors.Errorf("Can't save the query because it couldn't be parsed; %v", entry.ParseError)
+					}
+					lib := &pkg.QueryLibrary{Dir: app.Config.GetQueriesDir()}
+					if err := lib.Save(pkg.SavedQuery{
+						Name:       save,
+						Dataset:    dataset,
+						NLQ:        nlq,
+						Translator: pkg.TranslatorName(*app.Config),
+						Query:      *entry.Query,
+					}, false); err != nil {
+						return err
+					}
+					result.SavedAs = save
 				}
 
-				if output != "" {
-					if err := os.WriteFile(output, []byte(queryStr), 0644); err != nil {
+				if outFile != "" {
+					if err := os.WriteFile(outFile, []byte(queryStr), 0644); err != nil {
 						return err
 					}
-					fmt.Printf("Wrote query to %v\n", output)
+					result.OutFile = outFile
 				}
 
-				return nil
+				return app.Print(result, func(w io.Writer) error {
+					if queryStr == "" {
+						fmt.Fprintln(w, "No query was returned")
+					} else {
+						fmt.Fprintf(w, "The query is:\n%v\n", queryStr)
+						// Escaped query is to support copying the query inside a notebook to the command to create the
+						// query
+						// This is a bit of a hack. We replace ' with " so on the command line we can enclose the whole
+						// thing in single quotes
+						escaped := queryStr
+						escaped = strings.Replace(escaped, "'", "\"", -1)
+						fmt.Fprintf(w, "Escaped query :\n%v\n", escaped)
+					}
+					if result.SavedAs != "" {
+						fmt.Fprintf(w, "Saved query %v\n", result.SavedAs)
+					}
+					if result.OutFile != "" {
+						fmt.Fprintf(w, "Wrote query to %v\n", result.OutFile)
+					}
+					return nil
+				})
 			}()
 
 			if err != nil {
-				fmt.Printf("Error running request;\n %+v\n", err)
+				app.ReportError(cmd, err)
 				os.Exit(1)
 			}
 		},
@@ -119,8 +159,64 @@ func NewNLToQuery() *cobra.Command {
 
 	cmd.Flags().StringVarP(&nlq, "nlq", "", "", "Natural language query")
 	cmd.Flags().StringVarP(&cols, "cols", "", "", "Columns")
-	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "Honeycomb dataset to fetch columns for. Only required if cols isn't specified")
-	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file to write the query to")
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "Honeycomb dataset to fetch columns for. Either a slug, a comma separated list of slugs or __all__ for every dataset in the environment. Only required if cols isn't specified")
+	cmd.Flags().StringVarP(&outFile, "out-file", "", "", "Output file to write the query to")
+	sampling.addFlags(cmd)
+	cmd.Flags().BoolVarP(&refresh, "refresh", "", false, "Fetch the columns from Honeycomb even if they are cached")
+	cmd.Flags().StringVarP(&save, "save", "", "", "Save the query in the local query library under this name")
 	util.IgnoreError(cmd.MarkFlagRequired("nlq"))
 	return cmd
 }
+
+// samplingFlags control sampling the values of columns.
+type samplingFlags struct {
+	enabled    bool
+	eventsFile string
+}
+
+// addFlags registers the flags with the command.
+func (f *samplingFlags) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&f.enabled, "sample-values", "", false, "Include the most common values of string columns in the translator's input. Values are sampled with Honeycomb's Query Data API unless --events is set.")
+	cmd.Flags().StringVarP(&f.eventsFile, "events", "", "", "Sample column values from this file of JSON events instead of Honeycomb")
+}
+
+// promptColumns picks the columns relevant to the question, optionally samples their values in the datasets and
+// serializes them for the translator.
+func promptColumns(cfg *config.Config, hc *pkg.HoneycombClient, datasets []string, nlq string, columns []pkg.HoneycombColumn, sampling samplingFlags) (string, error) {
+	log := zapr.NewLogger(zap.L())
+	selection := pkg.SelectColumns(nlq, columns, pkg.ColumnSelectionOptions{
+		MaxColumns: cfg.GetMaxColumns(),
+		StaleAfter: cfg.GetStaleAfter(),
+		Include:    cfg.GetIncludedColumns(),
+	})
+	log.Info("Selected columns", "selected", len(selection.Columns), "total", len(columns), "hidden", selection.Hidden, "stale", selection.Stale, "truncated", selection.Truncated)
+
+	samplingCfg := cfg.GetValueSampling()
+	eventsFile := sampling.eventsFile
+	if eventsFile == "" {
+		eventsFile = samplingCfg.EventsFile
+	}
+	var sampler pkg.ValueSampler
+	switch {
+	case eventsFile != "":
+		events, err := pkg.ReadEventsFile(eventsFile)
+		if err != nil {
+			return "", err
+		}
+		sampler = &pkg.LocalValueSampler{Events: events}
+	case sampling.enabled || samplingCfg.Enabled:
+		sampler = &pkg.QueryDataSampler{Client: hc}
+		if len(datasets) > 1 {
+			sampler = &pkg.MultiDatasetSampler{Sampler: sampler, Datasets: datasets}
+		}
+	}
+	if sampler != nil && len(datasets) > 0 {
+		pkg.AddTopValues(selection.Columns, sampler, datasets[0], samplingCfg.MaxValues, samplingCfg.MaxColumns)
+	}
+
+	b, err := json.Marshal(selection.Columns)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to serialize columns")
+	}
+	return string(b), nil
+}
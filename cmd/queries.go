@@ -0,0 +1,388 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewQueriesCmd creates a command to manage the local query library
+func NewQueriesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queries",
+		Short: "Manage the local library of saved queries",
+		Long: `Manage the local library of saved queries.
+
+Queries are stored as JSON files in the queries directory next to the config file (default $HOME/.hccli/queries)
+along with the dataset, the natural language question and translator that produced them and the Honeycomb query ID
+and URL once they have been created. Use nltoq --save to save the output of the translator.
+
+show also accepts a fuzzy search term if it matches exactly one saved query; run and rm require the exact name
+or query ID and suggest close matches if there isn't one.`,
+	}
+
+	cmd.AddCommand(NewQueriesSaveCmd())
+	cmd.AddCommand(NewQueriesListCmd())
+	cmd.AddCommand(NewQueriesShowCmd())
+	cmd.AddCommand(NewQueriesRmCmd())
+	cmd.AddCommand(NewQueriesRunCmd())
+	return cmd
+}
+
+// NewQueriesSaveCmd creates a command to save a query in the library
+func NewQueriesSaveCmd() *cobra.Command {
+	var qFlags queryFlags
+	var dataset string
+	var nlq string
+	var create bool
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "save <name>",
+		Short: "Save a query in the library",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				hcq, err := qFlags.read(app.Config, time.Now())
+				if err != nil {
+					return err
+				}
+
+				saved := pkg.SavedQuery{
+					Name:    args[0],
+					Dataset: dataset,
+					NLQ:     nlq,
+					Query:   *hcq,
+				}
+				if create {
+					if dataset == "" {
+						return errors.New("--dataset is required to create the query")
+					}
+					saved.QueryID, saved.URL, err = createQuery(app.Config, dataset, *hcq)
+					if err != nil {
+						return err
+					}
+				}
+
+				lib := &pkg.QueryLibrary{Dir: app.Config.GetQueriesDir()}
+				if err := lib.Save(saved, force); err != nil {
+					return err
+				}
+				// Save sets the creation time so print the query as it was stored.
+				stored, err := lib.Get(saved.Name)
+				if err != nil {
+					return err
+				}
+				return app.Print(stored, func(w io.Writer) error {
+					fmt.Fprintf(w, "Saved query %v\n", stored.Name)
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	qFlags.addFlags(cmd)
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "The dataset the query is for")
+	cmd.Flags().StringVarP(&nlq, "nlq", "", "", "The natural language question the query answers")
+	cmd.Flags().BoolVarP(&create, "create", "", false, "Also create the query in Honeycomb and record its ID and URL")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing query with the same name")
+	return cmd
+}
+
+// NewQueriesListCmd creates a command to list saved queries
+func NewQueriesListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list [search]",
+		Short: "List saved queries; optionally only those whose name or question fuzzily match the search term",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				lib := &pkg.QueryLibrary{Dir: app.Config.GetQueriesDir()}
+				var queries []pkg.SavedQuery
+				var err error
+				if len(args) == 1 {
+					queries, err = lib.Search(args[0])
+				} else {
+					queries, err = lib.List()
+				}
+				if err != nil {
+					return err
+				}
+				return app.Print(queries, func(w io.Writer) error {
+					if len(queries) == 0 {
+						fmt.Fprintf(w, "No saved queries in %v\n", lib.Dir)
+						return nil
+					}
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "NAME\tDATASET\tCREATED\tQUERY ID\tNLQ")
+					for _, q := range queries {
+						fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", q.Name, q.Dataset, q.CreatedAt.Format(time.RFC3339), q.QueryID, q.NLQ)
+					}
+					return tw.Flush()
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// NewQueriesShowCmd creates a command to print a saved query
+func NewQueriesShowCmd() *cobra.Command {
+	var format string
+	cmd := &cobra.Command{
+		Use:   "show <name>",
+		Short: "Print a saved query and where it came from",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				lib := &pkg.QueryLibrary{Dir: app.Config.GetQueriesDir()}
+				q, err := findSavedQuery(lib, args[0])
+				if err != nil {
+					return err
+				}
+
+				return app.Print(q, func(w io.Writer) error {
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintf(tw, "Name:\t%s\n", q.Name)
+					fmt.Fprintf(tw, "Dataset:\t%s\n", q.Dataset)
+					fmt.Fprintf(tw, "NLQ:\t%s\n", q.NLQ)
+					fmt.Fprintf(tw, "Translator:\t%s\n", q.Translator)
+					fmt.Fprintf(tw, "Created:\t%s\n", q.CreatedAt.Format(time.RFC3339))
+					fmt.Fprintf(tw, "Query ID:\t%s\n", q.QueryID)
+					fmt.Fprintf(tw, "URL:\t%s\n", q.URL)
+					if err := tw.Flush(); err != nil {
+						return err
+					}
+
+					b, err := pkg.FormatQuery(q.Query, format)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(w)
+					_, err = w.Write(b)
+					return err
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "", pkg.FormatJSON, "Format of the query printed with --output text; json, compact, yaml or text")
+	return cmd
+}
+
+// NewQueriesRmCmd creates a command to delete a saved query
+func NewQueriesRmCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm <name>",
+		Short: "Delete a saved query; the name or query ID must match exactly",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				lib := &pkg.QueryLibrary{Dir: app.Config.GetQueriesDir()}
+				q, err := getSavedQuery(lib, args[0])
+				if err != nil {
+					return err
+				}
+				if err := lib.Remove(q.Name); err != nil {
+					return err
+				}
+				return app.Print(queriesRmResult{Removed: q.Name}, func(w io.Writer) error {
+					fmt.Fprintf(w, "Removed query %v\n", q.Name)
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// NewQueriesRunCmd creates a command to create a saved query in Honeycomb
+func NewQueriesRunCmd() *cobra.Command {
+	var dataset string
+	cmd := &cobra.Command{
+		Use:   "run <name>",
+		Short: "Create a saved query in Honeycomb and record its ID and URL; the name or query ID must match exactly",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				log := zapr.NewLogger(zap.L())
+				logVersion()
+
+				lib := &pkg.QueryLibrary{Dir: app.Config.GetQueriesDir()}
+				q, err := getSavedQuery(lib, args[0])
+				if err != nil {
+					return err
+				}
+				// Saved queries can be edited by hand so they are validated again.
+				if err := pkg.ValidateQuery(q.Query); err != nil {
+					return errors.Wrapf(err, "Saved query %v is invalid", q.Name)
+				}
+				if dataset == "" {
+					dataset = q.Dataset
+				}
+				if dataset == "" {
+					return errors.Errorf("Query %v doesn't have a dataset; specify one with --dataset", q.Name)
+				}
+
+				qid, u, err := createQuery(app.Config, dataset, q.Query)
+				if err != nil {
+					return err
+				}
+				if err := printCreatedQuery(app, q.Query, pkg.CreatedQuery{Dataset: dataset, QueryID: qid, URL: u}); err != nil {
+					return err
+				}
+
+				// Only record the ID if the query was created in the dataset it was saved for.
+				if dataset == q.Dataset {
+					q.QueryID = qid
+					q.URL = u
+					if err := lib.Save(*q, true); err != nil {
+						log.Error(err, "Failed to record query ID", "name", q.Name)
+					}
+				}
+				return nil
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "The dataset slug to create the query in. Defaults to the dataset the query was saved with.")
+	return cmd
+}
+
+// queriesRmResult is the result of hccli queries rm.
+type queriesRmResult struct {
+	Removed string `json:"removed"`
+}
+
+// maxSuggestions is the number of fuzzy matches suggested when a saved query isn't found.
+const maxSuggestions = 5
+
+// getSavedQuery returns the saved query with exactly the given name or Honeycomb query ID.
+// It is used by commands that change things so a typo can't pick a different query; if there isn't a match the
+// error suggests the queries that fuzzily match.
+func getSavedQuery(lib *pkg.QueryLibrary, name string) (*pkg.SavedQuery, error) {
+	if q, err := lib.Get(name); err == nil {
+		return q, nil
+	}
+	queries, err := lib.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range queries {
+		if q.QueryID != "" && q.QueryID == name {
+			return &q, nil
+		}
+	}
+
+	matches, err := lib.Search(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, errors.Errorf("No saved query is named %v", name)
+	}
+	names := make([]string, 0, maxSuggestions)
+	for _, m := range matches[:min(len(matches), maxSuggestions)] {
+		names = append(names, m.Name)
+	}
+	return nil, errors.Errorf("No saved query is named %v; did you mean %v?", name, strings.Join(names, ", "))
+}
+
+// findSavedQuery returns the saved query with the given name.
+// If there isn't one it falls back to a fuzzy search as long as exactly one query matches; it should only be used
+// by commands that just read the query.
+func findSavedQuery(lib *pkg.QueryLibrary, name string) (*pkg.SavedQuery, error) {
+	if q, err := lib.Get(name); err == nil {
+		return q, nil
+	}
+	matches, err := lib.Search(name)
+	if err != nil {
+		return nil, err
+	}
+	switch len(matches) {
+	case 0:
+		return nil, errors.Errorf("No saved query matches %v", name)
+	case 1:
+		return &matches[0], nil
+	default:
+		names := make([]string, 0, len(matches))
+		for _, m := range matches {
+			names = append(names, m.Name)
+		}
+		return nil, errors.Errorf("%v matches more than one saved query: %v", name, strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// queryFlags are the flags used by commands that take a honeycomb query.
+type queryFlags struct {
+	query     string
+	queryFile string
+	template  string
+	values    []string
+	time      pkg.TimeSpec
+}
+
+// addFlags registers the flags with the command.
+func (f *queryFlags) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.query, "query", "", "", "The honeycomb query. Either JSON, YAML, a python dictionary or the text syntax e.g. 'COUNT WHERE error exists GROUP BY name LAST 7d'")
+	cmd.Flags().StringVarP(&f.queryFile, "query-file", "", "", "A file containing the honeycomb query in any of the formats supported by --query")
+	cmd.Flags().StringVarP(&f.template, "template", "", "", "Name of a query template in the templates directory to render instead of --query")
+	cmd.Flags().StringArrayVarP(&f.values, "set", "", []string{}, "Values for the template's placeholders as name=value. Can be repeated.")
+	cmd.Flags().StringVarP(&f.time.Since, "since", "", "", "Query the last duration e.g. 2h or 7d. Overrides the time range of the query.")
+	cmd.Flags().StringVarP(&f.time.From, "from", "", "", "Start of the time range e.g. 2026-10-01T10:00:00Z or now-3h")
+	cmd.Flags().StringVarP(&f.time.To, "to", "", "", "End of the time range e.g. now-1h. Used with --from or --since.")
+	cmd.Flags().StringVarP(&f.time.Around, "around", "", "", "Query a window around this time. Used with --window.")
+	cmd.Flags().StringVarP(&f.time.Window, "window", "", "", "Duration before and after --around to query e.g. 30m")
+}
+
+// read reads or renders the query and applies the time flags; relative times are computed from now.
+// The query is validated so every command that reads one rejects invalid queries e.g. a negative time range
+// before sending them to Honeycomb or building a link.
+func (f *queryFlags) read(cfg *config.Config, now time.Time) (*pkg.HoneycombQuery, error) {
+	var hcq *pkg.HoneycombQuery
+	var err error
+	if f.template != "" {
+		if f.query != "" || f.queryFile != "" {
+			return nil, errors.New("--template can't be used with --query or --query-file")
+		}
+		hcq, err = renderTemplate(cfg, f.template, f.values)
+	} else {
+		hcq, err = readQuery(f.query, f.queryFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := f.time.Apply(hcq, now); err != nil {
+		return nil, err
+	}
+	if err := pkg.ValidateQuery(*hcq); err != nil {
+		return nil, errors.Wrapf(err, "Invalid query")
+	}
+	return hcq, nil
+}
+
+// readQuery reads the honeycomb query from the value of either the --query or --query-file flag.
+// Exactly one of query and queryFile should be non-empty.
+func readQuery(query string, queryFile string) (*pkg.HoneycombQuery, error) {
+	log := zapr.NewLogger(zap.L())
+	if (query == "" && queryFile == "") || (query != "" && queryFile != "") {
+		return nil, errors.New("Exactly one of --query, --query-file and --template must be specified")
+	}
+
+	if queryFile != "" {
+		data, err := os.ReadFile(queryFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error reading query file %v", queryFile)
+		}
+		query = string(data)
+	}
+
+	hcq, err := pkg.ParseAnyQuery(query)
+	if err != nil {
+		log.Error(err, "Error unmarshalling query", "query", query)
+		return nil, errors.Wrapf(err, "Error unmarshalling query")
+	}
+	return hcq, nil
+}
+
+// renderTemplate renders the named template in the templates directory using the name=value pairs.
+func renderTemplate(cfg *config.Config, name string, pairs []string) (*pkg.HoneycombQuery, error) {
+	values, err := pkg.ParseTemplateValues(pairs)
+	if err != nil {
+		return nil, err
+	}
+	store := &pkg.TemplateStore{Dir: cfg.GetTemplatesDir()}
+	t, err := store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.RenderQuery(values)
+}
+
+// createQuery creates the query in Honeycomb and returns its ID.
+// A URL for the query is also returned if baseURL is configured.
+func createQuery(cfg *config.Config, dataset string, q pkg.HoneycombQuery) (string, string, error) {
+	hc, err := pkg.NewHoneycombClient(*cfg)
+	if err != nil {
+		return "", "", err
+	}
+	qid, err := hc.CreateQuery(dataset, q)
+	if err != nil {
+		return "", "", err
+	}
+	u, err := queryURL(cfg, q, dataset)
+	if err != nil {
+		return "", "", err
+	}
+	return qid, u, nil
+}
+
+// queryURL returns a URL for the query or the empty string if baseURL isn't configured.
+func queryURL(cfg *config.Config, q pkg.HoneycombQuery, dataset string) (string, error) {
+	if cfg.BaseURL == "" {
+		return "", nil
+	}
+	return pkg.QueryToURL(q, cfg.BaseURL, dataset)
+}
+
+// printCreatedQuery prints the result of creating a single query.
+func printCreatedQuery(a *app.App, q pkg.HoneycombQuery, created pkg.CreatedQuery) error {
+	return a.Print(pkg.CreateQueryResult{Query: q, Queries: []pkg.CreatedQuery{created}}, func(w io.Writer) error {
+		fmt.Fprintf(w, "Created query :\n%v\n", created.QueryID)
+		if created.URL != "" {
+			fmt.Fprintf(w, "Honeycomb URL:\n%v\n", created.URL)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewQueryDiff creates a command to compare two queries
+func NewQueryDiff() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "querydiff <a> <b>",
+		Short: "Report the semantic differences between two honeycomb queries",
+		Long: `Report the semantic differences between two honeycomb queries.
+
+Each file can be JSON, YAML or the text syntax e.g. "COUNT WHERE error exists GROUP BY name".
+The order of breakdowns, calculations, filters and havings and default values are ignored.
+The exit code is 0 if the queries are equivalent, 1 if they differ and 2 if there was an error.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			app := app.NewApp()
+			diffs, err := func() ([]pkg.QueryDifference, error) {
+				if err := app.SetOutput(cmd); err != nil {
+					return nil, err
+				}
+				queries := make([]*pkg.HoneycombQuery, 0, 2)
+				for _, f := range args {
+					data, err := os.ReadFile(f)
+					if err != nil {
+						return nil, errors.Wrapf(err, "Error reading query file %v", f)
+					}
+					q, err := pkg.ParseAnyQuery(string(data))
+					if err != nil {
+						return nil, errors.Wrapf(err, "Error parsing query file %v", f)
+					}
+					queries = append(queries, q)
+				}
+				return pkg.DiffQueries(*queries[0], *queries[1]), nil
+			}()
+
+			if err != nil {
+				app.PrintError(err)
+				os.Exit(2)
+			}
+
+			if err := app.Print(pkg.QueryDiffResult{Equivalent: len(diffs) == 0, Differences: diffs}, func(w io.Writer) error {
+				for _, d := range diffs {
+					fmt.Fprintln(w, d.String())
+				}
+				return nil
+			}); err != nil {
+				app.PrintError(err)
+				os.Exit(2)
+			}
+			if len(diffs) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// NewRefineCmd creates a command to change a query as described by an instruction
+func NewRefineCmd() *cobra.Command {
+	var flags queryFlags
+	var nlq string
+	var cols string
+	var dataset string
+	var refresh bool
+	var sampling samplingFlags
+	cmd := &cobra.Command{
+		Use:   "refine <instruction>",
+		Short: "Change a query as described by an instruction e.g. \"same as before but for the last hour\"",
+		Long: `Change a query as described by an instruction e.g. "same as before but for the last hour".
+
+Chat models (translator.chat) are sent the question the query answers (--nlq), the query and the instruction.
+Other translators only answer single questions so common edits are applied by rules first:
+
+  for the last hour, past 30 minutes, last 7d      change the time range
+  limit 20, top 5                                  change the limit
+  group by http.route, also group by region        replace or add breakdowns
+  where status_code >= 500                         add filters
+  remove the filter on error, remove the breakdown on name
+
+Instructions the rules don't recognize are sent to the translator. The rules are also used when a chat model
+fails.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+				log := zapr.NewLogger(zap.L())
+
+				logVersion()
+
+				q, err := flags.read(app.Config, time.Now())
+				if err != nil {
+					return err
+				}
+				instruction := strings.Join(args, " ")
+
+				translator, err := pkg.NewTranslator(*app.Config)
+				if err != nil {
+					return err
+				}
+
+				if cols == "" && dataset != "" {
+					hc, err := pkg.NewHoneycombClient(*app.Config)
+					if err != nil {
+						return err
+					}
+					columns, err := pkg.NewCachedColumnGetter(*app.Config, hc, refresh).GetColumns(dataset)
+					if err != nil {
+						return err
+					}
+					cols, err = promptColumns(app.Config, hc, []string{dataset}, strings.TrimSpace(nlq+" "+instruction), columns, sampling)
+					if err != nil {
+						return err
+					}
+				}
+
+				in := pkg.RefineInput{
+					Query:       *q,
+					Instruction: instruction,
+					COLS:        cols,
+				}
+				if nlq != "" {
+					in.Questions = []string{nlq}
+				}
+				entry, err := pkg.RunRefinement(pkg.NewRefiner(translator), in)
+				entry.Dataset = dataset
+				entry.Translator = pkg.TranslatorName(*app.Config)
+				history := &pkg.HistoryStore{Dir: app.Config.GetHistoryDir()}
+				if err := history.Append(entry, cols); err != nil {
+					log.Error(err, "Failed to record refinement in history")
+				}
+				if err != nil {
+					return err
+				}
+
+				result := pkg.NewTranslationResult(entry)
+				return app.Print(result, func(w io.Writer) error {
+					if entry.Query == nil {
+						fmt.Fprintf(w, "The output couldn't be parsed as a query; %v\n%v\n", entry.ParseError, entry.Output)
+						return nil
+					}
+					fmt.Fprintln(w, pkg.FormatTextQuery(*entry.Query))
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	flags.addFlags(cmd)
+	cmd.Flags().StringVarP(&nlq, "nlq", "", "", "The question the query answers; it gives chat models more context")
+	cmd.Flags().StringVarP(&cols, "cols", "", "", "Columns")
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "Honeycomb dataset to fetch columns for if cols isn't specified")
+	cmd.Flags().BoolVarP(&refresh, "refresh", "", false, "Fetch the columns from Honeycomb even if they are cached")
+	sampling.addFlags(cmd)
+	return cmd
+}
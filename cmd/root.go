@@ -11,18 +11,35 @@ func NewRootCmd() *cobra.Command {
 	var cfgFile string
 	var level string
 	var jsonLog bool
+	var profile string
+	var output string
 	rootCmd := &cobra.Command{
 		Short: "hccli",
 	}
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, config.ConfigFlagName, "", "config file (default is $HOME/.hccli/config.yaml)")
 	rootCmd.PersistentFlags().StringVarP(&level, config.LevelFlagName, "", "info", "The logging level.")
-	rootCmd.PersistentFlags().BoolVarP(&jsonLog, "json-logs", "", false, "Enable json logging.")
+	rootCmd.PersistentFlags().StringVarP(&profile, config.ProfileFlagName, "", "", "The configuration profile to use (default is currentProfile in the config file).")
+	rootCmd.PersistentFlags().StringVarP(&output, config.OutputFlagName, "o", "text", "Format of the output; text, json or yaml. Logs are always written to stderr.")
+	rootCmd.PersistentFlags().BoolVarP(&jsonLog, config.JSONLogsFlagName, "", false, "Write logs as JSON; shorthand for logging.format=json.")
 
 	rootCmd.AddCommand(NewConfigCmd())
 	rootCmd.AddCommand(NewNLToQuery())
 	rootCmd.AddCommand(NewCreateQuery())
 	rootCmd.AddCommand(NewQueryToURL())
+	rootCmd.AddCommand(NewURLToQuery())
+	rootCmd.AddCommand(NewLocalQuery())
+	rootCmd.AddCommand(NewEvalCmd())
+	rootCmd.AddCommand(NewQueryDiff())
+	rootCmd.AddCommand(NewFmtCmd())
+	rootCmd.AddCommand(NewTemplateCmd())
+	rootCmd.AddCommand(NewQueriesCmd())
+	rootCmd.AddCommand(NewHistoryCmd())
+	rootCmd.AddCommand(NewCacheCmd())
+	rootCmd.AddCommand(NewDoctorCmd())
+	rootCmd.AddCommand(NewShellCmd())
+	rootCmd.AddCommand(NewRefineCmd())
+	rootCmd.AddCommand(NewExplainCmd())
 	rootCmd.AddCommand(NewVersionCmd("hccli", os.Stdout))
 	return rootCmd
 }
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/jlewi/hccli/pkg/shell"
+	"github.com/jlewi/hydros/pkg/util"
+	"github.com/pkg/browser"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// NewShellCmd creates a command to explore a dataset interactively
+func NewShellCmd() *cobra.Command {
+	var dataset string
+	var chromePort int
+	var refresh bool
+	var sampling samplingFlags
+	cmd := &cobra.Command{
+		Use:   "shell",
+		Short: "Explore a dataset interactively by asking questions and refining the query",
+		Long: `Explore a dataset interactively by asking questions and refining the query.
+
+Ask a question to translate it into a query. Follow ups such as "now only errors" or "group by region too" change
+the current query. Chat models are sent the conversation so far; common edits such as "for the last hour",
+"where status_code >= 500" or "group by region" are otherwise applied without the translator.
+Fields can also be edited directly e.g. set limit 50. Type help to see the commands.
+
+Lines are saved in the shell_history file next to the config file; tab completes commands and column names.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				logVersion()
+
+				translator, err := pkg.NewTranslator(*app.Config)
+				if err != nil {
+					return err
+				}
+				hc, err := pkg.NewHoneycombClient(*app.Config)
+				if err != nil {
+					return err
+				}
+				columns, err := pkg.NewCachedColumnGetter(*app.Config, hc, refresh).GetColumns(dataset)
+				if err != nil {
+					return err
+				}
+				names := make([]string, 0, len(columns))
+				for _, c := range columns {
+					names = append(names, c.KeyName)
+				}
+
+				session := &shell.Session{
+					Dataset:        dataset,
+					Translator:     translator,
+					TranslatorName: pkg.TranslatorName(*app.Config),
+					Refiner:        pkg.NewRefiner(translator),
+					Columns:        names,
+					PromptColumns: func(nlq string) (string, error) {
+						return promptColumns(app.Config, hc, []string{dataset}, nlq, columns, sampling)
+					},
+					History: &pkg.HistoryStore{Dir: app.Config.GetHistoryDir()},
+					Actions: &shellActions{cfg: app.Config, client: hc, chromePort: chromePort},
+					Out:     app.Out,
+				}
+
+				rl, err := readline.NewEx(&readline.Config{
+					Prompt:          dataset + "> ",
+					HistoryFile:     app.Config.GetShellHistoryFile(),
+					AutoComplete:    &shellCompleter{session: session},
+					InterruptPrompt: "^C",
+					EOFPrompt:       "exit",
+				})
+				if err != nil {
+					return errors.Wrapf(err, "Failed to start the shell")
+				}
+				defer rl.Close()
+				session.Out = rl.Stdout()
+
+				fmt.Fprintf(session.Out, "Exploring %v with %d columns; type help to see the commands.\n", dataset, len(columns))
+				for {
+					line, err := rl.Readline()
+					if err == readline.ErrInterrupt {
+						// Ctrl-C clears the line; on an empty line it exits.
+						if line == "" {
+							return nil
+						}
+						continue
+					}
+					if err == io.EOF {
+						return nil
+					}
+					if err != nil {
+						return errors.Wrapf(err, "Failed to read input")
+					}
+					exit, err := session.Handle(line)
+					if err != nil {
+						fmt.Fprintf(rl.Stderr(), "Error: %v\n", err)
+					}
+					if exit {
+						return nil
+					}
+				}
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "The dataset slug to explore")
+	cmd.Flags().IntVarP(&chromePort, "port", "", 9222, "Port chrome developer tools is running on. This only matters for screenshot.")
+	cmd.Flags().BoolVarP(&refresh, "refresh", "", false, "Fetch the columns from Honeycomb even if they are cached")
+	sampling.addFlags(cmd)
+	util.IgnoreError(cmd.MarkFlagRequired("dataset"))
+	return cmd
+}
+
+// shellActions runs, opens and screenshots the queries of the shell.
+type shellActions struct {
+	cfg        *config.Config
+	client     *pkg.HoneycombClient
+	chromePort int
+}
+
+func (a *shellActions) Run(w io.Writer, dataset string, q pkg.HoneycombQuery) error {
+	result, err := a.client.RunQuery(dataset, q)
+	if err != nil {
+		return err
+	}
+	return printResultRows(w, resultColumns(q), result.Results)
+}
+
+func (a *shellActions) Open(w io.Writer, dataset string, q pkg.HoneycombQuery) error {
+	u, err := a.url(dataset, q)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, u)
+	if err := browser.OpenURL(u); err != nil {
+		return errors.Wrapf(err, "Error opening URL %v", u)
+	}
+	return nil
+}
+
+func (a *shellActions) Screenshot(w io.Writer, dataset string, q pkg.HoneycombQuery, file string) error {
+	u, err := a.url(dataset, q)
+	if err != nil {
+		return err
+	}
+	if err := pkg.SaveHoneycombGraph(u, file, a.chromePort); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Saved graph to %v\n", file)
+	return nil
+}
+
+func (a *shellActions) url(dataset string, q pkg.HoneycombQuery) (string, error) {
+	if a.cfg.BaseURL == "" {
+		return "", errors.New("baseURL must be specified in config.yaml to open queries")
+	}
+	return pkg.QueryToURL(q, a.cfg.BaseURL, dataset)
+}
+
+// shellCompleter adapts Session.Complete to readline.
+type shellCompleter struct {
+	session *shell.Session
+}
+
+// Do returns the suffixes that complete the word before the cursor and the length of the typed part of the word.
+func (c *shellCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	matches, prefix := c.session.Complete(string(line[:pos]))
+	suffixes := make([][]rune, 0, len(matches))
+	for _, m := range matches {
+		suffixes = append(suffixes, []rune(strings.TrimPrefix(m, prefix)+" "))
+	}
+	return suffixes, len([]rune(prefix))
+}
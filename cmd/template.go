@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/jlewi/hydros/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// NewTemplateCmd creates a command to work with query templates
+func NewTemplateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "template",
+		Short: "Work with query templates",
+		Long: `Work with query templates.
+
+Templates are queries containing placeholders such as {{ .service }} and {{ .window }}. They are stored in the
+templates directory next to the config file (default $HOME/.hccli/templates) and can be written in any format
+accepted by --query; use .yaml, .yml, .json or .txt (text syntax) as the extension.
+
+Placeholders are filled in with --set name=value. Rendered templates can also be passed to createquery,
+querytourl and localquery with --template.`,
+	}
+
+	cmd.AddCommand(NewTemplateListCmd())
+	cmd.AddCommand(NewTemplateShowCmd())
+	cmd.AddCommand(NewTemplateRenderCmd())
+	cmd.AddCommand(NewTemplateRunCmd())
+	return cmd
+}
+
+// NewTemplateListCmd creates a command to list the templates
+func NewTemplateListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the query templates",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				store := &pkg.TemplateStore{Dir: app.Config.GetTemplatesDir()}
+				templates, err := store.List()
+				if err != nil {
+					return err
+				}
+				return app.Print(templates, func(w io.Writer) error {
+					if len(templates) == 0 {
+						fmt.Fprintf(w, "No templates in %v\n", store.Dir)
+						return nil
+					}
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "NAME\tPARAMETERS\tPATH")
+					for _, t := range templates {
+						fmt.Fprintf(tw, "%s\t%s\t%s\n", t.Name, strings.Join(t.Parameters, ","), t.Path)
+					}
+					return tw.Flush()
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// NewTemplateShowCmd creates a command to print a template
+func NewTemplateShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <name>",
+		Short: "Print a query template and its parameters",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				store := &pkg.TemplateStore{Dir: app.Config.GetTemplatesDir()}
+				t, err := store.Get(args[0])
+				if err != nil {
+					return err
+				}
+				return app.Print(templateShowResult{QueryTemplate: t, Text: t.Text}, func(w io.Writer) error {
+					fmt.Fprintf(w, "# %s\n# parameters: %s\n", t.Path, strings.Join(t.Parameters, ", "))
+					if len(t.Optional) > 0 {
+						fmt.Fprintf(w, "# optional: %s\n", strings.Join(t.Optional, ", "))
+					}
+					fmt.Fprint(w, t.Text)
+					if !strings.HasSuffix(t.Text, "\n") {
+						fmt.Fprintln(w)
+					}
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+	return cmd
+}
+
+// NewTemplateRenderCmd creates a command to render a template
+func NewTemplateRenderCmd() *cobra.Command {
+	var values []string
+	var format string
+	cmd := &cobra.Command{
+		Use:   "render <name>",
+		Short: "Render a query template and print the query",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				hcq, err := renderTemplate(app.Config, args[0], values)
+				if err != nil {
+					return err
+				}
+				return app.Print(templateRenderResult{Template: args[0], Query: *hcq}, func(w io.Writer) error {
+					b, err := pkg.FormatQuery(*hcq, format)
+					if err != nil {
+						return err
+					}
+					_, err = w.Write(b)
+					return err
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&values, "set", "", []string{}, "Values for the template's placeholders as name=value. Can be repeated.")
+	cmd.Flags().StringVarP(&format, "format", "", pkg.FormatJSON, "Format of the query printed with --output text; json, compact, yaml or text")
+	return cmd
+}
+
+// NewTemplateRunCmd creates a command to render a template and create the query in Honeycomb
+func NewTemplateRunCmd() *cobra.Command {
+	var values []string
+	var dataset string
+	cmd := &cobra.Command{
+		Use:   "run <name>",
+		Short: "Render a query template and create the query in Honeycomb",
+		Long: `Render a query template and create the query in Honeycomb.
+
+The ID of the query is printed along with a link to it if baseURL is configured.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				logVersion()
+
+				hcq, err := renderTemplate(app.Config, args[0], values)
+				if err != nil {
+					return err
+				}
+
+				qid, u, err := createQuery(app.Config, dataset, *hcq)
+				if err != nil {
+					return err
+				}
+				return printCreatedQuery(app, *hcq, pkg.CreatedQuery{Dataset: dataset, QueryID: qid, URL: u})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&values, "set", "", []string{}, "Values for the template's placeholders as name=value. Can be repeated.")
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "The dataset slug to create the query in")
+	util.IgnoreError(cmd.MarkFlagRequired("dataset"))
+	return cmd
+}
+
+// templateShowResult is the result of hccli template show.
+type templateShowResult struct {
+	*pkg.QueryTemplate
+	// Text isn't serialized by QueryTemplate.
+	Text string `json:"text"`
+}
+
+// templateRenderResult is the result of hccli template render.
+type templateRenderResult struct {
+	Template string             `json:"template"`
+	Query    pkg.HoneycombQuery `json:"query"`
+}
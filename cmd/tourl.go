@@ -1,11 +1,13 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/go-logr/zapr"
 	"github.com/jlewi/hccli/pkg"
 	"github.com/jlewi/hccli/pkg/app"
 	"github.com/jlewi/hccli/pkg/config"
@@ -13,18 +15,18 @@ import (
 	"github.com/pkg/browser"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
-	"go.uber.org/zap"
 )
 
 // NewQueryToURL creates a command to turn queries into URLs
 func NewQueryToURL() *cobra.Command {
 	var dataset string
-	var query string
-	var queryFile string
+	var qFlags queryFlags
 	var baseURL string
 	var open bool
 	var outFile string
 	var chromePort int
+	var omitMissing bool
+	var params []string
 	cmd := &cobra.Command{
 		Use: "querytourl",
 		Run: func(cmd *cobra.Command, args []string) {
@@ -37,62 +39,84 @@ func NewQueryToURL() *cobra.Command {
 					return err
 				}
 
-				log := zapr.NewLogger(zap.L())
 				logVersion()
 
-				if (query == "" && queryFile == "") || (query != "" && queryFile != "") {
-					return errors.New("Exactly one of --query and --query-file must be specified")
-				}
-
-				if queryFile != "" {
-					data, err := os.ReadFile(queryFile)
-					if err != nil {
-						return errors.Wrapf(err, "Error reading query file %v", queryFile)
-					}
-					query = string(data)
-				}
-
-				hcq := &pkg.HoneycombQuery{}
-
-				if err := json.Unmarshal([]byte(query), hcq); err != nil {
-					log.Error(err, "Error unmarshalling query", "query", query)
-					return errors.Wrapf(err, "Error unmarshalling query")
+				hcq, err := qFlags.read(app.Config, time.Now())
+				if err != nil {
+					return err
 				}
 
 				if app.Config.BaseURL == "" {
 					return errors.New("baseURL must be specified either in config.yaml or via the --base-url flag")
 				}
-				hc, err := pkg.QueryToURL(*hcq, app.Config.BaseURL, dataset)
+				datasets := pkg.ParseDatasets(dataset)
+				if outFile != "" && len(datasets) > 1 {
+					return errors.New("--out-file can only be used with a single dataset")
+				}
+				builder, err := pkg.NewQueryURLBuilder(app.Config.BaseURL)
 				if err != nil {
 					return err
 				}
-				fmt.Printf("Honeycomb URL:\n%v\n", hc)
-				if open {
-					if err := browser.OpenURL(hc); err != nil {
-						return errors.Wrapf(err, "Error opening URL %v", hc)
+				builder.OmitMissingValues = omitMissing
+				builder.Params = url.Values{}
+				for _, p := range params {
+					k, v, ok := strings.Cut(p, "=")
+					if !ok || k == "" {
+						return errors.Errorf("--param %v should be of the form key=value", p)
 					}
+					if k == "query" {
+						return errors.New("--param can't set the query; use --query or --query-file")
+					}
+					builder.Params.Add(k, v)
 				}
-				if outFile != "" {
-					if err := pkg.SaveHoneycombGraph(hc, outFile, chromePort); err != nil {
+				result := pkg.QueryURLResult{Query: *hcq, URLs: make([]pkg.QueryURL, 0, len(datasets)), OutFile: outFile}
+				for _, d := range datasets {
+					b := *builder
+					if d != "" {
+						b.Dataset = d
+					}
+					hc, err := b.Build(*hcq)
+					if err != nil {
 						return err
 					}
+					result.URLs = append(result.URLs, pkg.QueryURL{Dataset: d, URL: hc})
+					if open {
+						if err := browser.OpenURL(hc); err != nil {
+							return errors.Wrapf(err, "Error opening URL %v", hc)
+						}
+					}
+					if outFile != "" {
+						if err := pkg.SaveHoneycombGraph(hc, outFile, chromePort); err != nil {
+							return err
+						}
+					}
 				}
-				return nil
+				return app.Print(result, func(w io.Writer) error {
+					for _, u := range result.URLs {
+						if len(result.URLs) == 1 {
+							fmt.Fprintf(w, "Honeycomb URL:\n%v\n", u.URL)
+						} else {
+							fmt.Fprintf(w, "Honeycomb URL for %v:\n%v\n", u.Dataset, u.URL)
+						}
+					}
+					return nil
+				})
 			}()
 
 			if err != nil {
-				fmt.Printf("Error running request;\n %+v\n", err)
+				app.ReportError(cmd, err)
 				os.Exit(1)
 			}
 		},
 	}
 
-	cmd.Flags().StringVarP(&query, "query", "", "", "The honeycomb query")
-	cmd.Flags().StringVarP(&queryFile, "query-file", "", "", "A file containing the honeycomb query")
-	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "The dataset slug to create the query in")
+	qFlags.addFlags(cmd)
+	cmd.Flags().StringVarP(&dataset, "dataset", "", "", "The dataset slug to create the query in. Use __all__ for an environment wide query or a comma separated list of slugs for a URL per dataset.")
 	cmd.Flags().StringVarP(&outFile, "out-file", "", "", "Save a PNG of the page to this file")
 	cmd.Flags().IntVarP(&chromePort, "port", "", 9222, "Port chrome developer tools is running on. This only matters if you are saving a PNG of the page.")
 	cmd.Flags().StringVarP(&baseURL, config.BaseURLFlagName, "", "", "The base URL for your honeycomb URLs. It should be something like https://ui.honeycomb.io/${ORG}/environments/${ENVIRONMENT}")
+	cmd.Flags().BoolVarP(&omitMissing, "omit-missing-values", "", false, "Hide the groups that don't have a value for a breakdown column")
+	cmd.Flags().StringArrayVarP(&params, "param", "", []string{}, "Other parameters of the link as key=value e.g. --param vis=table. Can be repeated.")
 	cmd.Flags().BoolVarP(&open, "open", "", false, "Open the URL in a browser")
 	util.IgnoreError(cmd.MarkFlagRequired("dataset"))
 	return cmd
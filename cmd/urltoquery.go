@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jlewi/hccli/pkg"
+	"github.com/jlewi/hccli/pkg/app"
+	"github.com/spf13/cobra"
+)
+
+// NewURLToQuery creates a command to get the query of a link to the Honeycomb UI
+func NewURLToQuery() *cobra.Command {
+	var format string
+	cmd := &cobra.Command{
+		Use:   "urltoquery <url>",
+		Short: "Print the query of a link to the Honeycomb UI and the dataset and environment it came from",
+		Long: `Print the query of a link to the Honeycomb UI and the dataset and environment it came from.
+
+Links with a query parameter, such as the ones querytourl creates, are decoded. The queries of links to results
+e.g. https://ui.honeycomb.io/<team>/environments/<env>/datasets/<dataset>/result/<id> are fetched from Honeycomb's
+Query API using honeycombAPIKeyFile; the key must belong to the same environment as the link.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := func() error {
+				app := app.NewApp()
+				if err := app.LoadConfig(cmd); err != nil {
+					return err
+				}
+				if err := app.SetupLogging(); err != nil {
+					return err
+				}
+
+				// Only links to results need to be looked up so an API key isn't required for the others.
+				var getter pkg.QueryGetter
+				if l, err := pkg.ParseQueryURL(args[0]); err == nil && l.Query == nil {
+					hc, err := pkg.NewHoneycombClient(*app.Config)
+					if err != nil {
+						return err
+					}
+					getter = hc
+				}
+				link, err := pkg.URLToQuery(args[0], getter)
+				if err != nil {
+					return err
+				}
+
+				return app.Print(link, func(w io.Writer) error {
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintf(tw, "Team:\t%s\n", link.Team)
+					fmt.Fprintf(tw, "Environment:\t%s\n", link.Environment)
+					fmt.Fprintf(tw, "Dataset:\t%s\n", link.Dataset)
+					if link.ResultID != "" {
+						fmt.Fprintf(tw, "Result ID:\t%s\n", link.ResultID)
+						fmt.Fprintf(tw, "Query ID:\t%s\n", link.QueryID)
+					}
+					if err := tw.Flush(); err != nil {
+						return err
+					}
+
+					b, err := pkg.FormatQuery(*link.Query, format)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(w)
+					_, err = w.Write(b)
+					return err
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "", pkg.FormatJSON, "Format of the query printed with --output text; json, compact, yaml or text")
+	return cmd
+}
@@ -3,8 +3,10 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg/app"
 	"go.uber.org/zap"
 
 	"github.com/spf13/cobra"
@@ -25,12 +27,36 @@ func NewVersionCmd(name string, w io.Writer) *cobra.Command {
 		Short:   "Return version",
 		Example: fmt.Sprintf("%s  version", name),
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Fprintf(w, "%s %s, commit %s, built at %s by %s\n", name, version, commit, date, builtBy)
+			err := func() error {
+				a := app.NewApp()
+				a.Out = w
+				if err := a.SetOutput(cmd); err != nil {
+					return err
+				}
+				return a.Print(versionResult{Name: name, Version: version, Commit: commit, Date: date, BuiltBy: builtBy}, func(w io.Writer) error {
+					fmt.Fprintf(w, "%s %s, commit %s, built at %s by %s\n", name, version, commit, date, builtBy)
+					return nil
+				})
+			}()
+
+			if err != nil {
+				app.ReportError(cmd, err)
+				os.Exit(1)
+			}
 		},
 	}
 	return cmd
 }
 
+// versionResult is the result of hccli version.
+type versionResult struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+	BuiltBy string `json:"builtBy"`
+}
+
 func logVersion() {
 	log := zapr.NewLogger(zap.L())
 	log.Info("binary version", "version", version, "commit", commit, "date", date, "builtBy", builtBy)
@@ -4,6 +4,7 @@ go 1.21.0
 
 require (
 	github.com/chromedp/chromedp v0.9.5
+	github.com/chzyer/readline v1.5.1
 	github.com/go-logr/zapr v1.3.0
 	github.com/google/go-cmp v0.6.0
 	github.com/jlewi/hydros v0.0.5
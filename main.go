@@ -5,13 +5,14 @@ import (
 	"os"
 
 	"github.com/jlewi/hccli/cmd"
+	"github.com/jlewi/hccli/pkg/secrets"
 )
 
 func main() {
 	rootCmd := cmd.NewRootCmd()
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Printf("Command failed with error: %+v", err)
+		fmt.Print(secrets.Redact(fmt.Sprintf("Command failed with error: %+v", err)))
 		os.Exit(1)
 	}
 }
@@ -1,15 +1,17 @@
 package app
 
 import (
-	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/jlewi/hccli/pkg/config"
+	"github.com/jlewi/hccli/pkg/secrets"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // App is a struct to hold values needed across all commands.
@@ -17,12 +19,21 @@ import (
 type App struct {
 	Config *config.Config
 	Out    io.Writer
+	// Err is where the details of errors are written when the output is structured; see PrintError.
+	Err io.Writer
+	// Output is the format results are printed in; one of OutputText, OutputJSON or OutputYAML. See Print.
+	Output string
+	// unknownKeys are the problems with keys in the configuration that aren't configuration keys. They are logged as
+	// warnings by SetupLogging rather than failing every command; doctor and config edit report them as errors.
+	unknownKeys []string
 }
 
 // NewApp creates a new application. You should call one more setup/Load functions to properly set it up.
 func NewApp() *App {
 	return &App{
-		Out: os.Stdout,
+		Out:    os.Stdout,
+		Err:    os.Stderr,
+		Output: OutputText,
 	}
 }
 
@@ -31,26 +42,33 @@ func NewApp() *App {
 func (a *App) LoadConfig(cmd *cobra.Command) error {
 	// N.B. at this point we haven't configured any logging so zap just returns the default logger.
 	// TODO(jeremy): Should we just initialize the logger without cfg and then reinitialize it after we've read the config?
+	if err := a.SetOutput(cmd); err != nil {
+		return err
+	}
 	if err := config.InitViper(cmd); err != nil {
 		return err
 	}
+	if err := config.ApplyProfile(); err != nil {
+		return err
+	}
 	cfg := config.GetConfig()
 
 	if problems := cfg.IsValid(); len(problems) > 0 {
-		fmt.Fprintf(os.Stdout, "Invalid configuration; %s\n", strings.Join(problems, "\n"))
-		return fmt.Errorf("invalid configuration; fix the problems and then try again")
+		return errors.Errorf("Invalid configuration; fix the problems and then try again;\n%s", strings.Join(problems, "\n"))
 	}
+	a.unknownKeys = config.ValidateKeys(viper.AllKeys())
 	a.Config = cfg
 
 	return nil
 }
 
+// SetupLogging configures the global zap logger using the logging section of the configuration.
+// Logs are written to stderr, or logging.file if it is set, so stdout only contains the output of commands.
 func (a *App) SetupLogging() error {
 	if a.Config == nil {
 		return errors.New("Config is nil; call LoadConfig first")
 	}
 	cfg := a.Config
-	// Use a non-json configuration configuration
 	c := zap.NewDevelopmentConfig()
 
 	// Use the keys used by cloud logging
@@ -59,6 +77,14 @@ func (a *App) SetupLogging() error {
 	c.EncoderConfig.TimeKey = "time"
 	c.EncoderConfig.MessageKey = "message"
 
+	var encoder zapcore.Encoder
+	switch cfg.GetLogFormat() {
+	case config.LogFormatJSON:
+		encoder = zapcore.NewJSONEncoder(c.EncoderConfig)
+	default:
+		encoder = zapcore.NewConsoleEncoder(c.EncoderConfig)
+	}
+
 	lvl := cfg.GetLogLevel()
 	zapLvl := zap.NewAtomicLevel()
 
@@ -66,13 +92,34 @@ func (a *App) SetupLogging() error {
 		return errors.Wrapf(err, "Could not convert level %v to ZapLevel", lvl)
 	}
 
-	c.Level = zapLvl
-	newLogger, err := c.Build()
-	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize zap logger; error %v", err))
+	levels := make(map[string]zapcore.Level)
+	for pkg, l := range cfg.Logging.Levels {
+		pkgLvl, err := zapcore.ParseLevel(l)
+		if err != nil {
+			return errors.Wrapf(err, "Could not convert level %v of package %v to ZapLevel", l, pkg)
+		}
+		levels[pkg] = pkgLvl
+	}
+
+	var sink zapcore.WriteSyncer = zapcore.Lock(os.Stderr)
+	if cfg.Logging.File != "" {
+		f, err := newRotatingFile(cfg.Logging.File, int64(cfg.GetLogMaxSizeMB())*1024*1024, cfg.GetLogMaxBackups())
+		if err != nil {
+			return err
+		}
+		sink = f
 	}
 
+	core := newPackageLevelCore(zapcore.NewCore(encoder, sink, zapcore.DebugLevel), zapLvl.Level(), levels)
+	// Secrets such as API keys are redacted from all logs.
+	newLogger := zap.New(secrets.NewRedactingCore(core), zap.Development(), zap.AddCaller(), zap.AddStacktrace(zap.WarnLevel), zap.ErrorOutput(zapcore.Lock(os.Stderr)))
+
 	zap.ReplaceGlobals(newLogger)
 
+	// The stack trace isn't useful for a problem in the configuration file.
+	warn := newLogger.WithOptions(zap.AddStacktrace(zap.ErrorLevel))
+	for _, p := range a.unknownKeys {
+		warn.Warn(p)
+	}
 	return nil
 }
@@ -0,0 +1,91 @@
+package app
+
+import (
+	"sort"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// packageLevelCore is a zapcore.Core that applies different levels to different packages.
+//
+// The package is determined from the caller of the log statement. The level can't be checked in Check because zap
+// only adds the caller afterwards so entries at or above the lowest level are checked in Write.
+type packageLevelCore struct {
+	zapcore.Core
+	level zapcore.Level
+	// packages are the package suffixes with their own levels; longest first so the most specific match wins.
+	packages []string
+	levels   map[string]zapcore.Level
+}
+
+// newPackageLevelCore wraps core so entries use the level of their package or level if their package doesn't have one.
+// levels maps suffixes of import paths e.g. pkg/config to levels.
+func newPackageLevelCore(core zapcore.Core, level zapcore.Level, levels map[string]zapcore.Level) zapcore.Core {
+	c := &packageLevelCore{
+		Core:     core,
+		level:    level,
+		packages: make([]string, 0, len(levels)),
+		levels:   levels,
+	}
+	for p := range levels {
+		c.packages = append(c.packages, p)
+	}
+	sort.Slice(c.packages, func(i, j int) bool {
+		return len(c.packages[i]) > len(c.packages[j])
+	})
+	return c
+}
+
+func (c *packageLevelCore) minLevel() zapcore.Level {
+	min := c.level
+	for _, l := range c.levels {
+		if l < min {
+			min = l
+		}
+	}
+	return min
+}
+
+func (c *packageLevelCore) Enabled(l zapcore.Level) bool {
+	return l >= c.minLevel()
+}
+
+func (c *packageLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &packageLevelCore{Core: c.Core.With(fields), level: c.level, packages: c.packages, levels: c.levels}
+}
+
+func (c *packageLevelCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *packageLevelCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	if e.Level < c.levelFor(callerPackage(e.Caller)) {
+		return nil
+	}
+	return c.Core.Write(e, fields)
+}
+
+// levelFor returns the level of the package.
+func (c *packageLevelCore) levelFor(pkg string) zapcore.Level {
+	for _, p := range c.packages {
+		if pkg == p || strings.HasSuffix(pkg, "/"+p) {
+			return c.levels[p]
+		}
+	}
+	return c.level
+}
+
+// callerPackage returns the import path of the package of the caller
+// e.g. github.com/jlewi/hccli/pkg/config for github.com/jlewi/hccli/pkg/config.(*Config).Write.
+func callerPackage(caller zapcore.EntryCaller) string {
+	f := caller.Function
+	slash := strings.LastIndex(f, "/")
+	if dot := strings.Index(f[slash+1:], "."); dot >= 0 {
+		return f[:slash+1+dot]
+	}
+	return f
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/hccli/pkg/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_PackageLevelCore(t *testing.T) {
+	type testCase struct {
+		function string
+		level    zapcore.Level
+		expected bool
+	}
+
+	observed, logs := observer.New(zapcore.DebugLevel)
+	core := newPackageLevelCore(observed, zapcore.InfoLevel, map[string]zapcore.Level{
+		"pkg":        zapcore.WarnLevel,
+		"pkg/config": zapcore.DebugLevel,
+	})
+
+	cases := []testCase{
+		{function: "github.com/jlewi/hccli/pkg/config.(*Config).Write", level: zapcore.DebugLevel, expected: true},
+		{function: "github.com/jlewi/hccli/pkg.(*HoneycombClient).GetColumns", level: zapcore.InfoLevel, expected: false},
+		{function: "github.com/jlewi/hccli/pkg.(*HoneycombClient).GetColumns", level: zapcore.WarnLevel, expected: true},
+		{function: "github.com/jlewi/hccli/cmd.NewNLToQuery.func1", level: zapcore.InfoLevel, expected: true},
+		{function: "github.com/jlewi/hccli/cmd.NewNLToQuery.func1", level: zapcore.DebugLevel, expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.function+"/"+c.level.String(), func(t *testing.T) {
+			logs.TakeAll()
+			e := zapcore.Entry{Level: c.level, Message: "hello", Caller: zapcore.EntryCaller{Defined: true, Function: c.function}}
+			if ce := core.Check(e, nil); ce != nil {
+				ce.Write()
+			}
+			if actual := logs.Len() == 1; actual != c.expected {
+				t.Errorf("Unexpected result for %v at %v; got %v want %v", c.function, c.level, actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_RotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "hccli.log")
+	f, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Failed to create log file; %v", err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write log; %v", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Failed to sync log; %v", err)
+	}
+
+	actual := map[string]string{}
+	for _, name := range []string{path, path + ".1", path + ".2", path + ".3"} {
+		b, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to read %v; %v", name, err)
+		}
+		actual[strings.TrimPrefix(name, path)] = string(b)
+	}
+
+	expected := map[string]string{
+		"":   "fourth\n",
+		".1": "third\n",
+		".2": "second\n",
+	}
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Unexpected log files;diff:\n%v", d)
+	}
+}
+
+func Test_RotatingFileFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hccli.log")
+	f, err := newRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatalf("Failed to create log file; %v", err)
+	}
+	// A directory that isn't empty where the backup goes makes the rotation fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "child"), 0700); err != nil {
+		t.Fatalf("Failed to create directory; %v", err)
+	}
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatalf("Failed to write log; %v", err)
+	}
+	if _, err := f.Write([]byte("second\n")); err == nil {
+		t.Errorf("Expected an error rotating the log file")
+	}
+	// The file is still usable after the rotation fails and the rotation isn't retried until the file has grown
+	// by maxSize again.
+	if _, err := f.Write([]byte("3\n")); err != nil {
+		t.Fatalf("Failed to write log after the rotation failed; %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		t.Fatalf("Failed to sync log; %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log; %v", err)
+	}
+	if d := cmp.Diff("first\nsecond\n3\n", string(b)); d != "" {
+		t.Errorf("Unexpected log file;diff:\n%v", d)
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatalf("Failed to remove directory; %v", err)
+	}
+	if _, err := f.Write([]byte("fourth\n")); err != nil {
+		t.Fatalf("Failed to rotate log; %v", err)
+	}
+	b, err = os.ReadFile(path)
+	if err != nil || string(b) != "fourth\n" {
+		t.Errorf("Expected the log to be rotated; got %q err %v", string(b), err)
+	}
+}
+
+func Test_SetupLoggingUnknownKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "hccli.log")
+	a := &App{
+		Config:      &config.Config{Logging: config.Logging{Level: "info", File: file}},
+		unknownKeys: []string{"Unknown configuration key aiendpont"},
+	}
+	defer zap.ReplaceGlobals(zap.L())
+	if err := a.SetupLogging(); err != nil {
+		t.Fatalf("Failed to set up logging; %v", err)
+	}
+	if err := zap.L().Sync(); err != nil {
+		t.Fatalf("Failed to sync log; %v", err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read log; %v", err)
+	}
+	if !strings.Contains(string(b), "WARN") || !strings.Contains(string(b), "Unknown configuration key aiendpont") {
+		t.Errorf("Expected the unknown key to be logged as a warning; got %q", string(b))
+	}
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/jlewi/hccli/pkg/secrets"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats supported by the --output flag.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+// outFileFlagName is the flag of commands that write their result to a file.
+const outFileFlagName = "out-file"
+
+// SetOutput sets the format results are printed in from the --output flag of the command.
+// The format defaults to text if the command doesn't have the flag.
+func (a *App) SetOutput(cmd *cobra.Command) error {
+	a.Output = OutputText
+	if cmd == nil {
+		return nil
+	}
+	f := cmd.Flags().Lookup(config.OutputFlagName)
+	if f == nil {
+		return nil
+	}
+	switch f.Value.String() {
+	case "", OutputText:
+	case OutputJSON, OutputYAML:
+		a.Output = f.Value.String()
+	default:
+		if cmd.Flags().Lookup(outFileFlagName) != nil {
+			// Commands such as nltoq used --output for the file to write to before it was the output format.
+			return errors.Errorf("Unsupported output %v; output should be %v, %v or %v. To write the result to a file use --%v", f.Value.String(), OutputText, OutputJSON, OutputYAML, outFileFlagName)
+		}
+		return errors.Errorf("Unsupported output %v; output should be %v, %v or %v", f.Value.String(), OutputText, OutputJSON, OutputYAML)
+	}
+	return nil
+}
+
+// ErrorResult is printed in place of the result when a command fails with json or yaml output.
+type ErrorResult struct {
+	Error string `json:"error"`
+}
+
+// ReportError prints the error a command failed with using the --output flag of the command; see PrintError.
+func ReportError(cmd *cobra.Command, err error) {
+	a := NewApp()
+	// An invalid --output is itself the error so it is reported as text.
+	_ = a.SetOutput(cmd)
+	a.PrintError(err)
+}
+
+// PrintError prints the error a command failed with. The details, including the stack trace, are printed to Err so
+// they don't mix with the output of the command. With json or yaml output an ErrorResult is also printed to Out so
+// scripts parsing it get a result. Resolved secrets are redacted from both since errors can include them e.g. the
+// output of an exec:// resolver.
+func (a *App) PrintError(err error) {
+	fmt.Fprintf(a.Err, "Error running request;\n %s\n", secrets.Redact(fmt.Sprintf("%+v", err)))
+	if !a.Structured() {
+		return
+	}
+	if perr := a.Print(ErrorResult{Error: secrets.Redact(err.Error())}, nil); perr != nil {
+		fmt.Fprintf(a.Err, "%s\n", secrets.Redact(perr.Error()))
+	}
+}
+
+// Structured returns true if results are printed as JSON or YAML rather than text.
+func (a *App) Structured() bool {
+	return a.Output == OutputJSON || a.Output == OutputYAML
+}
+
+// Print writes the result of a command to Out.
+// With json or yaml output the result is serialized; its JSON field names are used in both formats so scripts can
+// switch between them. Otherwise text is called to print the result for people.
+func (a *App) Print(result interface{}, text func(w io.Writer) error) error {
+	switch a.Output {
+	case OutputJSON:
+		enc := json.NewEncoder(a.Out)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return errors.Wrapf(enc.Encode(result), "Failed to write result")
+	case OutputYAML:
+		// Round trip through JSON so the fields are named by their JSON tags.
+		b, err := json.Marshal(result)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to serialize result")
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return errors.Wrapf(err, "Failed to serialize result")
+		}
+		enc := yaml.NewEncoder(a.Out)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return errors.Wrapf(err, "Failed to write result")
+		}
+		return errors.Wrapf(enc.Close(), "Failed to write result")
+	default:
+		return text(a.Out)
+	}
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/jlewi/hccli/pkg/secrets"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func Test_Print(t *testing.T) {
+	type result struct {
+		QueryID string   `json:"queryID"`
+		URLs    []string `json:"urls"`
+		Error   string   `json:"error,omitempty"`
+	}
+
+	type testCase struct {
+		output   string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			output:   OutputText,
+			expected: "Created query abc\n",
+		},
+		{
+			output:   OutputJSON,
+			expected: "{\n  \"queryID\": \"abc\",\n  \"urls\": [\n    \"https://ui.honeycomb.io/team/datasets/api?query={}&x=1\"\n  ]\n}\n",
+		},
+		{
+			output:   OutputYAML,
+			expected: "queryID: abc\nurls:\n  - https://ui.honeycomb.io/team/datasets/api?query={}&x=1\n",
+		},
+	}
+
+	r := result{QueryID: "abc", URLs: []string{"https://ui.honeycomb.io/team/datasets/api?query={}&x=1"}}
+	for _, c := range cases {
+		t.Run(c.output, func(t *testing.T) {
+			var buf bytes.Buffer
+			a := &App{Out: &buf, Output: c.output}
+			if err := a.Print(r, func(w io.Writer) error {
+				_, err := io.WriteString(w, "Created query abc\n")
+				return err
+			}); err != nil {
+				t.Fatalf("Print failed; %v", err)
+			}
+			if d := cmp.Diff(c.expected, buf.String()); d != "" {
+				t.Errorf("Unexpected output;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_PrintError(t *testing.T) {
+	type testCase struct {
+		output   string
+		expected string
+		details  bool
+	}
+
+	cases := []testCase{
+		{
+			output:   OutputText,
+			expected: "",
+			details:  true,
+		},
+		{
+			output:   OutputJSON,
+			expected: "{\n  \"error\": \"Dataset api not found\"\n}\n",
+			details:  true,
+		},
+		{
+			output:   OutputYAML,
+			expected: "error: Dataset api not found\n",
+			details:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.output, func(t *testing.T) {
+			var out, stderr bytes.Buffer
+			a := &App{Out: &out, Err: &stderr, Output: c.output}
+			a.PrintError(fmt.Errorf("Dataset api not found"))
+			if d := cmp.Diff(c.expected, out.String()); d != "" {
+				t.Errorf("Unexpected output;diff:\n%v", d)
+			}
+			if hasDetails := strings.Contains(stderr.String(), "Dataset api not found"); hasDetails != c.details {
+				t.Errorf("Expected details on stderr to be %v; got %q", c.details, stderr.String())
+			}
+		})
+	}
+}
+
+func Test_PrintErrorRedacts(t *testing.T) {
+	secrets.AddRedaction("hcaik_printerror")
+	var out, stderr bytes.Buffer
+	a := &App{Out: &out, Err: &stderr, Output: OutputJSON}
+	a.PrintError(errors.Wrapf(fmt.Errorf("exec://get-key printed hcaik_printerror"), "Failed to resolve secret"))
+	for name, s := range map[string]string{"stdout": out.String(), "stderr": stderr.String()} {
+		if strings.Contains(s, "hcaik_printerror") || !strings.Contains(s, secrets.Redacted) {
+			t.Errorf("Secret should be redacted from %v; got %q", name, s)
+		}
+	}
+}
+
+func Test_SetOutputOutFile(t *testing.T) {
+	cmd := &cobra.Command{Use: "nltoq"}
+	cmd.Flags().StringP(config.OutputFlagName, "o", "text", "")
+	cmd.Flags().String(outFileFlagName, "", "")
+	if err := cmd.Flags().Parse([]string{"-o", "/tmp/query.json"}); err != nil {
+		t.Fatalf("Failed to parse flags; %v", err)
+	}
+	a := NewApp()
+	err := a.SetOutput(cmd)
+	if err == nil || !strings.Contains(err.Error(), "--out-file") {
+		t.Errorf("Expected an error pointing at --out-file; got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// rotatingFile is a log file that is rotated when it reaches maxSize bytes.
+// Rotated files are named <path>.1 (the most recent) to <path>.<maxBackups>; older files are removed.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.Wrapf(err, "Failed to create log directory for %v", path)
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	f, size, err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	r.f = f
+	r.size = size
+	return r, nil
+}
+
+// open opens the log file and returns it with its current size.
+func (r *rotatingFile) open() (*os.File, int64, error) {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "Failed to open log file %v", r.path)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, errors.Wrapf(err, "Failed to stat log file %v", r.path)
+	}
+	return f, info.Size(), nil
+}
+
+// Write writes p to the log file rotating it first if it would exceed maxSize.
+// If rotation fails p is still written to the current file and the rotation error is returned; rotation is
+// retried once another maxSize bytes have been written rather than on every write so repeated failures don't
+// shift out the backups.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rotateErr error
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if rotateErr = r.rotate(); rotateErr != nil {
+			r.size = 0
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+func (r *rotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Sync()
+}
+
+// rotate shifts the backups, moves the current file to <path>.1 and opens a new file.
+// The current file is only replaced once the new file is open so a failure doesn't lose the handle; the file is
+// renamed while it is open so writes after a failure go to <path>.1.
+func (r *rotatingFile) rotate() error {
+	if err := os.Remove(r.backup(r.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Failed to remove old log file")
+	}
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "Failed to rotate log file")
+		}
+	}
+	if r.maxBackups > 0 {
+		if err := os.Rename(r.path, r.backup(1)); err != nil {
+			return errors.Wrapf(err, "Failed to rotate log file")
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return errors.Wrapf(err, "Failed to rotate log file")
+	}
+	f, size, err := r.open()
+	if err != nil {
+		return err
+	}
+	old := r.f
+	r.f = f
+	r.size = size
+	if err := old.Close(); err != nil {
+		return errors.Wrapf(err, "Failed to close rotated log file %v", r.backup(1))
+	}
+	return nil
+}
+
+func (r *rotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
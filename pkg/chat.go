@@ -0,0 +1,203 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/jlewi/hccli/pkg/secrets"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// chatTimeout is how long to wait for a chat model to respond.
+const chatTimeout = 2 * time.Minute
+
+// chatSystemPrompt instructs chat models how to translate questions into queries.
+const chatSystemPrompt = `You translate questions about observability data into Honeycomb queries.
+Reply with a single Honeycomb query as JSON and nothing else. The fields of the query are
+breakdowns (a list of columns), calculations (a list of {"op", "column"} where op is one of COUNT, CONCURRENCY, SUM, AVG,
+COUNT_DISTINCT, HEATMAP, MAX, MIN, P001, P01, P05, P10, P25, P50, P75, P90, P95, P99, P999 or RATE_AVG, RATE_SUM, RATE_MAX),
+filters (a list of {"column", "op", "value"} where op is one of =, !=, >, >=, <, <=, starts-with, does-not-start-with,
+exists, does-not-exist, contains, does-not-contain, in, not-in), filter_combination (AND or OR),
+orders (a list of {"op", "column", "order"} where order is ascending or descending), havings, limit,
+granularity and time_range (seconds before now).
+Only use the columns you are given.`
+
+// chatExplainPrompt instructs chat models how to explain queries.
+const chatExplainPrompt = `You explain Honeycomb queries to engineers who are investigating their systems.
+Describe in a few sentences of plain English what the query shows and what it could be used to find out.
+Don't use markdown and don't repeat the JSON.`
+
+// ChatClient translates questions using a chat model with an OpenAI compatible chat completions API.
+// Unlike the other translators it can refine earlier queries since the conversation is sent to the model.
+type ChatClient struct {
+	config config.ChatConfig
+	apiKey string
+	client *http.Client
+}
+
+// NewChatClient creates a client for the chat model configured in translator.chat.
+func NewChatClient(cfg config.Config) (*ChatClient, error) {
+	c := cfg.GetTranslator().Chat
+	if c == nil {
+		return nil, errors.New("translator.chat isn't configured")
+	}
+	apiKey := ""
+	if c.APIKeyFile != "" {
+		var err error
+		apiKey, err = secrets.Resolve(c.APIKeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read chat API key from %s", c.APIKeyFile)
+		}
+	}
+	return &ChatClient{
+		config: *c,
+		apiKey: apiKey,
+		client: &http.Client{Timeout: chatTimeout},
+	}, nil
+}
+
+// ChatMessage is a message in a conversation with a chat model.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []ChatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// Translate takes a natural language query and returns the honeycomb query as a string
+func (c *ChatClient) Translate(inQuery QueryInput) (string, error) {
+	t, err := c.TranslateDetailed(inQuery)
+	if err != nil {
+		return "", err
+	}
+	return t.Output, nil
+}
+
+// TranslateDetailed returns the query along with the model reported by the API.
+func (c *ChatClient) TranslateDetailed(inQuery QueryInput) (*Translation, error) {
+	return c.chat(chatMessages(inQuery.COLS, []string{inQuery.NLQ}, nil, ""))
+}
+
+// Refine sends the conversation so far to the model; the earlier questions, the query that answered them and then
+// the instruction.
+func (c *ChatClient) Refine(in RefineInput) (*Translation, error) {
+	b, err := json.Marshal(in.Query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to serialize query")
+	}
+	return c.chat(chatMessages(in.COLS, in.Questions, b, in.Instruction))
+}
+
+// Explain asks the chat model to explain the query.
+func (c *ChatClient) Explain(q HoneycombQuery, literal string) (*Translation, error) {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to serialize query")
+	}
+	return c.chat([]ChatMessage{
+		{Role: "system", Content: chatExplainPrompt},
+		{Role: "user", Content: fmt.Sprintf("Explain this query %s\nA literal description of the query is: %s", string(b), literal)},
+	})
+}
+
+// chatMessages builds the conversation. If query is set it is the answer to the questions and the instruction is
+// sent as a follow up.
+func chatMessages(cols string, questions []string, query []byte, instruction string) []ChatMessage {
+	messages := []ChatMessage{
+		{Role: "system", Content: chatSystemPrompt},
+		{Role: "user", Content: fmt.Sprintf("The columns are %s\n\n%s", cols, strings.Join(questions, ". "))},
+	}
+	if query != nil {
+		messages = append(messages,
+			ChatMessage{Role: "assistant", Content: string(query)},
+			ChatMessage{Role: "user", Content: instruction + "\nReply with the complete modified query."},
+		)
+	}
+	return messages
+}
+
+func (c *ChatClient) chat(messages []ChatMessage) (*Translation, error) {
+	log := zapr.NewLogger(zap.L())
+	b, err := json.Marshal(chatRequest{Model: c.config.Model, Messages: messages})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to serialize chat request")
+	}
+	endpoint := strings.TrimSuffix(c.config.BaseURL, "/") + "/chat/completions"
+	log.Info("Sending chat request", "endpoint", endpoint, "model", c.config.Model, "messages", len(messages))
+
+	body, err := c.do(http.MethodPost, endpoint, bytes.NewBuffer(b))
+	if err != nil {
+		return nil, err
+	}
+	resp := &chatResponse{}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, errors.Wrapf(err, "Failed to deserialize chat response")
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("Chat response didn't include any choices")
+	}
+	output := resp.Choices[0].Message.Content
+	log.Info("Received response from chat model", "output", output)
+	return &Translation{
+		Output: stripCodeFence(output),
+		Model:  resp.Model,
+	}, nil
+}
+
+// do sends a request to the API and returns the body of the response.
+func (c *ChatClient) do(method string, endpoint string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to send request to %v", endpoint)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read response body")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Request failed with status code %v; body %v", resp.StatusCode, string(b))
+	}
+	return b, nil
+}
+
+// stripCodeFence removes the markdown code fence chat models often wrap their answers in.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	// Drop the language e.g. ```json
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/jlewi/hccli/pkg/secrets"
+)
+
+func Test_ChatClientRefine(t *testing.T) {
+	var request chatRequest
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"model":"gpt-4o-2024-08-06","choices":[{"message":{"role":"assistant","content":"` +
+			"```json\\n{\\\"calculations\\\": [{\\\"op\\\": \\\"COUNT\\\"}], \\\"time_range\\\": 3600}\\n```" + `"}}]}`))
+	}))
+	defer server.Close()
+
+	resolvers := secrets.NewResolvers()
+	resolvers.Register("fake", &secrets.FakeResolver{Secrets: map[string]string{"chat": "secret"}})
+	old := secrets.DefaultResolvers()
+	secrets.SetDefaultResolvers(resolvers)
+	defer secrets.SetDefaultResolvers(old)
+
+	client, err := NewChatClient(config.Config{
+		Translator: &config.TranslatorConfig{
+			Chat: &config.ChatConfig{BaseURL: server.URL + "/v1/", Model: "gpt-4o", APIKeyFile: "fake://chat"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client; %v", err)
+	}
+
+	translation, err := client.Refine(RefineInput{
+		Questions:   []string{"count requests"},
+		Query:       HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}, TimeRange: 7200},
+		Instruction: "same as before but for the last hour",
+		COLS:        `["error"]`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to refine query; %v", err)
+	}
+
+	expected := &Translation{
+		Output: `{"calculations": [{"op": "COUNT"}], "time_range": 3600}`,
+		Model:  "gpt-4o-2024-08-06",
+	}
+	if d := cmp.Diff(expected, translation); d != "" {
+		t.Errorf("Unexpected translation;diff:\n%v", d)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("Unexpected Authorization header; got %v", auth)
+	}
+
+	messages := []ChatMessage{
+		{Role: "system", Content: chatSystemPrompt},
+		{Role: "user", Content: "The columns are [\"error\"]\n\ncount requests"},
+		{Role: "assistant", Content: `{"calculations":[{"op":"COUNT"}],"filters":null,"time_range":7200}`},
+		{Role: "user", Content: "same as before but for the last hour\nReply with the complete modified query."},
+	}
+	if d := cmp.Diff(messages, request.Messages); d != "" {
+		t.Errorf("Unexpected messages;diff:\n%v", d)
+	}
+	if request.Model != "gpt-4o" {
+		t.Errorf("Unexpected model; got %v", request.Model)
+	}
+}
+
+func Test_ChatClientExplain(t *testing.T) {
+	var request chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"model":"gpt-4o","choices":[{"message":{"role":"assistant","content":" Shows how many requests fail. "}}]}`))
+	}))
+	defer server.Close()
+
+	client, err := NewChatClient(config.Config{
+		Translator: &config.TranslatorConfig{Chat: &config.ChatConfig{BaseURL: server.URL, Model: "gpt-4o"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client; %v", err)
+	}
+	translation, err := RunExplainer(client, HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}})
+	if err != nil {
+		t.Fatalf("Failed to explain query; %v", err)
+	}
+	if translation.Output != "Shows how many requests fail." {
+		t.Errorf("Unexpected explanation; got %q", translation.Output)
+	}
+	expected := "Explain this query {\"calculations\":[{\"op\":\"COUNT\"}],\"filters\":null}\nA literal description of the query is: The count of events"
+	if len(request.Messages) != 2 || request.Messages[1].Content != expected {
+		t.Errorf("Unexpected messages; got %+v", request.Messages)
+	}
+}
@@ -0,0 +1,229 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// columnCacheDir is the directory under the cache directory containing cached columns.
+const columnCacheDir = "columns"
+
+// ColumnGetter fetches the columns of a dataset.
+type ColumnGetter interface {
+	GetColumns(datasetSlug string) ([]HoneycombColumn, error)
+}
+
+// ColumnCacheEntry is the cached columns of a single dataset.
+type ColumnCacheEntry struct {
+	// Environment identifies the Honeycomb environment; see HoneycombClient.Environment.
+	Environment string            `json:"environment"`
+	Dataset     string            `json:"dataset"`
+	FetchedAt   time.Time         `json:"fetchedAt"`
+	Columns     []HoneycombColumn `json:"columns"`
+}
+
+// ColumnCache is an on disk cache of the columns of datasets keyed by environment and dataset.
+type ColumnCache struct {
+	Dir string
+	// TTL is how long entries are valid.
+	TTL time.Duration
+}
+
+// NewColumnCache creates the column cache configured by cfg.
+func NewColumnCache(cfg config.Config) *ColumnCache {
+	return &ColumnCache{
+		Dir: filepath.Join(cfg.GetCacheDir(), columnCacheDir),
+		TTL: cfg.GetColumnCacheTTL(),
+	}
+}
+
+// Get returns the cached columns for the dataset; ok is false if there is no entry or it has expired.
+func (c *ColumnCache) Get(environment string, dataset string, now time.Time) ([]HoneycombColumn, bool, error) {
+	e, err := c.read(c.path(environment, dataset))
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if c.expired(e, now) {
+		return nil, false, nil
+	}
+	return e.Columns, true, nil
+}
+
+// Put stores the columns of the dataset.
+func (c *ColumnCache) Put(environment string, dataset string, columns []HoneycombColumn, now time.Time) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return errors.Wrapf(err, "Failed to create cache directory %v", c.Dir)
+	}
+	b, err := json.Marshal(ColumnCacheEntry{
+		Environment: environment,
+		Dataset:     dataset,
+		FetchedAt:   now,
+		Columns:     columns,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize columns")
+	}
+	path := c.path(environment, dataset)
+	// Write to a temporary file and rename it so concurrent readers never see a partial entry.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrapf(err, "Failed to write %v", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrapf(err, "Failed to write %v", path)
+	}
+	return nil
+}
+
+// List returns the cached entries sorted by environment and dataset. Files that can't be parsed are logged and skipped.
+func (c *ColumnCache) List() ([]ColumnCacheEntry, error) {
+	log := zapr.NewLogger(zap.L())
+	files, err := os.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return []ColumnCacheEntry{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read cache directory %v", c.Dir)
+	}
+	entries := make([]ColumnCacheEntry, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(c.Dir, f.Name())
+		e, err := c.read(path)
+		if err != nil {
+			log.Error(err, "Skipping cache entry that can't be read", "path", path)
+			continue
+		}
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Environment != entries[j].Environment {
+			return entries[i].Environment < entries[j].Environment
+		}
+		return entries[i].Dataset < entries[j].Dataset
+	})
+	return entries, nil
+}
+
+// Expired returns true if the entry is older than the TTL.
+func (c *ColumnCache) Expired(e ColumnCacheEntry, now time.Time) bool {
+	return c.expired(&e, now)
+}
+
+// Clear removes the cached columns. If dataset is non-empty only the entries for that dataset are removed.
+// It returns the number of entries removed. Files that can't be parsed are removed when clearing everything and
+// skipped otherwise so a corrupt cache can always be cleared.
+func (c *ColumnCache) Clear(dataset string) (int, error) {
+	log := zapr.NewLogger(zap.L())
+	files, err := os.ReadDir(c.Dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to read cache directory %v", c.Dir)
+	}
+	removed := 0
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(c.Dir, f.Name())
+		if dataset != "" {
+			e, err := c.read(path)
+			if err != nil {
+				log.Error(err, "Skipping cache entry that can't be read", "path", path)
+				continue
+			}
+			if e.Dataset != dataset {
+				continue
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, errors.Wrapf(err, "Failed to remove cached columns %v", path)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (c *ColumnCache) expired(e *ColumnCacheEntry, now time.Time) bool {
+	return c.TTL <= 0 || now.Sub(e.FetchedAt) >= c.TTL
+}
+
+func (c *ColumnCache) read(path string) (*ColumnCacheEntry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read cached columns %v", path)
+	}
+	e := &ColumnCacheEntry{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse cached columns %v", path)
+	}
+	return e, nil
+}
+
+func (c *ColumnCache) path(environment string, dataset string) string {
+	return filepath.Join(c.Dir, environment+"_"+url.PathEscape(dataset)+".json")
+}
+
+// CachedColumnGetter fetches columns through a ColumnCache.
+type CachedColumnGetter struct {
+	Getter ColumnGetter
+	Cache  *ColumnCache
+	// Environment identifies the Honeycomb environment the getter fetches columns from.
+	Environment string
+	// Refresh bypasses the cache; the fetched columns are still stored in it.
+	Refresh bool
+}
+
+// NewCachedColumnGetter creates a getter that caches the columns fetched by the client as configured by cfg.
+func NewCachedColumnGetter(cfg config.Config, client *HoneycombClient, refresh bool) *CachedColumnGetter {
+	return &CachedColumnGetter{
+		Getter:      client,
+		Cache:       NewColumnCache(cfg),
+		Environment: client.Environment(),
+		Refresh:     refresh,
+	}
+}
+
+// GetColumns returns the cached columns of the dataset if they haven't expired otherwise it fetches and caches them.
+// Failures reading or writing the cache are logged and the columns are fetched from Honeycomb.
+func (g *CachedColumnGetter) GetColumns(datasetSlug string) ([]HoneycombColumn, error) {
+	log := zapr.NewLogger(zap.L())
+	now := time.Now()
+	if !g.Refresh && g.Cache.TTL > 0 {
+		columns, ok, err := g.Cache.Get(g.Environment, datasetSlug, now)
+		if err != nil {
+			log.Error(err, "Failed to read column cache", "dataset", datasetSlug)
+		}
+		if ok {
+			log.Info("Using cached columns", "dataset", datasetSlug, "count", len(columns))
+			return columns, nil
+		}
+	}
+
+	columns, err := g.Getter.GetColumns(datasetSlug)
+	if err != nil {
+		return nil, err
+	}
+	if g.Cache.TTL > 0 {
+		if err := g.Cache.Put(g.Environment, datasetSlug, columns, now); err != nil {
+			log.Error(err, "Failed to write column cache", "dataset", datasetSlug)
+		}
+	}
+	return columns, nil
+}
@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeColumnGetter returns canned columns and counts how often it is called.
+type fakeColumnGetter struct {
+	columns map[string][]HoneycombColumn
+	calls   int
+}
+
+func (f *fakeColumnGetter) GetColumns(dataset string) ([]HoneycombColumn, error) {
+	f.calls++
+	return f.columns[dataset], nil
+}
+
+func Test_ColumnCache(t *testing.T) {
+	cache := &ColumnCache{Dir: t.TempDir(), TTL: time.Hour}
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	columns := []HoneycombColumn{{KeyName: "name", Type: "string"}, {KeyName: "duration_ms", Type: "float"}}
+
+	if _, ok, err := cache.Get("env", "prod", now); ok || err != nil {
+		t.Fatalf("Expected a miss for an empty cache; got ok=%v err=%v", ok, err)
+	}
+
+	if err := cache.Put("env", "prod", columns, now); err != nil {
+		t.Fatalf("Failed to put columns; %v", err)
+	}
+	if err := cache.Put("other", "prod", columns[:1], now); err != nil {
+		t.Fatalf("Failed to put columns; %v", err)
+	}
+	if err := cache.Put("env", "a/b", columns[:1], now); err != nil {
+		t.Fatalf("Failed to put columns; %v", err)
+	}
+
+	actual, ok, err := cache.Get("env", "prod", now.Add(30*time.Minute))
+	if err != nil || !ok {
+		t.Fatalf("Expected a hit; got ok=%v err=%v", ok, err)
+	}
+	if d := cmp.Diff(columns, actual); d != "" {
+		t.Errorf("Unexpected columns;diff:\n%v", d)
+	}
+
+	if _, ok, _ := cache.Get("env", "prod", now.Add(time.Hour)); ok {
+		t.Errorf("Expected the entry to have expired")
+	}
+
+	entries, err := cache.List()
+	if err != nil {
+		t.Fatalf("Failed to list cache; %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 entries; got %d", len(entries))
+	}
+
+	// A corrupt entry shouldn't stop the cache being listed or cleared.
+	if err := os.WriteFile(filepath.Join(cache.Dir, "env_corrupt.json"), []byte("{"), 0600); err != nil {
+		t.Fatalf("Failed to write corrupt entry; %v", err)
+	}
+	entries, err = cache.List()
+	if err != nil {
+		t.Fatalf("Failed to list cache with a corrupt entry; %v", err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Expected the corrupt entry to be skipped; got %d entries", len(entries))
+	}
+
+	removed, err := cache.Clear("prod")
+	if err != nil {
+		t.Fatalf("Failed to clear cache; %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("Expected 2 entries to be removed; got %d", removed)
+	}
+	removed, err = cache.Clear("")
+	if err != nil || removed != 2 {
+		t.Errorf("Expected the remaining and corrupt entries to be removed; got %d, %v", removed, err)
+	}
+}
+
+func Test_CachedColumnGetter(t *testing.T) {
+	fake := &fakeColumnGetter{
+		columns: map[string][]HoneycombColumn{"prod": {{KeyName: "name"}}},
+	}
+	getter := &CachedColumnGetter{
+		Getter:      fake,
+		Cache:       &ColumnCache{Dir: t.TempDir(), TTL: time.Hour},
+		Environment: "env",
+	}
+
+	for i := 0; i < 2; i++ {
+		columns, err := getter.GetColumns("prod")
+		if err != nil {
+			t.Fatalf("Failed to get columns; %v", err)
+		}
+		if len(columns) != 1 {
+			t.Errorf("Unexpected columns %v", columns)
+		}
+	}
+	if fake.calls != 1 {
+		t.Errorf("Expected the second call to be served from the cache; got %d calls", fake.calls)
+	}
+
+	getter.Refresh = true
+	if _, err := getter.GetColumns("prod"); err != nil {
+		t.Fatalf("Failed to get columns; %v", err)
+	}
+	if fake.calls != 2 {
+		t.Errorf("Expected refresh to bypass the cache; got %d calls", fake.calls)
+	}
+
+	getter.Refresh = false
+	getter.Cache.TTL = 0
+	if _, err := getter.GetColumns("prod"); err != nil {
+		t.Fatalf("Failed to get columns; %v", err)
+	}
+	if fake.calls != 3 {
+		t.Errorf("Expected a disabled cache to be bypassed; got %d calls", fake.calls)
+	}
+}
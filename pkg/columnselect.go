@@ -0,0 +1,250 @@
+package pkg
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PromptColumn is the subset of a column's metadata sent to the translator.
+type PromptColumn struct {
+	KeyName     string `json:"key_name"`
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	// TopValues are the most common values of the column; see AddTopValues.
+	TopValues []string `json:"top_values,omitempty"`
+}
+
+// ColumnSelectionOptions controls which columns SelectColumns keeps.
+type ColumnSelectionOptions struct {
+	// MaxColumns is the maximum number of columns to keep. 0 means no limit.
+	MaxColumns int
+	// StaleAfter drops columns that haven't been written to for this long. 0 keeps stale columns.
+	StaleAfter time.Duration
+	// Now is the time staleness is computed from. Defaults to the current time.
+	Now time.Time
+	// Include are columns that are always selected ahead of the other columns even if they are hidden or stale.
+	Include []string
+}
+
+// ColumnSelection is the result of selecting columns.
+type ColumnSelection struct {
+	// Columns are the selected columns, most relevant first.
+	Columns []PromptColumn
+	// Hidden, Stale and Truncated are the names of the columns that were dropped and why.
+	Hidden    []string
+	Stale     []string
+	Truncated []string
+}
+
+// columnSynonyms maps words people use in questions to the words that appear in column names.
+var columnSynonyms = map[string][]string{
+	"latency":     {"duration", "ms", "time", "elapsed"},
+	"slow":        {"duration", "ms", "latency"},
+	"slowest":     {"duration", "ms", "latency"},
+	"fast":        {"duration", "ms", "latency"},
+	"duration":    {"latency", "ms", "elapsed"},
+	"time":        {"duration", "ms", "timestamp"},
+	"long":        {"duration", "ms"},
+	"error":       {"err", "exception", "status", "code", "fault", "failed"},
+	"fail":        {"error", "err", "exception", "status"},
+	"failure":     {"error", "err", "exception", "status"},
+	"exception":   {"error", "err", "exception"},
+	"status":      {"code", "status"},
+	"endpoint":    {"route", "path", "url", "target", "http", "name"},
+	"route":       {"route", "path", "url", "endpoint"},
+	"url":         {"url", "path", "route", "target"},
+	"request":     {"http", "request", "method", "route"},
+	"service":     {"service", "name"},
+	"operation":   {"name", "span", "operation"},
+	"span":        {"span", "name", "kind"},
+	"trace":       {"trace", "id", "parent"},
+	"user":        {"user", "customer", "account", "id"},
+	"customer":    {"customer", "user", "account", "team"},
+	"host":        {"host", "hostname", "instance", "node", "pod"},
+	"pod":         {"pod", "k8s", "container", "host"},
+	"memory":      {"memory", "mem", "heap", "rss", "bytes"},
+	"cpu":         {"cpu", "usage", "utilization"},
+	"size":        {"size", "bytes", "length"},
+	"database":    {"db", "sql", "query", "statement"},
+	"db":          {"db", "database", "sql", "statement"},
+	"region":      {"region", "zone", "cloud", "availability"},
+	"version":     {"version", "release", "build", "sha"},
+	"deploy":      {"version", "release", "build", "deploy"},
+	"count":       {"count", "num", "total"},
+	"method":      {"method", "http", "rpc"},
+	"environment": {"env", "environment", "deployment"},
+}
+
+// coreColumns are useful for most questions so they rank above other columns that don't match the question.
+var coreColumns = map[string]bool{
+	"name":           true,
+	"service.name":   true,
+	"duration_ms":    true,
+	"error":          true,
+	"trace.trace_id": true,
+}
+
+// questionStopWords are common words in questions that don't help find columns.
+var questionStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "for": true, "in": true, "on": true, "by": true, "to": true,
+	"and": true, "or": true, "is": true, "are": true, "was": true, "were": true, "what": true, "which": true,
+	"show": true, "me": true, "how": true, "many": true, "with": true, "from": true, "last": true, "over": true,
+	"per": true, "each": true, "all": true, "my": true, "that": true, "have": true, "has": true, "do": true,
+	"does": true, "at": true, "most": true, "top": true, "past": true, "hour": true, "hours": true, "day": true,
+	"days": true, "week": true, "weeks": true, "minutes": true, "today": true, "yesterday": true,
+}
+
+// SelectColumns chooses the columns of a dataset to send to the translator for the question.
+//
+// Hidden columns and columns that haven't been written to within opts.StaleAfter are dropped unless they are in
+// opts.Include. The remaining
+// columns are ranked by their relevance to the question using token overlap between the question and the
+// column's name and description; synonyms (e.g. latency matches duration_ms) count for less than exact matches.
+// Only the top opts.MaxColumns are kept.
+func SelectColumns(nlq string, columns []HoneycombColumn, opts ColumnSelectionOptions) ColumnSelection {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	words, related := questionTokens(nlq)
+	include := make(map[string]bool)
+	for _, c := range opts.Include {
+		include[c] = true
+	}
+
+	type scored struct {
+		column HoneycombColumn
+		score  int
+	}
+	candidates := make([]scored, 0, len(columns))
+	selection := ColumnSelection{
+		Columns:   make([]PromptColumn, 0, len(columns)),
+		Hidden:    make([]string, 0),
+		Stale:     make([]string, 0),
+		Truncated: make([]string, 0),
+	}
+	for _, c := range columns {
+		switch {
+		case include[c.KeyName]:
+			candidates = append(candidates, scored{column: c, score: includeScore})
+		case c.Hidden:
+			selection.Hidden = append(selection.Hidden, c.KeyName)
+		case opts.StaleAfter > 0 && !c.LastWritten.IsZero() && now.Sub(c.LastWritten) > opts.StaleAfter:
+			selection.Stale = append(selection.Stale, c.KeyName)
+		default:
+			candidates = append(candidates, scored{column: c, score: scoreColumn(c, words, related)})
+		}
+	}
+
+	// Ties are broken by how recently the column was written and then by name so the result is deterministic.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if !a.column.LastWritten.Equal(b.column.LastWritten) {
+			return a.column.LastWritten.After(b.column.LastWritten)
+		}
+		return a.column.KeyName < b.column.KeyName
+	})
+
+	for i, c := range candidates {
+		if opts.MaxColumns > 0 && i >= opts.MaxColumns && c.score != includeScore {
+			selection.Truncated = append(selection.Truncated, c.column.KeyName)
+			continue
+		}
+		selection.Columns = append(selection.Columns, PromptColumn{
+			KeyName:     c.column.KeyName,
+			Type:        c.column.Type,
+			Description: c.column.Description,
+		})
+	}
+	return selection
+}
+
+// includeScore is the score of included columns; it is higher than any score computed by scoreColumn.
+const includeScore = math.MaxInt32
+
+// scoreColumn scores the relevance of a column to a question.
+func scoreColumn(c HoneycombColumn, words map[string]bool, related map[string]bool) int {
+	score := 0
+	if coreColumns[c.KeyName] {
+		score++
+	}
+	for _, t := range splitIdentifier(c.KeyName) {
+		switch {
+		case words[t]:
+			score += 6
+		case related[t]:
+			score += 3
+		}
+	}
+	for _, t := range tokenize(c.Description) {
+		if words[t] {
+			score += 2
+		}
+	}
+	return score
+}
+
+// questionTokens returns the significant words of the question and the words related to them by synonyms.
+func questionTokens(nlq string) (map[string]bool, map[string]bool) {
+	words := make(map[string]bool)
+	related := make(map[string]bool)
+	for _, f := range splitWords(nlq) {
+		if questionStopWords[f] {
+			continue
+		}
+		t := stem(f)
+		words[t] = true
+		for _, s := range columnSynonyms[t] {
+			// Synonyms are tokenized so they are stemmed the same way as column names.
+			for _, r := range tokenize(s) {
+				related[r] = true
+			}
+		}
+	}
+	return words, related
+}
+
+// splitIdentifier splits a column name such as http.status_code or requestSize into lower case words.
+func splitIdentifier(name string) []string {
+	var b strings.Builder
+	prev := rune(0)
+	for _, r := range name {
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return tokenize(b.String())
+}
+
+// tokenize splits text into lower case words and stems them so plurals match.
+func tokenize(s string) []string {
+	fields := splitWords(s)
+	for i, f := range fields {
+		fields[i] = stem(f)
+	}
+	return fields
+}
+
+// splitWords splits text into lower case words.
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// stem strips a trailing s from plurals e.g. errors becomes error but status is unchanged.
+func stem(w string) string {
+	if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") && !strings.HasSuffix(w, "us") {
+		return strings.TrimSuffix(w, "s")
+	}
+	return w
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_SelectColumns(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	recent := now.Add(-time.Hour)
+	columns := []HoneycombColumn{
+		{KeyName: "app.cart_size", Type: "integer", LastWritten: recent},
+		{KeyName: "duration_ms", Type: "float", LastWritten: recent},
+		{KeyName: "http.route", Type: "string", LastWritten: recent},
+		{KeyName: "http.status_code", Type: "integer", LastWritten: recent},
+		{KeyName: "internal.debug", Type: "string", Hidden: true, LastWritten: recent},
+		{KeyName: "legacy.region", Type: "string", LastWritten: now.Add(-90 * 24 * time.Hour)},
+		{KeyName: "name", Type: "string", LastWritten: recent},
+		{KeyName: "k8s.pod.name", Type: "string", Description: "pod the request was served by", LastWritten: recent},
+		{KeyName: "service.name", Type: "string", LastWritten: recent},
+	}
+
+	type testCase struct {
+		name      string
+		nlq       string
+		max       int
+		expected  []string
+		truncated []string
+	}
+
+	cases := []testCase{
+		{
+			name:      "latency-by-route",
+			nlq:       "What are the slowest endpoints?",
+			max:       3,
+			expected:  []string{"duration_ms", "http.route", "name"},
+			truncated: []string{"service.name", "http.status_code", "k8s.pod.name", "app.cart_size"},
+		},
+		{
+			name:      "errors-by-pod",
+			nlq:       "How many errors per pod",
+			max:       2,
+			expected:  []string{"k8s.pod.name", "http.status_code"},
+			truncated: []string{"duration_ms", "name", "service.name", "app.cart_size", "http.route"},
+		},
+		{
+			name:     "no-limit",
+			nlq:      "cart sizes",
+			expected: []string{"app.cart_size", "duration_ms", "name", "service.name", "http.route", "http.status_code", "k8s.pod.name"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			selection := SelectColumns(c.nlq, columns, ColumnSelectionOptions{
+				MaxColumns: c.max,
+				StaleAfter: 30 * 24 * time.Hour,
+				Now:        now,
+			})
+			names := make([]string, 0, len(selection.Columns))
+			for _, col := range selection.Columns {
+				names = append(names, col.KeyName)
+			}
+			if d := cmp.Diff(c.expected, names); d != "" {
+				t.Errorf("Unexpected columns;diff:\n%v", d)
+			}
+			if d := cmp.Diff([]string{"internal.debug"}, selection.Hidden); d != "" {
+				t.Errorf("Unexpected hidden columns;diff:\n%v", d)
+			}
+			if d := cmp.Diff([]string{"legacy.region"}, selection.Stale); d != "" {
+				t.Errorf("Unexpected stale columns;diff:\n%v", d)
+			}
+			if c.truncated == nil {
+				c.truncated = []string{}
+			}
+			if d := cmp.Diff(c.truncated, selection.Truncated); d != "" {
+				t.Errorf("Unexpected truncated columns;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_SelectColumnsInclude(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	columns := []HoneycombColumn{
+		{KeyName: "duration_ms", Type: "float", LastWritten: now},
+		{KeyName: "http.route", Type: "string", LastWritten: now},
+		{KeyName: "internal.debug", Type: "string", Hidden: true, LastWritten: now},
+		{KeyName: "legacy.region", Type: "string", LastWritten: now.Add(-90 * 24 * time.Hour)},
+	}
+
+	selection := SelectColumns("slowest routes", columns, ColumnSelectionOptions{
+		MaxColumns: 2,
+		StaleAfter: 30 * 24 * time.Hour,
+		Now:        now,
+		Include:    []string{"legacy.region", "internal.debug"},
+	})
+	names := make([]string, 0, len(selection.Columns))
+	for _, col := range selection.Columns {
+		names = append(names, col.KeyName)
+	}
+	expected := []string{"internal.debug", "legacy.region"}
+	if d := cmp.Diff(expected, names); d != "" {
+		t.Errorf("Unexpected columns;diff:\n%v", d)
+	}
+	if d := cmp.Diff([]string{"duration_ms", "http.route"}, selection.Truncated); d != "" {
+		t.Errorf("Unexpected truncated columns;diff:\n%v", d)
+	}
+}
@@ -1,18 +1,24 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io/fs"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg/secrets"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,10 +27,39 @@ import (
 // to the Configuration struct which is what we pass around in the application.
 
 const (
-	ConfigFlagName  = "config"
-	LevelFlagName   = "level"
-	ConfigDir       = ".hccli"
-	BaseURLFlagName = "base-url"
+	ConfigFlagName   = "config"
+	LevelFlagName    = "level"
+	ConfigDir        = ".hccli"
+	BaseURLFlagName  = "base-url"
+	ProfileFlagName  = "profile"
+	JSONLogsFlagName = "json-logs"
+	OutputFlagName   = "output"
+	TemplatesDir     = "templates"
+	QueriesDir       = "queries"
+	HistoryDir       = "history"
+	ShellHistoryFile = "shell_history"
+	CacheDir         = "cache"
+	// BackupSuffix is appended to the name of the config file to get the name of the backup made by Write.
+	BackupSuffix = ".bak"
+
+	// LogFormatJSON and LogFormatConsole are the supported values of logging.format.
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+	// DefaultLogMaxSizeMB is the size at which the log file is rotated if it isn't configured.
+	DefaultLogMaxSizeMB = 10
+	// DefaultLogMaxBackups is the number of rotated log files kept if it isn't configured.
+	DefaultLogMaxBackups = 3
+
+	// DefaultColumnCacheTTL is how long columns are cached if the TTL isn't configured.
+	DefaultColumnCacheTTL = time.Hour
+	// DefaultMaxColumns is the maximum number of columns sent to the translator if it isn't configured.
+	DefaultMaxColumns = 100
+	// DefaultSampleValues is the number of values sampled for each column if it isn't configured.
+	DefaultSampleValues = 5
+	// DefaultSampleColumns is the number of columns whose values are sampled if it isn't configured.
+	DefaultSampleColumns = 10
+	// DefaultStaleAfter is how long a column can go without being written before it is dropped.
+	DefaultStaleAfter = 30 * 24 * time.Hour
 )
 
 // Config is the configuration data that gets persisted for kubedr.
@@ -36,32 +71,104 @@ type Config struct {
 	APIVersion string `json:"apiVersion" yaml:"apiVersion" yamltags:"required"`
 	Kind       string `json:"kind" yaml:"kind" yamltags:"required"`
 
-	// AIEndpoint is the endpoint of the model that turns natural language into queries
-	AIEndpoint string `json:"aiEndpoint" yaml:"aiEndpoint"`
+	// Translator configures the model that turns natural language into queries
+	Translator *TranslatorConfig `json:"translator,omitempty" yaml:"translator,omitempty"`
 
-	// Replicate is the configuration when using a model deployed on replicate
-	Replicate *ReplicateConfig `json:"replicate" yaml:"replicate"`
-
-	// HoneycombAPIKeyFile contains the URI of the APIKey for HoneyComb
+	// HoneycombAPIKeyFile is a reference to the APIKey for HoneyComb e.g. a file path or env://HONEYCOMB_API_KEY.
+	// See package secrets for the supported references.
 	HoneycombAPIKeyFile string `json:"honeycombAPIKeyFile" yaml:"honeycombAPIKeyFile"`
 
 	Logging Logging `json:"logging" yaml:"logging"`
 
+	// ColumnSelection configures how columns are chosen to send to the translator.
+	ColumnSelection *ColumnSelectionConfig `json:"columnSelection,omitempty" yaml:"columnSelection,omitempty"`
+
+	// ValueSampling configures sampling the values of columns to include in the translator's input.
+	ValueSampling *ValueSamplingConfig `json:"valueSampling,omitempty" yaml:"valueSampling,omitempty"`
+
+	// ColumnCache configures the on disk cache of dataset columns.
+	ColumnCache *ColumnCacheConfig `json:"columnCache,omitempty" yaml:"columnCache,omitempty"`
+
 	// BaseURL is the base URL in the Honeycomb UI for your environment.
 	// This is used to construct URLs to Honeycomb queries.
 	BaseURL string `json:"baseURL" yaml:"baseURL"`
+
+	// CurrentProfile is the profile used when the --profile flag isn't specified.
+	CurrentProfile string `json:"currentProfile,omitempty" yaml:"currentProfile,omitempty"`
+
+	// Profiles are named sets of overrides e.g. one per Honeycomb environment. A profile can override any field of
+	// the configuration; nested fields are merged with the top level configuration.
+	Profiles map[string]map[string]interface{} `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+}
+
+type TranslatorConfig struct {
+	// Endpoint is the URL of the model server that turns natural language into queries
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	// Replicate is the configuration when using a model deployed on replicate; it takes precedence over Endpoint.
+	Replicate *ReplicateConfig `json:"replicate,omitempty" yaml:"replicate,omitempty"`
+	// Chat is the configuration when using a chat model with an OpenAI compatible chat completions API.
+	// It takes precedence over Endpoint but not Replicate. Chat models can also refine earlier queries.
+	Chat *ChatConfig `json:"chat,omitempty" yaml:"chat,omitempty"`
+}
+
+type ChatConfig struct {
+	// BaseURL is the URL of the API e.g. https://api.openai.com/v1; requests are sent to BaseURL/chat/completions.
+	BaseURL string `json:"baseURL" yaml:"baseURL"`
+	// Model is the name of the model e.g. gpt-4o.
+	Model string `json:"model" yaml:"model"`
+	// APIKeyFile is a reference to the API key e.g. a file path or env://OPENAI_API_KEY.
+	// It can be left empty for servers that don't require a key.
+	APIKeyFile string `json:"apiKeyFile,omitempty" yaml:"apiKeyFile,omitempty"`
 }
 
 type ReplicateConfig struct {
-	// APITokenFile is the file containing our APIToken
+	// APITokenFile is a reference to our APIToken e.g. a file path or env://REPLICATE_API_TOKEN.
 	APITokenFile string `json:"apiTokenFile" yaml:"apiTokenFile"`
 	// Model identifier.
 	// Should be owner/name or owner/name:version
 	Model string `json:"model" yaml:"model"`
 }
 
+type ColumnSelectionConfig struct {
+	// MaxColumns is the maximum number of columns sent to the translator. Defaults to 100.
+	MaxColumns int `json:"maxColumns,omitempty" yaml:"maxColumns,omitempty"`
+	// StaleAfter drops columns that haven't been written to for this long e.g. 720h. Defaults to 30 days.
+	StaleAfter string `json:"staleAfter,omitempty" yaml:"staleAfter,omitempty"`
+	// Include are columns that are always sent to the translator e.g. columns specific to your services.
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+}
+
+type ValueSamplingConfig struct {
+	// Enabled turns on sampling values using Honeycomb's Query Data API.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// EventsFile is a file of JSON events to sample values from instead of using the Query Data API.
+	EventsFile string `json:"eventsFile,omitempty" yaml:"eventsFile,omitempty"`
+	// MaxValues is the number of values to include for each column. Defaults to 5.
+	MaxValues int `json:"maxValues,omitempty" yaml:"maxValues,omitempty"`
+	// MaxColumns is the number of string columns to sample. Defaults to 10.
+	MaxColumns int `json:"maxColumns,omitempty" yaml:"maxColumns,omitempty"`
+}
+
+type ColumnCacheConfig struct {
+	// TTL is how long cached columns are used before they are fetched again e.g. 1h. Defaults to 1h.
+	TTL string `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	// Disabled turns off the cache so columns are always fetched from Honeycomb.
+	Disabled bool `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+}
+
 type Logging struct {
 	Level string `json:"level" yaml:"level"`
+	// Format is json or console. Defaults to console.
+	Format string `json:"format,omitempty" yaml:"format,omitempty"`
+	// File is a file to write logs to instead of stderr. It is rotated when it reaches MaxSizeMB.
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	// MaxSizeMB is the size at which the log file is rotated. Defaults to 10.
+	MaxSizeMB int `json:"maxSizeMB,omitempty" yaml:"maxSizeMB,omitempty"`
+	// MaxBackups is the number of rotated log files to keep. Defaults to 3.
+	MaxBackups int `json:"maxBackups,omitempty" yaml:"maxBackups,omitempty"`
+	// Levels overrides the level for packages e.g. {"pkg/config": "debug"}. Packages are matched by the suffix of
+	// their import path.
+	Levels map[string]string `json:"levels,omitempty" yaml:"levels,omitempty"`
 }
 
 func (c *Config) GetLogLevel() string {
@@ -71,18 +178,268 @@ func (c *Config) GetLogLevel() string {
 	return c.Logging.Level
 }
 
+// GetTranslator returns the translator configuration; it is empty if the translator isn't configured.
+func (c *Config) GetTranslator() TranslatorConfig {
+	if c.Translator == nil {
+		return TranslatorConfig{}
+	}
+	return *c.Translator
+}
+
+// GetLogFormat returns the format of the logs; json or console.
+func (c *Config) GetLogFormat() string {
+	if c.Logging.Format == "" {
+		return LogFormatConsole
+	}
+	return strings.ToLower(c.Logging.Format)
+}
+
+// GetLogMaxSizeMB returns the size in MB at which the log file is rotated.
+func (c *Config) GetLogMaxSizeMB() int {
+	if c.Logging.MaxSizeMB <= 0 {
+		return DefaultLogMaxSizeMB
+	}
+	return c.Logging.MaxSizeMB
+}
+
+// GetLogMaxBackups returns the number of rotated log files to keep.
+func (c *Config) GetLogMaxBackups() int {
+	if c.Logging.MaxBackups <= 0 {
+		return DefaultLogMaxBackups
+	}
+	return c.Logging.MaxBackups
+}
+
 // GetConfigDir returns the configuration directory
 func (c *Config) GetConfigDir() string {
+	if viper.ConfigFileUsed() == "" {
+		return binHome()
+	}
 	return filepath.Dir(viper.ConfigFileUsed())
 }
 
-// IsValid returns any errors with the configuration. The return is a list of configuration problems
+// GetQueriesDir returns the directory containing the saved query library.
+func (c *Config) GetQueriesDir() string {
+	return filepath.Join(c.GetConfigDir(), QueriesDir)
+}
+
+// GetCacheDir returns the directory containing cached data e.g. columns.
+func (c *Config) GetCacheDir() string {
+	return filepath.Join(c.GetConfigDir(), CacheDir)
+}
+
+// GetColumnCacheTTL returns how long cached columns are valid. It returns 0 if the cache is disabled.
+func (c *Config) GetColumnCacheTTL() time.Duration {
+	if c.ColumnCache == nil {
+		return DefaultColumnCacheTTL
+	}
+	if c.ColumnCache.Disabled {
+		return 0
+	}
+	if c.ColumnCache.TTL == "" {
+		return DefaultColumnCacheTTL
+	}
+	ttl, err := time.ParseDuration(c.ColumnCache.TTL)
+	if err != nil {
+		return DefaultColumnCacheTTL
+	}
+	return ttl
+}
+
+// GetMaxColumns returns the maximum number of columns sent to the translator.
+func (c *Config) GetMaxColumns() int {
+	if c.ColumnSelection == nil || c.ColumnSelection.MaxColumns <= 0 {
+		return DefaultMaxColumns
+	}
+	return c.ColumnSelection.MaxColumns
+}
+
+// GetStaleAfter returns how long a column can go without being written before it is considered stale.
+func (c *Config) GetStaleAfter() time.Duration {
+	if c.ColumnSelection == nil || c.ColumnSelection.StaleAfter == "" {
+		return DefaultStaleAfter
+	}
+	d, err := time.ParseDuration(c.ColumnSelection.StaleAfter)
+	if err != nil {
+		return DefaultStaleAfter
+	}
+	return d
+}
+
+// GetIncludedColumns returns the columns that are always sent to the translator.
+func (c *Config) GetIncludedColumns() []string {
+	if c.ColumnSelection == nil {
+		return []string{}
+	}
+	return c.ColumnSelection.Include
+}
+
+// GetValueSampling returns the value sampling configuration with defaults filled in.
+func (c *Config) GetValueSampling() ValueSamplingConfig {
+	v := ValueSamplingConfig{}
+	if c.ValueSampling != nil {
+		v = *c.ValueSampling
+	}
+	if v.MaxValues <= 0 {
+		v.MaxValues = DefaultSampleValues
+	}
+	if v.MaxColumns <= 0 {
+		v.MaxColumns = DefaultSampleColumns
+	}
+	return v
+}
+
+// GetHistoryDir returns the directory containing the translation history.
+func (c *Config) GetHistoryDir() string {
+	return filepath.Join(c.GetConfigDir(), HistoryDir)
+}
+
+// GetShellHistoryFile returns the file containing the lines entered in hccli shell.
+func (c *Config) GetShellHistoryFile() string {
+	return filepath.Join(c.GetConfigDir(), ShellHistoryFile)
+}
+
+// GetTemplatesDir returns the directory containing query templates.
+func (c *Config) GetTemplatesDir() string {
+	return filepath.Join(c.GetConfigDir(), TemplatesDir)
+}
+
+// replicateModelRegex matches Replicate model identifiers i.e. owner/name or owner/name:version.
+var replicateModelRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*/[A-Za-z0-9][A-Za-z0-9._-]*(:[A-Za-z0-9]+)?$`)
+
+// IsValid returns any errors with the configuration. The return is a list of configuration problems.
+// Only the structure of the configuration is checked e.g. malformed URLs; files it refers to are checked by
+// CheckFiles since most commands only use some of them.
 func (c *Config) IsValid() []string {
 	problems := make([]string, 0, 1)
-	// N.B. We no longer check for a HoneycombAPIKeyFile because it isn't needed if using the URL functionality.
+	if c.APIVersion != "" && c.APIVersion != APIVersion {
+		problems = append(problems, fmt.Sprintf("apiVersion %q should be %q", c.APIVersion, APIVersion))
+	}
+	if c.Kind != "" && c.Kind != ConfigKind {
+		problems = append(problems, fmt.Sprintf("kind %q should be %q", c.Kind, ConfigKind))
+	}
+	translator := c.GetTranslator()
+	if translator.Endpoint != "" {
+		if p := checkURL("translator.endpoint", translator.Endpoint); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	if c.BaseURL != "" {
+		if p := checkURL("baseURL", c.BaseURL); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	if r := translator.Replicate; r != nil {
+		if !replicateModelRegex.MatchString(r.Model) {
+			problems = append(problems, fmt.Sprintf("translator.replicate.model %q should be owner/name or owner/name:version", r.Model))
+		}
+		if r.APITokenFile == "" {
+			problems = append(problems, "translator.replicate.apiTokenFile must be set to use Replicate")
+		}
+	}
+	if ch := translator.Chat; ch != nil {
+		if ch.BaseURL == "" {
+			problems = append(problems, "translator.chat.baseURL must be set to use a chat model")
+		} else if p := checkURL("translator.chat.baseURL", ch.BaseURL); p != "" {
+			problems = append(problems, p)
+		}
+		if ch.Model == "" {
+			problems = append(problems, "translator.chat.model must be set to use a chat model")
+		}
+	}
+	if c.Logging.Level != "" {
+		if _, err := zapcore.ParseLevel(c.Logging.Level); err != nil {
+			problems = append(problems, fmt.Sprintf("logging.level %q isn't a valid level; use debug, info, warn or error", c.Logging.Level))
+		}
+	}
+	if f := c.GetLogFormat(); f != LogFormatJSON && f != LogFormatConsole {
+		problems = append(problems, fmt.Sprintf("logging.format %q should be json or console", c.Logging.Format))
+	}
+	for pkg, level := range c.Logging.Levels {
+		if _, err := zapcore.ParseLevel(level); err != nil {
+			problems = append(problems, fmt.Sprintf("logging.levels.%s %q isn't a valid level; use debug, info, warn or error", pkg, level))
+		}
+	}
+	if c.CurrentProfile != "" {
+		if _, ok := c.Profiles[strings.ToLower(c.CurrentProfile)]; !ok {
+			problems = append(problems, fmt.Sprintf("currentProfile %q isn't one of the profiles", c.CurrentProfile))
+		}
+	}
+	if c.ColumnCache != nil && c.ColumnCache.TTL != "" {
+		if _, err := time.ParseDuration(c.ColumnCache.TTL); err != nil {
+			problems = append(problems, fmt.Sprintf("columnCache.ttl %q isn't a valid duration e.g. 1h", c.ColumnCache.TTL))
+		}
+	}
+	if c.ColumnSelection != nil && c.ColumnSelection.StaleAfter != "" {
+		if _, err := time.ParseDuration(c.ColumnSelection.StaleAfter); err != nil {
+			problems = append(problems, fmt.Sprintf("columnSelection.staleAfter %q isn't a valid duration e.g. 720h", c.ColumnSelection.StaleAfter))
+		}
+	}
 	return problems
 }
 
+// CheckFiles returns a problem for each file the configuration refers to that can't be read e.g. an API key file.
+// The files are only needed by the commands that use them so this is checked by hccli doctor rather than when
+// the configuration is loaded; commands report a missing file when they read it.
+func (c *Config) CheckFiles() []string {
+	problems := make([]string, 0)
+	// N.B. We no longer require a HoneycombAPIKeyFile because it isn't needed if using the URL functionality.
+	if c.HoneycombAPIKeyFile != "" {
+		if p := checkSecretFile("honeycombAPIKeyFile", c.HoneycombAPIKeyFile); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	translator := c.GetTranslator()
+	if r := translator.Replicate; r != nil && r.APITokenFile != "" {
+		if p := checkSecretFile("translator.replicate.apiTokenFile", r.APITokenFile); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	if ch := translator.Chat; ch != nil && ch.APIKeyFile != "" {
+		if p := checkSecretFile("translator.chat.apiKeyFile", ch.APIKeyFile); p != "" {
+			problems = append(problems, p)
+		}
+	}
+	if c.ValueSampling != nil && c.ValueSampling.EventsFile != "" {
+		if _, err := os.Stat(c.ValueSampling.EventsFile); err != nil {
+			problems = append(problems, fmt.Sprintf("valueSampling.eventsFile %q can't be read; %v", c.ValueSampling.EventsFile, err))
+		}
+	}
+	return problems
+}
+
+// checkURL returns a problem if value isn't an http or https URL.
+func checkURL(key string, value string) string {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Sprintf("%s %q should be an http or https URL", key, value)
+	}
+	return ""
+}
+
+// checkSecretFile returns a problem if the secret reference is a local file that can't be read.
+// Other references e.g. environment variables are only checked when they are resolved.
+func checkSecretFile(key string, ref string) string {
+	scheme, path := secrets.SplitReference(ref)
+	if scheme != secrets.FileScheme {
+		return ""
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("%s %q can't be read; %v", key, ref, err)
+	}
+	f.Close()
+	return ""
+}
+
+// keyToFlagName maps configuration keys to the command line flags that override them.
+var keyToFlagName = map[string]string{
+	ConfigFlagName:             ConfigFlagName,
+	"logging." + LevelFlagName: LevelFlagName,
+	ProfileFlagName:            ProfileFlagName,
+	"baseURL":                  BaseURLFlagName,
+}
+
 // InitViper reads in config file and ENV variables if set.
 // The results are stored inside viper. Call GetConfig to get a configuration.
 // The cmd is passed in so we can bind to command flags
@@ -100,19 +457,26 @@ func InitViper(cmd *cobra.Command) error {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// Bind to the command line flag if it was specified.
-	keyToflagName := map[string]string{
-		ConfigFlagName:             ConfigFlagName,
-		"logging." + LevelFlagName: LevelFlagName,
-	}
-
 	if cmd != nil {
-		for key, flag := range keyToflagName {
-			if err := viper.BindPFlag(key, cmd.Flags().Lookup(flag)); err != nil {
+		for key, flag := range keyToFlagName {
+			f := cmd.Flags().Lookup(flag)
+			if f == nil {
+				// Not every command defines every flag e.g. only querytourl has --base-url.
+				continue
+			}
+			if err := viper.BindPFlag(key, f); err != nil {
 				return err
 			}
 		}
 	}
 
+	// --json-logs is a shorthand for logging.format=json.
+	if cmd != nil {
+		if f := cmd.Flags().Lookup(JSONLogsFlagName); f != nil && f.Changed && f.Value.String() == "true" {
+			viper.Set("logging.format", LogFormatJSON)
+		}
+	}
+
 	// We want to make sure the config file path gets set.
 	// This is because we use viper to persist the location of the config file so can save to it.
 	cfgFile := viper.GetString(ConfigFlagName)
@@ -137,10 +501,65 @@ func InitViper(cmd *cobra.Command) error {
 		}
 		return err
 	}
-	return nil
+	return migrateConfig()
+}
+
+// migrateConfig upgrades the configuration file read by viper if it is an older version and reads it again.
+// Logging isn't configured yet so the changes are printed to stderr.
+func migrateConfig() error {
+	if kind := viper.GetString("kind"); kind != "" && kind != ConfigKind {
+		return errors.Errorf("Config file %v has kind %v; expected %v", viper.ConfigFileUsed(), kind, ConfigKind)
+	}
+	if viper.GetString("apiVersion") == APIVersion {
+		return nil
+	}
+	cfgFile := viper.ConfigFileUsed()
+	changes, backup, err := MigrateFile(cfgFile)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Migrated %v to apiVersion %v; the previous file was saved to %v\n", cfgFile, APIVersion, backup)
+	for _, c := range changes {
+		fmt.Fprintf(os.Stderr, "  - %v\n", c)
+	}
+	return viper.ReadInConfig()
+}
+
+// ApplyProfile merges the overrides of the active profile into the configuration read by InitViper.
+// The overrides are merged into viper's config layer so flags and environment variables still take precedence.
+func ApplyProfile() error {
+	name := ActiveProfile()
+	if name == "" {
+		return nil
+	}
+	profiles := viper.GetStringMap("profiles")
+	overrides, ok := profiles[strings.ToLower(name)]
+	if !ok {
+		return errors.Errorf("Profile %v isn't defined in the configuration", name)
+	}
+	m, ok := overrides.(map[string]interface{})
+	if !ok {
+		if overrides == nil {
+			return nil
+		}
+		return errors.Errorf("Profile %v should be a map of configuration fields to override", name)
+	}
+	log := zapr.NewLogger(zap.L())
+	log.V(1).Info("Using profile", "profile", name)
+	return viper.MergeConfigMap(m)
+}
+
+// ActiveProfile returns the name of the profile in use; the --profile flag takes precedence over currentProfile.
+// It returns an empty string if no profile is in use.
+func ActiveProfile() string {
+	if p := viper.GetString(ProfileFlagName); p != "" {
+		return p
+	}
+	return viper.GetString("currentProfile")
 }
 
 // GetConfig returns the configuration instantiated from the viper configuration.
+// Call ApplyProfile first to apply the overrides of the active profile; use ReadConfigFile to modify the file.
 func GetConfig() *Config {
 	// N.B. THis is a bit of a hacky way to load the configuration while allowing values to be overwritten by viper
 	cfg := &Config{}
@@ -152,6 +571,38 @@ func GetConfig() *Config {
 	return cfg
 }
 
+// ReadConfigFile reads the configuration file without applying profiles, flags or environment variables.
+// It is used by commands that modify the file so overrides don't end up persisted in it.
+// A missing file is treated as an empty configuration.
+func ReadConfigFile(cfgFile string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigFile(cfgFile)
+	if _, err := os.Stat(cfgFile); os.IsNotExist(err) {
+		return v, nil
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to read config file %v", cfgFile)
+	}
+	return v, nil
+}
+
+// FromViper returns the configuration stored in v.
+func FromViper(v *viper.Viper) (*Config, error) {
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal configuration")
+	}
+	return cfg, nil
+}
+
+// ConfigFile returns the path of the configuration file in use or the default if there isn't one.
+func ConfigFile() string {
+	if f := viper.ConfigFileUsed(); f != "" {
+		return f
+	}
+	return DefaultConfigFile()
+}
+
 func binHome() string {
 	log := zapr.NewLogger(zap.L())
 	usr, err := user.Current()
@@ -167,8 +618,22 @@ func binHome() string {
 	return p
 }
 
-// Write writes the configuration to the specified file.
+// Write writes the configuration to the specified file. apiVersion and kind are set to the current version.
+// If the file already exists it is first copied to a backup file with the suffix .bak.
 func (c *Config) Write(cfgFile string) error {
+	c.APIVersion = APIVersion
+	c.Kind = ConfigKind
+
+	var b bytes.Buffer
+	if err := yaml.NewEncoder(&b).Encode(c); err != nil {
+		return errors.Wrapf(err, "Failed to write config file %s", cfgFile)
+	}
+	return WriteFile(cfgFile, b.Bytes())
+}
+
+// WriteFile writes data to the configuration file creating its directory if needed.
+// The previous file is saved with BackupSuffix.
+func WriteFile(cfgFile string, data []byte) error {
 	log := zapr.NewLogger(zap.L())
 	if cfgFile == "" {
 		return errors.Errorf("No config file specified")
@@ -176,17 +641,24 @@ func (c *Config) Write(cfgFile string) error {
 	configDir := filepath.Dir(cfgFile)
 	if _, err := os.Stat(configDir); os.IsNotExist(err) {
 		log.Info("Creating config directory", "dir", configDir)
-		if err := os.Mkdir(configDir, 0700); err != nil {
+		if err := os.MkdirAll(configDir, 0700); err != nil {
 			return errors.Wrapf(err, "Failed to create config directory %s", configDir)
 		}
 	}
 
-	f, err := os.Create(cfgFile)
-	if err != nil {
-		return err
+	if previous, err := os.ReadFile(cfgFile); err == nil {
+		backup := cfgFile + BackupSuffix
+		if err := os.WriteFile(backup, previous, 0600); err != nil {
+			return errors.Wrapf(err, "Failed to back up config file to %s", backup)
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrapf(err, "Failed to read config file %s", cfgFile)
 	}
 
-	return yaml.NewEncoder(f).Encode(c)
+	if err := os.WriteFile(cfgFile, data, 0600); err != nil {
+		return errors.Wrapf(err, "Failed to write config file %s", cfgFile)
+	}
+	return nil
 }
 
 func DefaultConfigFile() string {
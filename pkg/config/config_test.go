@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func Test_ApplyProfile(t *testing.T) {
+	type testCase struct {
+		name            string
+		profile         string
+		expectedBaseURL string
+		expectedModel   string
+		expectedToken   string
+	}
+
+	contents := `
+baseURL: https://ui.honeycomb.io/team/environments/prod
+replicate:
+  model: owner/model
+  apiTokenFile: /prod/token
+currentProfile: staging
+profiles:
+  staging:
+    baseURL: https://ui.honeycomb.io/team/environments/staging
+    replicate:
+      apiTokenFile: /staging/token
+  dev:
+    baseURL: https://ui.honeycomb.io/team/environments/dev
+`
+	cfgFile := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(cfgFile, []byte(contents), 0600); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+
+	cases := []testCase{
+		{
+			name:            "current-profile",
+			expectedBaseURL: "https://ui.honeycomb.io/team/environments/staging",
+			expectedModel:   "owner/model",
+			expectedToken:   "/staging/token",
+		},
+		{
+			name:            "flag",
+			profile:         "dev",
+			expectedBaseURL: "https://ui.honeycomb.io/team/environments/dev",
+			expectedModel:   "owner/model",
+			expectedToken:   "/prod/token",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			viper.Set(ConfigFlagName, cfgFile)
+			if c.profile != "" {
+				viper.Set(ProfileFlagName, c.profile)
+			}
+			if err := InitViper(nil); err != nil {
+				t.Fatalf("Failed to initialize viper; %v", err)
+			}
+			if err := ApplyProfile(); err != nil {
+				t.Fatalf("Failed to apply profile; %v", err)
+			}
+			cfg := GetConfig()
+			if cfg.BaseURL != c.expectedBaseURL {
+				t.Errorf("Unexpected baseURL; got %v want %v", cfg.BaseURL, c.expectedBaseURL)
+			}
+			r := cfg.GetTranslator().Replicate
+			if r == nil {
+				t.Fatalf("Replicate config is missing")
+			}
+			if r.Model != c.expectedModel {
+				t.Errorf("Unexpected model; got %v want %v", r.Model, c.expectedModel)
+			}
+			if r.APITokenFile != c.expectedToken {
+				t.Errorf("Unexpected apiTokenFile; got %v want %v", r.APITokenFile, c.expectedToken)
+			}
+		})
+	}
+}
+
+func Test_ApplyProfileMissing(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set(ProfileFlagName, "missing")
+	if err := ApplyProfile(); err == nil {
+		t.Errorf("Expected an error for a profile that isn't defined")
+	}
+}
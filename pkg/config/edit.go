@@ -0,0 +1,270 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of configuration values reported by KeySource.
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceProfile = "profile"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+// SetValue sets key to value in v.
+// Values that are YAML lists or maps e.g. [a, b] or {maxColumns: 50} are stored as structures; other values are
+// stored as strings and converted to the type of the field when the configuration is unmarshaled.
+// If appendValue is true the value is appended to the list at key; a list value appends each of its items.
+func SetValue(v *viper.Viper, key string, value string, appendValue bool) error {
+	parsed := parseValue(value)
+	if !appendValue {
+		v.Set(key, parsed)
+		return nil
+	}
+
+	var list []interface{}
+	switch current := v.Get(key).(type) {
+	case nil:
+		list = []interface{}{}
+	case []interface{}:
+		list = current
+	case []string:
+		for _, c := range current {
+			list = append(list, c)
+		}
+	default:
+		return errors.Errorf("Can't append to %v because it isn't a list", key)
+	}
+	if items, ok := parsed.([]interface{}); ok {
+		list = append(list, items...)
+	} else {
+		list = append(list, parsed)
+	}
+	v.Set(key, list)
+	return nil
+}
+
+// parseValue parses value as YAML if it is a list or map otherwise it returns the value unchanged.
+func parseValue(value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "[") && !strings.HasPrefix(trimmed, "{") {
+		return value
+	}
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(trimmed), &parsed); err != nil {
+		return value
+	}
+	return parsed
+}
+
+// UnsetValue returns a copy of v without key. Viper doesn't support deleting keys so a new instance is created.
+func UnsetValue(v *viper.Viper, key string) (*viper.Viper, error) {
+	settings := v.AllSettings()
+	parts := strings.Split(strings.ToLower(key), ".")
+	m := settings
+	for _, p := range parts[:len(parts)-1] {
+		child, ok := m[p].(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("Key %v isn't set", key)
+		}
+		m = child
+	}
+	last := parts[len(parts)-1]
+	if _, ok := m[last]; !ok {
+		return nil, errors.Errorf("Key %v isn't set", key)
+	}
+	delete(m, last)
+
+	nv := viper.New()
+	nv.SetConfigFile(v.ConfigFileUsed())
+	if err := nv.MergeConfigMap(settings); err != nil {
+		return nil, errors.Wrapf(err, "Failed to update configuration")
+	}
+	return nv, nil
+}
+
+// KeySource returns where the value of key comes from; one of the Source constants.
+// file is the configuration file without any overrides; see ReadConfigFile.
+// cmd is the command whose flags are checked; it can be nil.
+func KeySource(cmd *cobra.Command, file *viper.Viper, key string) string {
+	if cmd != nil {
+		for k, flag := range keyToFlagName {
+			if !strings.EqualFold(k, key) {
+				continue
+			}
+			if f := cmd.Flags().Lookup(flag); f != nil && f.Changed {
+				return SourceFlag
+			}
+		}
+		if strings.EqualFold(key, "logging.format") {
+			if f := cmd.Flags().Lookup(JSONLogsFlagName); f != nil && f.Changed {
+				return SourceFlag
+			}
+		}
+	}
+	env := "HCCLI_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	if _, ok := os.LookupEnv(env); ok {
+		return SourceEnv
+	}
+	if p := ActiveProfile(); p != "" && file.IsSet("profiles."+strings.ToLower(p)+"."+key) {
+		return SourceProfile
+	}
+	if file.IsSet(key) {
+		return SourceFile
+	}
+	return SourceDefault
+}
+
+// ReadConfigDocument reads the YAML of the configuration file.
+// Commands that change the file edit the document rather than rewriting the configuration so comments, the order
+// of the keys and unknown keys are preserved. A missing or empty file is an empty mapping.
+func ReadConfigDocument(cfgFile string) (*yaml.Node, error) {
+	doc := &yaml.Node{}
+	b, err := os.ReadFile(cfgFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "Failed to read config file %v", cfgFile)
+	}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse config file %v", cfgFile)
+	}
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.Errorf("Config file %v should be a mapping", cfgFile)
+	}
+	return doc, nil
+}
+
+// SetNodeValue sets key to value in the document creating any missing parents.
+// Keys are matched case insensitively like viper; new keys are spelled like the configuration key e.g. baseURL.
+// The comments of an existing value are kept.
+func SetNodeValue(doc *yaml.Node, key string, value interface{}) error {
+	parts := strings.Split(canonicalKey(key), ".")
+	m := doc.Content[0]
+	for _, p := range parts[:len(parts)-1] {
+		child := mappingValue(m, p)
+		if child == nil {
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: p}, child)
+		}
+		if child.Kind != yaml.MappingNode {
+			return errors.Errorf("Can't set %v because %v isn't a map", key, p)
+		}
+		m = child
+	}
+
+	n := &yaml.Node{}
+	if s, ok := value.(string); ok {
+		// Strings from the command line e.g. 50 or true are converted to the type of the field when the
+		// configuration is loaded so they aren't quoted.
+		n.Kind = yaml.ScalarNode
+		n.Value = s
+	} else if err := n.Encode(value); err != nil {
+		return errors.Wrapf(err, "Failed to serialize %v", key)
+	}
+
+	last := parts[len(parts)-1]
+	if existing := mappingValue(m, last); existing != nil {
+		n.HeadComment, n.LineComment, n.FootComment = existing.HeadComment, existing.LineComment, existing.FootComment
+		*existing = *n
+		return nil
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last}, n)
+	return nil
+}
+
+// UnsetNodeValue removes key from the document.
+// Parent mappings that are empty once the key is removed are removed too e.g. logging after unsetting
+// logging.level when it is the only field.
+func UnsetNodeValue(doc *yaml.Node, key string) error {
+	parts := strings.Split(key, ".")
+	path := []*yaml.Node{doc.Content[0]}
+	for _, p := range parts[:len(parts)-1] {
+		m := mappingValue(path[len(path)-1], p)
+		if m == nil || m.Kind != yaml.MappingNode {
+			return errors.Errorf("Key %v isn't set", key)
+		}
+		path = append(path, m)
+	}
+	for i := len(parts) - 1; i >= 0; i-- {
+		m := path[i]
+		j := mappingIndex(m, parts[i])
+		if j < 0 {
+			return errors.Errorf("Key %v isn't set", key)
+		}
+		m.Content = append(m.Content[:j], m.Content[j+2:]...)
+		if i == 0 || len(m.Content) > 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// WriteDocument writes the document to the configuration file with apiVersion and kind set to the current
+// version; see WriteFile.
+func WriteDocument(cfgFile string, doc *yaml.Node) error {
+	if err := SetNodeValue(doc, "apiVersion", APIVersion); err != nil {
+		return err
+	}
+	if err := SetNodeValue(doc, "kind", ConfigKind); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to write config file %s", cfgFile)
+	}
+	return WriteFile(cfgFile, b)
+}
+
+// mappingValue returns the value of key in the mapping or nil if it isn't set.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(m, key); i >= 0 {
+		return m.Content[i+1]
+	}
+	return nil
+}
+
+// mappingIndex returns the index of the key node of key in the mapping or -1 if it isn't set.
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if strings.EqualFold(m.Content[i].Value, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// canonicalKey returns key spelled like the configuration key it refers to e.g. columnSelection.maxColumns for
+// columnselection.maxcolumns. Unknown keys and profile names are returned unchanged.
+func canonicalKey(key string) string {
+	prefix := ""
+	if len(key) > len("profiles.") && strings.EqualFold(key[:len("profiles.")], "profiles.") {
+		profile, rest, ok := strings.Cut(key[len("profiles."):], ".")
+		if !ok {
+			return "profiles." + profile
+		}
+		prefix = "profiles." + profile + "."
+		key = rest
+	}
+	for _, k := range Keys() {
+		if strings.EqualFold(k.Name, key) {
+			return prefix + k.Name
+		}
+		if k.IsMap && len(key) > len(k.Name) && strings.EqualFold(key[:len(k.Name)+1], k.Name+".") {
+			return prefix + k.Name + key[len(k.Name):]
+		}
+	}
+	return prefix + key
+}
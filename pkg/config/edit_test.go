@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_SetValue(t *testing.T) {
+	v := viper.New()
+	if err := SetValue(v, "baseURL", "https://ui.honeycomb.io/team?a=b", false); err != nil {
+		t.Fatalf("Failed to set value; %v", err)
+	}
+	if err := SetValue(v, "columnSelection.include", "[service.name, http.route]", false); err != nil {
+		t.Fatalf("Failed to set value; %v", err)
+	}
+	if err := SetValue(v, "columnSelection.include", "k8s.pod.name", true); err != nil {
+		t.Fatalf("Failed to append value; %v", err)
+	}
+	if err := SetValue(v, "columnCache", "{ttl: 6h, disabled: true}", false); err != nil {
+		t.Fatalf("Failed to set value; %v", err)
+	}
+	if err := SetValue(v, "baseURL", "other", true); err == nil {
+		t.Errorf("Expected an error appending to a value that isn't a list")
+	}
+
+	cfg, err := FromViper(v)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal configuration; %v", err)
+	}
+	expected := &Config{
+		BaseURL:         "https://ui.honeycomb.io/team?a=b",
+		ColumnSelection: &ColumnSelectionConfig{Include: []string{"service.name", "http.route", "k8s.pod.name"}},
+		ColumnCache:     &ColumnCacheConfig{TTL: "6h", Disabled: true},
+	}
+	if d := cmp.Diff(expected, cfg); d != "" {
+		t.Errorf("Unexpected configuration;diff:\n%v", d)
+	}
+
+	v, err = UnsetValue(v, "columnCache.disabled")
+	if err != nil {
+		t.Fatalf("Failed to unset value; %v", err)
+	}
+	if v.IsSet("columnCache.disabled") || v.GetString("columnCache.ttl") != "6h" {
+		t.Errorf("Unset removed the wrong keys; %v", v.AllSettings())
+	}
+	if _, err := UnsetValue(v, "replicate.model"); err == nil {
+		t.Errorf("Expected an error unsetting a key that isn't set")
+	}
+}
+
+func Test_KeySource(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	file := viper.New()
+	file.Set("baseURL", "https://ui.honeycomb.io/team")
+	file.Set("profiles.staging.translator.endpoint", "http://staging")
+	viper.Set(ProfileFlagName, "staging")
+	t.Setenv("HCCLI_TRANSLATOR_REPLICATE_MODEL", "owner/model")
+
+	type testCase struct {
+		key      string
+		expected string
+	}
+	cases := []testCase{
+		{key: "baseURL", expected: SourceFile},
+		{key: "translator.endpoint", expected: SourceProfile},
+		{key: "translator.replicate.model", expected: SourceEnv},
+		{key: "columnCache.ttl", expected: SourceDefault},
+	}
+	for _, c := range cases {
+		t.Run(c.key, func(t *testing.T) {
+			if actual := KeySource(nil, file, c.key); actual != c.expected {
+				t.Errorf("Unexpected source; got %v want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_WriteBackup(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "hccli", "config.yaml")
+	if err := (&Config{BaseURL: "https://first"}).Write(cfgFile); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+	if _, err := os.Stat(cfgFile + BackupSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected no backup when the file didn't exist")
+	}
+	if err := (&Config{BaseURL: "https://second"}).Write(cfgFile); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+	backup, err := os.ReadFile(cfgFile + BackupSuffix)
+	if err != nil {
+		t.Fatalf("Failed to read backup; %v", err)
+	}
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(backup)); err != nil {
+		t.Fatalf("Failed to parse backup; %v", err)
+	}
+	if v.GetString("baseURL") != "https://first" {
+		t.Errorf("Backup should contain the previous configuration; got %v", string(backup))
+	}
+}
+
+func Test_ConfigDocument(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "config.yaml")
+	original := `# yaml-language-server: $schema=./config.schema.json
+apiVersion: hccli/v1alpha2
+kind: Config
+baseURL: https://ui.honeycomb.io/first # the team
+strayKey: 1
+columnSelection:
+    maxColumns: 10
+`
+	if err := os.WriteFile(cfgFile, []byte(original), 0600); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+	doc, err := ReadConfigDocument(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to read config; %v", err)
+	}
+	if err := SetNodeValue(doc, "baseurl", "https://ui.honeycomb.io/second"); err != nil {
+		t.Fatalf("Failed to set baseURL; %v", err)
+	}
+	if err := SetNodeValue(doc, "columnselection.include", []interface{}{"name"}); err != nil {
+		t.Fatalf("Failed to set columnSelection.include; %v", err)
+	}
+	if err := SetNodeValue(doc, "profiles.staging.logging.level", "debug"); err != nil {
+		t.Fatalf("Failed to set a profile; %v", err)
+	}
+	if err := UnsetNodeValue(doc, "columnselection.maxcolumns"); err != nil {
+		t.Fatalf("Failed to unset columnSelection.maxColumns; %v", err)
+	}
+	if err := UnsetNodeValue(doc, "missing"); err == nil {
+		t.Errorf("Expected an error unsetting a key that isn't set")
+	}
+	if err := WriteDocument(cfgFile, doc); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+
+	actual, err := os.ReadFile(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to read config; %v", err)
+	}
+	expected := `# yaml-language-server: $schema=./config.schema.json
+apiVersion: hccli/v1alpha2
+kind: Config
+baseURL: https://ui.honeycomb.io/second # the team
+strayKey: 1
+columnSelection:
+    include:
+        - name
+profiles:
+    staging:
+        logging:
+            level: debug
+`
+	if d := cmp.Diff(expected, string(actual)); d != "" {
+		t.Errorf("Comments and unknown keys should be preserved;diff:\n%v", d)
+	}
+	backup, err := os.ReadFile(cfgFile + BackupSuffix)
+	if err != nil || string(backup) != original {
+		t.Errorf("Backup should contain the previous file; got %v, %v", string(backup), err)
+	}
+}
+
+func Test_UnsetNodeValueRemovesEmptyParents(t *testing.T) {
+	in := `baseURL: https://ui.honeycomb.io/team
+logging:
+    level: debug
+profiles:
+    staging:
+        logging:
+            level: info
+    dev:
+        baseURL: https://dev
+`
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal([]byte(in), doc); err != nil {
+		t.Fatalf("Failed to parse config; %v", err)
+	}
+	if err := UnsetNodeValue(doc, "logging.level"); err != nil {
+		t.Fatalf("Failed to unset logging.level; %v", err)
+	}
+	if err := UnsetNodeValue(doc, "profiles.staging.logging.level"); err != nil {
+		t.Fatalf("Failed to unset profiles.staging.logging.level; %v", err)
+	}
+	actual, err := yaml.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to serialize config; %v", err)
+	}
+	expected := `baseURL: https://ui.honeycomb.io/team
+profiles:
+    dev:
+        baseURL: https://dev
+`
+	if d := cmp.Diff(expected, string(actual)); d != "" {
+		t.Errorf("Empty parents should be removed;diff:\n%v", d)
+	}
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Key describes a configuration key.
+type Key struct {
+	// Name is the dotted path of the key e.g. replicate.model.
+	Name string
+	// Type is the JSON schema type of the value.
+	Type        string
+	Description string
+	// IsMap is true for keys whose value is a map with arbitrary keys e.g. profiles.
+	IsMap bool
+}
+
+// keyDescriptions describes every configuration key; Test_KeyDescriptions checks none are missing.
+var keyDescriptions = map[string]string{
+	"apiVersion":                        "Version of the configuration format",
+	"kind":                              "Kind of the configuration; always Config",
+	"translator":                        "The model that translates natural language into queries",
+	"translator.endpoint":               "URL of the model server that translates natural language into queries",
+	"translator.replicate":              "Use a model deployed on Replicate instead of the endpoint",
+	"translator.replicate.apiTokenFile": "Reference to the Replicate API token e.g. a file path or env://REPLICATE_API_TOKEN",
+	"translator.replicate.model":        "Replicate model as owner/name:version",
+	"translator.chat":                   "Use a chat model with an OpenAI compatible API instead of the endpoint",
+	"translator.chat.baseURL":           "URL of the chat API e.g. https://api.openai.com/v1",
+	"translator.chat.model":             "Name of the chat model e.g. gpt-4o",
+	"translator.chat.apiKeyFile":        "Reference to the chat API key e.g. a file path or env://OPENAI_API_KEY",
+	"honeycombAPIKeyFile":               "Reference to the Honeycomb API key e.g. a file path or env://HONEYCOMB_API_KEY",
+	"logging":                           "Logging configuration",
+	"logging.level":                     "Logging level; debug, info, warn or error",
+	"logging.format":                    "Format of the logs; console (default) or json",
+	"logging.file":                      "File to write logs to instead of stderr; the file is rotated when it gets too large",
+	"logging.maxSizeMB":                 "Size in megabytes at which the log file is rotated; defaults to 10",
+	"logging.maxBackups":                "Number of rotated log files to keep; defaults to 3",
+	"logging.levels":                    "Levels of individual packages keyed by the suffix of their import path e.g. pkg/config",
+	"columnSelection":                   "How columns are chosen to send to the translator",
+	"columnSelection.maxColumns":        "Maximum number of columns sent to the translator",
+	"columnSelection.staleAfter":        "Drop columns that haven't been written to for this long e.g. 720h",
+	"columnSelection.include":           "Columns that are always sent to the translator",
+	"valueSampling":                     "Sampling the values of columns to include in the translator's input",
+	"valueSampling.enabled":             "Sample values using Honeycomb's Query Data API",
+	"valueSampling.eventsFile":          "File of JSON events to sample values from instead of the Query Data API",
+	"valueSampling.maxValues":           "Number of values to include for each column",
+	"valueSampling.maxColumns":          "Number of string columns to sample",
+	"columnCache":                       "On disk cache of dataset columns",
+	"columnCache.ttl":                   "How long cached columns are used e.g. 1h",
+	"columnCache.disabled":              "Always fetch columns from Honeycomb",
+	"baseURL":                           "URL of your environment in the Honeycomb UI e.g. https://ui.honeycomb.io/<team>/environments/<env>",
+	"currentProfile":                    "Profile used when --profile isn't specified",
+	"profiles":                          "Named sets of overrides of any other key",
+}
+
+// flagOnlyKeys are keys viper binds to command line flags that aren't part of the configuration file.
+var flagOnlyKeys = map[string]bool{
+	ConfigFlagName:  true,
+	ProfileFlagName: true,
+}
+
+// Keys returns every configuration key sorted by name. Objects are included along with their fields.
+func Keys() []Key {
+	keys := make([]Key, 0, len(keyDescriptions))
+	walkKeys(reflect.TypeOf(Config{}), "", func(name string, t reflect.Type) {
+		keys = append(keys, Key{Name: name, Type: schemaType(t), Description: keyDescriptions[name], IsMap: t.Kind() == reflect.Map})
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+	return keys
+}
+
+// IsKnownKey returns true if name is a configuration key. Keys are case insensitive because viper lowercases them.
+// Keys of profiles are known if the overridden key is known e.g. profiles.staging.baseURL.
+func IsKnownKey(name string) bool {
+	name = strings.ToLower(name)
+	if rest, ok := strings.CutPrefix(name, "profiles."); ok {
+		_, key, ok := strings.Cut(rest, ".")
+		if !ok {
+			// The profile itself.
+			return true
+		}
+		return !strings.HasPrefix(key, "profiles") && key != "currentprofile" && IsKnownKey(key)
+	}
+	for _, k := range Keys() {
+		key := strings.ToLower(k.Name)
+		if key == name || (k.IsMap && strings.HasPrefix(name, key+".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateKeys returns a problem for each key that isn't a configuration key e.g. because of a typo.
+func ValidateKeys(keys []string) []string {
+	problems := make([]string, 0)
+	for _, k := range keys {
+		if flagOnlyKeys[k] || IsKnownKey(k) {
+			continue
+		}
+		problems = append(problems, "Unknown configuration key "+k+"; run hccli config keys to see the supported keys")
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// Schema returns a JSON schema for the configuration file.
+func Schema() map[string]interface{} {
+	s := typeSchema(reflect.TypeOf(Config{}), "")
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = "hccli configuration"
+	return s
+}
+
+// walkKeys calls fn for every field of t reachable through structs using the yaml names of the fields.
+func walkKeys(t reflect.Type, prefix string, fn func(name string, t reflect.Type)) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := yamlName(f)
+		if name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		fn(name, f.Type)
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			walkKeys(ft, name, fn)
+		}
+	}
+}
+
+func typeSchema(t reflect.Type, name string) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s := map[string]interface{}{"type": schemaType(t)}
+	if d := keyDescriptions[name]; d != "" {
+		s["description"] = d
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			field := yamlName(f)
+			if field == "" {
+				continue
+			}
+			key := field
+			if name != "" {
+				key = name + "." + field
+			}
+			properties[field] = typeSchema(f.Type, key)
+		}
+		s["properties"] = properties
+		s["additionalProperties"] = false
+	case reflect.Map:
+		// e.g. profiles override arbitrary keys of the configuration.
+		s["additionalProperties"] = map[string]interface{}{"type": schemaType(t.Elem())}
+	}
+	return s
+}
+
+func schemaType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice:
+		return "array"
+	default:
+		return "string"
+	}
+}
+
+func yamlName(f reflect.StructField) string {
+	tag := f.Tag.Get("yaml")
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_KeyDescriptions(t *testing.T) {
+	for _, k := range Keys() {
+		if k.Description == "" {
+			t.Errorf("Key %v doesn't have a description; add it to keyDescriptions", k.Name)
+		}
+	}
+}
+
+func Test_IsKnownKey(t *testing.T) {
+	type testCase struct {
+		key      string
+		expected bool
+	}
+
+	cases := []testCase{
+		{key: "baseURL", expected: true},
+		{key: "baseurl", expected: true},
+		{key: "translator.replicate.model", expected: true},
+		{key: "translator.replicate.modle", expected: false},
+		{key: "aiEndpont", expected: false},
+		{key: "profiles.staging.baseURL", expected: true},
+		{key: "profiles.staging", expected: true},
+		{key: "profiles.staging.baseURLs", expected: false},
+		{key: "profiles.staging.profiles.dev.baseURL", expected: false},
+		{key: "logging.levels.pkg/config", expected: true},
+		{key: "logging.levls.pkg/config", expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.key, func(t *testing.T) {
+			if actual := IsKnownKey(c.key); actual != c.expected {
+				t.Errorf("Unexpected result for %v; got %v want %v", c.key, actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_IsValid(t *testing.T) {
+	type testCase struct {
+		name     string
+		cfg      Config
+		expected []string
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatalf("Failed to write key file; %v", err)
+	}
+
+	cases := []testCase{
+		{
+			name: "valid",
+			cfg: Config{
+				APIVersion: APIVersion,
+				Kind:       ConfigKind,
+				Translator: &TranslatorConfig{
+					Endpoint:  "http://localhost:5000",
+					Replicate: &ReplicateConfig{Model: "owner/name:abc123", APITokenFile: "env://REPLICATE_API_TOKEN"},
+					Chat:      &ChatConfig{BaseURL: "https://api.openai.com/v1", Model: "gpt-4o", APIKeyFile: "env://OPENAI_API_KEY"},
+				},
+				BaseURL:             "https://ui.honeycomb.io/team/environments/prod",
+				HoneycombAPIKeyFile: keyFile,
+				Logging:             Logging{Level: "debug"},
+			},
+			expected: []string{},
+		},
+		{
+			name: "invalid",
+			cfg: Config{
+				APIVersion: "hccli/v1",
+				Translator: &TranslatorConfig{
+					Endpoint:  "localhost:5000",
+					Replicate: &ReplicateConfig{Model: "name"},
+					Chat:      &ChatConfig{BaseURL: "api.openai.com"},
+				},
+				BaseURL:             "ui.honeycomb.io",
+				HoneycombAPIKeyFile: "/missing/key",
+				Logging:             Logging{Level: "verbose", Format: "text", Levels: map[string]string{"pkg/config": "loud"}},
+			},
+			expected: []string{
+				`apiVersion "hccli/v1" should be "hccli/v1alpha2"`,
+				`translator.endpoint "localhost:5000" should be an http or https URL`,
+				`baseURL "ui.honeycomb.io" should be an http or https URL`,
+				`translator.replicate.model "name" should be owner/name or owner/name:version`,
+				"translator.replicate.apiTokenFile must be set to use Replicate",
+				`translator.chat.baseURL "api.openai.com" should be an http or https URL`,
+				"translator.chat.model must be set to use a chat model",
+				`logging.level "verbose" isn't a valid level; use debug, info, warn or error`,
+				`logging.format "text" should be json or console`,
+				`logging.levels.pkg/config "loud" isn't a valid level; use debug, info, warn or error`,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := c.cfg.IsValid()
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected problems;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_CheckFiles(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("key"), 0600); err != nil {
+		t.Fatalf("Failed to write key file; %v", err)
+	}
+
+	cfg := Config{
+		HoneycombAPIKeyFile: "/missing/key",
+		Translator: &TranslatorConfig{
+			Replicate: &ReplicateConfig{Model: "owner/name", APITokenFile: keyFile},
+			Chat:      &ChatConfig{BaseURL: "https://api.openai.com/v1", Model: "gpt-4o", APIKeyFile: "file:///missing/chat"},
+		},
+		ValueSampling: &ValueSamplingConfig{EventsFile: "/missing/events.jsonl"},
+	}
+	expected := []string{
+		`honeycombAPIKeyFile "/missing/key" can't be read; open /missing/key: no such file or directory`,
+		`translator.chat.apiKeyFile "file:///missing/chat" can't be read; open /missing/chat: no such file or directory`,
+		`valueSampling.eventsFile "/missing/events.jsonl" can't be read; stat /missing/events.jsonl: no such file or directory`,
+	}
+	if d := cmp.Diff(expected, cfg.CheckFiles()); d != "" {
+		t.Errorf("Unexpected problems;diff:\n%v", d)
+	}
+	if p := cfg.IsValid(); len(p) != 0 {
+		t.Errorf("Missing files shouldn't make the configuration invalid; got %v", p)
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// APIVersionV1Alpha1 is the original format where the translator is configured by the top level fields
+	// aiEndpoint and replicate. Files without an apiVersion use this version.
+	APIVersionV1Alpha1 = "hccli/v1alpha1"
+	// APIVersionV1Alpha2 moves aiEndpoint and replicate into the translator section.
+	APIVersionV1Alpha2 = "hccli/v1alpha2"
+	// APIVersion is the current version; Write always writes this version.
+	APIVersion = APIVersionV1Alpha2
+	// ConfigKind is the kind of the configuration file.
+	ConfigKind = "Config"
+)
+
+// migration upgrades the configuration from one version to the next.
+// Migrations edit the YAML document of the file so comments, the spelling of the keys and unknown keys are kept
+// and so they can read fields that have been removed from Config.
+type migration struct {
+	from string
+	to   string
+	// apply modifies the root mapping of the document in place and returns a description of each change.
+	apply func(m *yaml.Node) []string
+}
+
+// migrations are the migrations between consecutive versions.
+var migrations = []migration{
+	{from: APIVersionV1Alpha1, to: APIVersionV1Alpha2, apply: moveTranslator},
+}
+
+// Migrate upgrades the configuration document to APIVersion in place; see ReadConfigDocument.
+// It returns a description of each change; there are no changes if the document is already the current version.
+func Migrate(doc *yaml.Node) ([]string, error) {
+	m := doc.Content[0]
+	version := documentVersion(doc)
+	changes := make([]string, 0)
+	for version != APIVersion {
+		var next *migration
+		for i := range migrations {
+			if migrations[i].from == version {
+				next = &migrations[i]
+				break
+			}
+		}
+		if next == nil {
+			return nil, errors.Errorf("Config apiVersion %v isn't supported by this version of hccli which supports up to %v; upgrade hccli", version, APIVersion)
+		}
+		changes = append(changes, next.apply(m)...)
+		changes = append(changes, fmt.Sprintf("upgraded apiVersion from %v to %v", version, next.to))
+		version = next.to
+	}
+	setVersion(doc)
+	return changes, nil
+}
+
+// MigrateFile upgrades the configuration file to APIVersion.
+// The original file is saved next to it with its version and BackupSuffix appended e.g. config.yaml.v1alpha1.bak.
+// It returns the changes and the backup file; there are no changes if the file is already the current version.
+func MigrateFile(cfgFile string) ([]string, string, error) {
+	b, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Failed to read config file %v", cfgFile)
+	}
+	doc, err := ReadConfigDocument(cfgFile)
+	if err != nil {
+		return nil, "", err
+	}
+	version := documentVersion(doc)
+	if version == APIVersion {
+		return []string{}, "", nil
+	}
+
+	changes, err := Migrate(doc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Check the migrated settings can be loaded. Viper lowercases the keys of the map so it is decoded from the
+	// document rather than shared with it.
+	settings := make(map[string]interface{})
+	if err := doc.Decode(&settings); err != nil {
+		return nil, "", errors.Wrapf(err, "Failed to decode migrated configuration")
+	}
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return nil, "", errors.Wrapf(err, "Failed to load migrated configuration")
+	}
+	if _, err := FromViper(v); err != nil {
+		return nil, "", err
+	}
+	// Unknown keys e.g. typos are kept rather than failing the migration; otherwise every command, including the
+	// config commands used to fix them, would fail. They are reported when the configuration is loaded.
+	for _, k := range v.AllKeys() {
+		if !flagOnlyKeys[k] && !IsKnownKey(k) {
+			changes = append(changes, fmt.Sprintf("kept unknown key %v; remove it with hccli config unset %v", k, k))
+		}
+	}
+	migrated, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Failed to serialize migrated configuration")
+	}
+
+	backup := cfgFile + "." + path.Base(version) + BackupSuffix
+	if err := os.WriteFile(backup, b, 0600); err != nil {
+		return nil, "", errors.Wrapf(err, "Failed to back up config file to %v", backup)
+	}
+	if err := os.WriteFile(cfgFile, migrated, 0600); err != nil {
+		return nil, "", errors.Wrapf(err, "Failed to write config file %v", cfgFile)
+	}
+	return changes, backup, nil
+}
+
+// documentVersion returns the apiVersion of the document; files without an apiVersion are APIVersionV1Alpha1.
+func documentVersion(doc *yaml.Node) string {
+	if n := mappingValue(doc.Content[0], "apiVersion"); n != nil && n.Kind == yaml.ScalarNode && n.Value != "" {
+		return n.Value
+	}
+	return APIVersionV1Alpha1
+}
+
+// setVersion sets apiVersion and kind to the current version.
+// Missing keys are added at the top of the file rather than the end so the file reads like one written by hccli.
+func setVersion(doc *yaml.Node) {
+	m := doc.Content[0]
+	header := make([]*yaml.Node, 0, 4)
+	for _, kv := range [][2]string{{"apiVersion", APIVersion}, {"kind", ConfigKind}} {
+		if n := mappingValue(m, kv[0]); n != nil {
+			n.Kind, n.Tag, n.Style, n.Value, n.Content = yaml.ScalarNode, "!!str", 0, kv[1], nil
+			continue
+		}
+		header = append(header,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv[0]},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv[1]})
+	}
+	if len(header) > 0 && len(m.Content) > 0 {
+		// A comment at the start of the file stays at the start.
+		header[0].HeadComment, m.Content[0].HeadComment = m.Content[0].HeadComment, ""
+	}
+	m.Content = append(header, m.Content...)
+}
+
+// moveTranslator moves aiEndpoint and replicate into the translator section at the top level and in every profile.
+func moveTranslator(m *yaml.Node) []string {
+	changes := moveTranslatorFields(m, "")
+	profiles := mappingValue(m, "profiles")
+	if profiles == nil || profiles.Kind != yaml.MappingNode {
+		return changes
+	}
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		if overrides := profiles.Content[i+1]; overrides.Kind == yaml.MappingNode {
+			changes = append(changes, moveTranslatorFields(overrides, "profiles."+profiles.Content[i].Value+".")...)
+		}
+	}
+	return changes
+}
+
+func moveTranslatorFields(m *yaml.Node, prefix string) []string {
+	changes := make([]string, 0)
+	translator := mappingValue(m, "translator")
+	for _, f := range []struct{ from, to string }{{"aiEndpoint", "endpoint"}, {"replicate", "replicate"}} {
+		i := mappingIndex(m, f.from)
+		if i < 0 {
+			continue
+		}
+		k, v := m.Content[i], m.Content[i+1]
+		m.Content = append(m.Content[:i], m.Content[i+2:]...)
+		// Write used to write every field so empty values are dropped rather than moved.
+		if v.Kind == yaml.ScalarNode && (v.Tag == "!!null" || (f.from == "aiEndpoint" && v.Value == "")) {
+			continue
+		}
+		if translator == nil {
+			// The translator section takes the place of the first field moved into it.
+			translator = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "translator", HeadComment: k.HeadComment}
+			k.HeadComment = ""
+			m.Content = append(m.Content[:i], append([]*yaml.Node{key, translator}, m.Content[i:]...)...)
+		} else if translator.Kind != yaml.MappingNode {
+			*translator = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		if j := mappingIndex(translator, f.to); j >= 0 {
+			translator.Content = append(translator.Content[:j], translator.Content[j+2:]...)
+		}
+		// The key node is reused so its other comments move with it.
+		k.Value = f.to
+		translator.Content = append(translator.Content, k, v)
+		changes = append(changes, fmt.Sprintf("moved %s%s to %stranslator.%s", prefix, f.from, prefix, f.to))
+	}
+	return changes
+}
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_Migrate(t *testing.T) {
+	type testCase struct {
+		name            string
+		in              string
+		expected        string
+		expectedChanges []string
+	}
+
+	cases := []testCase{
+		{
+			name: "v1alpha1",
+			in: `
+aiEndpoint: http://localhost:5000
+replicate: null
+baseURL: https://ui.honeycomb.io/team/environments/prod
+profiles:
+  staging:
+    aiendpoint: http://staging:5000
+  dev:
+    replicate:
+      model: owner/dev
+`,
+			expected: `
+apiVersion: hccli/v1alpha2
+kind: Config
+translator:
+  endpoint: http://localhost:5000
+baseURL: https://ui.honeycomb.io/team/environments/prod
+profiles:
+  staging:
+    translator:
+      endpoint: http://staging:5000
+  dev:
+    translator:
+      replicate:
+        model: owner/dev
+`,
+			expectedChanges: []string{
+				"moved aiEndpoint to translator.endpoint",
+				"moved profiles.dev.replicate to profiles.dev.translator.replicate",
+				"moved profiles.staging.aiEndpoint to profiles.staging.translator.endpoint",
+				"upgraded apiVersion from hccli/v1alpha1 to hccli/v1alpha2",
+			},
+		},
+		{
+			name: "current",
+			in: `
+apiVersion: hccli/v1alpha2
+translator:
+  endpoint: http://localhost:5000
+`,
+			expected: `
+apiVersion: hccli/v1alpha2
+kind: Config
+translator:
+  endpoint: http://localhost:5000
+`,
+			expectedChanges: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			doc := &yaml.Node{}
+			if err := yaml.Unmarshal([]byte(c.in), doc); err != nil {
+				t.Fatalf("Failed to parse input; %v", err)
+			}
+			expected := make(map[string]interface{})
+			if err := yaml.Unmarshal([]byte(c.expected), &expected); err != nil {
+				t.Fatalf("Failed to parse expected; %v", err)
+			}
+			changes, err := Migrate(doc)
+			if err != nil {
+				t.Fatalf("Failed to migrate; %v", err)
+			}
+			settings := make(map[string]interface{})
+			if err := doc.Decode(&settings); err != nil {
+				t.Fatalf("Failed to decode migrated document; %v", err)
+			}
+			if d := cmp.Diff(expected, settings); d != "" {
+				t.Errorf("Unexpected settings;diff:\n%v", d)
+			}
+			// Profiles are migrated in map order.
+			sort.Strings(changes)
+			if d := cmp.Diff(c.expectedChanges, changes); d != "" {
+				t.Errorf("Unexpected changes;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_MigrateFile(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "config.yaml")
+	original := "aiEndpoint: http://localhost:5000\nbaseURL: https://ui.honeycomb.io/team\n"
+	if err := os.WriteFile(cfgFile, []byte(original), 0600); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+
+	changes, backup, err := MigrateFile(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to migrate; %v", err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("Unexpected changes; %v", changes)
+	}
+	if backup != cfgFile+".v1alpha1.bak" {
+		t.Errorf("Unexpected backup file %v", backup)
+	}
+	b, err := os.ReadFile(backup)
+	if err != nil || string(b) != original {
+		t.Errorf("Backup should contain the original file; got %q err %v", string(b), err)
+	}
+
+	migrated, err := ReadConfigFile(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to read migrated config; %v", err)
+	}
+	cfg, err := FromViper(migrated)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal migrated config; %v", err)
+	}
+	if cfg.APIVersion != APIVersion || cfg.GetTranslator().Endpoint != "http://localhost:5000" || cfg.BaseURL != "https://ui.honeycomb.io/team" {
+		t.Errorf("Unexpected migrated config %+v", cfg)
+	}
+
+	// Migrating again is a no-op.
+	changes, _, err = MigrateFile(cfgFile)
+	if err != nil || len(changes) != 0 {
+		t.Errorf("Expected no changes migrating the current version; got %v err %v", changes, err)
+	}
+
+	// Unknown keys are kept so they can be fixed with the config commands.
+	if err := os.WriteFile(cfgFile, []byte("aiEndpont: http://localhost:5000\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+	changes, _, err = MigrateFile(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to migrate a config with an unknown key; %v", err)
+	}
+	if len(changes) != 2 || !strings.Contains(changes[1], "aiendpont") {
+		t.Errorf("Expected the unknown key to be reported; got %v", changes)
+	}
+	migrated, err = ReadConfigFile(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to read migrated config; %v", err)
+	}
+	if migrated.GetString("aiEndpont") != "http://localhost:5000" || migrated.GetString("apiVersion") != APIVersion {
+		t.Errorf("Expected the unknown key to be kept; got %v", migrated.AllSettings())
+	}
+
+	// Comments and the spelling of the keys are kept.
+	original = `# keep me
+aiEndpoint: http://localhost:5000 # the endpoint
+baseURL: https://ui.honeycomb.io/team
+honeycombAPIKeyFile: /tmp/key
+`
+	if err := os.WriteFile(cfgFile, []byte(original), 0600); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+	if _, _, err := MigrateFile(cfgFile); err != nil {
+		t.Fatalf("Failed to migrate; %v", err)
+	}
+	b, err = os.ReadFile(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to read migrated config; %v", err)
+	}
+	expected := `# keep me
+apiVersion: hccli/v1alpha2
+kind: Config
+translator:
+    endpoint: http://localhost:5000 # the endpoint
+baseURL: https://ui.honeycomb.io/team
+honeycombAPIKeyFile: /tmp/key
+`
+	if d := cmp.Diff(expected, string(b)); d != "" {
+		t.Errorf("Comments and the spelling of the keys should be kept;diff:\n%v", d)
+	}
+
+	if err := os.WriteFile(cfgFile, []byte("apiVersion: hccli/v9\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config; %v", err)
+	}
+	if _, _, err := MigrateFile(cfgFile); err == nil {
+		t.Errorf("Expected an error migrating a newer version")
+	}
+}
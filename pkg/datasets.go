@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+)
+
+// AllDatasets is the dataset slug Honeycomb uses for environment wide queries.
+const AllDatasets = "__all__"
+
+// HoneycombDataset is a dataset in a Honeycomb environment.
+type HoneycombDataset struct {
+	Name          string    `json:"name"`
+	Slug          string    `json:"slug"`
+	Description   string    `json:"description,omitempty"`
+	LastWrittenAt time.Time `json:"last_written_at,omitempty"`
+}
+
+// DatasetLister lists the datasets in an environment.
+type DatasetLister interface {
+	ListDatasets() ([]HoneycombDataset, error)
+}
+
+// ParseDatasets parses the value of a --dataset flag; either a single slug, AllDatasets or a comma separated list
+// of slugs. Duplicates and empty entries are removed.
+func ParseDatasets(s string) []string {
+	datasets := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, d := range strings.Split(s, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		datasets = append(datasets, d)
+	}
+	return datasets
+}
+
+// ExpandDatasets replaces AllDatasets with the slugs of every dataset in the environment.
+func ExpandDatasets(lister DatasetLister, datasets []string) ([]string, error) {
+	expanded := make([]string, 0, len(datasets))
+	for _, d := range datasets {
+		if d != AllDatasets {
+			expanded = append(expanded, d)
+			continue
+		}
+		all, err := lister.ListDatasets()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range all {
+			expanded = append(expanded, a.Slug)
+		}
+	}
+	return ParseDatasets(strings.Join(expanded, ",")), nil
+}
+
+// UnionColumns returns the union of the columns of the datasets sorted by name.
+// A column that appears in several datasets is hidden only if it is hidden in all of them and its last written time
+// is the most recent of them; the first non-empty type and description are used.
+func UnionColumns(getter ColumnGetter, datasets []string) ([]HoneycombColumn, error) {
+	log := zapr.NewLogger(zap.L())
+	byName := make(map[string]*HoneycombColumn)
+	for _, d := range datasets {
+		columns, err := getter.GetColumns(d)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Fetched columns", "dataset", d, "count", len(columns))
+		for _, c := range columns {
+			existing, ok := byName[c.KeyName]
+			if !ok {
+				c := c
+				// IDs are per dataset so they don't identify the merged column.
+				c.Id = ""
+				byName[c.KeyName] = &c
+				continue
+			}
+			existing.Hidden = existing.Hidden && c.Hidden
+			if c.LastWritten.After(existing.LastWritten) {
+				existing.LastWritten = c.LastWritten
+			}
+			if existing.Type == "" {
+				existing.Type = c.Type
+			}
+			if existing.Description == "" {
+				existing.Description = c.Description
+			}
+		}
+	}
+
+	union := make([]HoneycombColumn, 0, len(byName))
+	for _, c := range byName {
+		union = append(union, *c)
+	}
+	sort.Slice(union, func(i, j int) bool {
+		return union[i].KeyName < union[j].KeyName
+	})
+	return union, nil
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeDatasetLister struct {
+	datasets []HoneycombDataset
+}
+
+func (f *fakeDatasetLister) ListDatasets() ([]HoneycombDataset, error) {
+	return f.datasets, nil
+}
+
+func Test_ParseDatasets(t *testing.T) {
+	type testCase struct {
+		name     string
+		in       string
+		expected []string
+	}
+
+	cases := []testCase{
+		{name: "empty", in: "", expected: []string{}},
+		{name: "single", in: "prod", expected: []string{"prod"}},
+		{name: "all", in: "__all__", expected: []string{AllDatasets}},
+		{name: "list", in: "prod, staging,,prod", expected: []string{"prod", "staging"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := ParseDatasets(c.in)
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected datasets;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ExpandDatasets(t *testing.T) {
+	lister := &fakeDatasetLister{datasets: []HoneycombDataset{{Slug: "prod"}, {Slug: "staging"}}}
+	actual, err := ExpandDatasets(lister, []string{"staging", AllDatasets, "other"})
+	if err != nil {
+		t.Fatalf("Failed to expand datasets; %v", err)
+	}
+	expected := []string{"staging", "prod", "other"}
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Unexpected datasets;diff:\n%v", d)
+	}
+}
+
+func Test_UnionColumns(t *testing.T) {
+	older := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	getter := &fakeColumnGetter{
+		columns: map[string][]HoneycombColumn{
+			"prod": {
+				{Id: "1", KeyName: "name", Type: "string", LastWritten: older},
+				{Id: "2", KeyName: "secret", Hidden: true},
+				{Id: "3", KeyName: "debug", Hidden: true},
+			},
+			"staging": {
+				{Id: "4", KeyName: "name", Description: "Span name", LastWritten: newer},
+				{Id: "5", KeyName: "secret", Hidden: true},
+				{Id: "6", KeyName: "debug"},
+				{Id: "7", KeyName: "duration_ms", Type: "float"},
+			},
+		},
+	}
+
+	actual, err := UnionColumns(getter, []string{"prod", "staging"})
+	if err != nil {
+		t.Fatalf("Failed to union columns; %v", err)
+	}
+	expected := []HoneycombColumn{
+		{KeyName: "debug"},
+		{KeyName: "duration_ms", Type: "float"},
+		{KeyName: "name", Type: "string", Description: "Span name", LastWritten: newer},
+		{KeyName: "secret", Hidden: true},
+	}
+	if d := cmp.Diff(expected, actual); d != "" {
+		t.Errorf("Unexpected columns;diff:\n%v", d)
+	}
+}
@@ -0,0 +1,229 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jlewi/hccli/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/replicate/replicate-go"
+)
+
+// doctorTimeout is how long each connectivity check waits for a response.
+const doctorTimeout = 10 * time.Second
+
+// CheckStatus is the outcome of a check.
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "PASS"
+	CheckFail CheckStatus = "FAIL"
+	// CheckWarn is used for problems that only affect optional features.
+	CheckWarn CheckStatus = "WARN"
+	// CheckSkip is used when the configuration doesn't use the thing being checked.
+	CheckSkip CheckStatus = "SKIP"
+)
+
+// CheckResult is the result of a single check run by hccli doctor.
+type CheckResult struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Details string      `json:"details,omitempty"`
+}
+
+// RunChecks checks the configuration and connectivity to every service hccli uses.
+// keys are the keys set in the configuration; see CheckConfig.
+func RunChecks(cfg config.Config, keys []string, chromePort int) []CheckResult {
+	return []CheckResult{
+		CheckConfig(cfg, keys),
+		CheckHoneycomb(cfg),
+		CheckAIEndpoint(cfg),
+		CheckReplicate(cfg),
+		CheckChat(cfg),
+		CheckChrome(chromePort),
+	}
+}
+
+// CheckConfig checks the configuration is valid, the files it refers to can be read and the keys that are set are
+// configuration keys.
+func CheckConfig(cfg config.Config, keys []string) CheckResult {
+	r := CheckResult{Name: "config"}
+	problems := append(cfg.IsValid(), cfg.CheckFiles()...)
+	problems = append(problems, config.ValidateKeys(keys)...)
+	if len(problems) > 0 {
+		r.Status = CheckFail
+		r.Details = strings.Join(problems, "; ")
+		return r
+	}
+	r.Status = CheckPass
+	r.Details = "configuration is valid"
+	return r
+}
+
+// CheckHoneycomb checks the API key can authenticate with Honeycomb.
+func CheckHoneycomb(cfg config.Config) CheckResult {
+	r := CheckResult{Name: "honeycomb"}
+	if cfg.HoneycombAPIKeyFile == "" {
+		r.Status = CheckSkip
+		r.Details = "honeycombAPIKeyFile isn't set"
+		return r
+	}
+	client, err := NewHoneycombClient(cfg)
+	if err != nil {
+		return failed(r, err)
+	}
+	auth, err := client.Auth()
+	if err != nil {
+		return failed(r, err)
+	}
+	r.Status = CheckPass
+	r.Details = fmt.Sprintf("authenticated to team %v environment %v", auth.Team.Slug, auth.Environment.Slug)
+	return r
+}
+
+// CheckAIEndpoint checks the model server at the translator's endpoint is healthy using cog's health check.
+func CheckAIEndpoint(cfg config.Config) CheckResult {
+	r := CheckResult{Name: "translator.endpoint"}
+	aiEndpoint := cfg.GetTranslator().Endpoint
+	if aiEndpoint == "" {
+		r.Status = CheckSkip
+		r.Details = "translator.endpoint isn't set"
+		return r
+	}
+	endpoint := strings.TrimSuffix(aiEndpoint, "/") + "/health-check"
+	health := struct {
+		Status string `json:"status"`
+	}{}
+	if err := getJSON(endpoint, &health); err != nil {
+		return failed(r, err)
+	}
+	r.Status = CheckPass
+	r.Details = fmt.Sprintf("%v is reachable", aiEndpoint)
+	if health.Status != "" {
+		r.Details += "; status " + health.Status
+	}
+	return r
+}
+
+// CheckReplicate checks the token can access the Replicate model.
+func CheckReplicate(cfg config.Config) CheckResult {
+	r := CheckResult{Name: "replicate"}
+	rc := cfg.GetTranslator().Replicate
+	if rc == nil {
+		r.Status = CheckSkip
+		r.Details = "translator.replicate isn't configured"
+		return r
+	}
+	model := rc.Model
+	client, err := NewReplicateClient(cfg)
+	if err != nil {
+		return failed(r, err)
+	}
+	id, err := replicate.ParseIdentifier(model)
+	if err != nil {
+		return failed(r, errors.Wrapf(err, "Failed to parse Replicate model %v", model))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	if id.Version != nil {
+		if _, err := client.client.GetModelVersion(ctx, id.Owner, id.Name, *id.Version); err != nil {
+			return failed(r, err)
+		}
+	} else if _, err := client.client.GetModel(ctx, id.Owner, id.Name); err != nil {
+		return failed(r, err)
+	}
+	r.Status = CheckPass
+	r.Details = fmt.Sprintf("model %v is accessible", model)
+	return r
+}
+
+// CheckChat checks the chat API is reachable and serves the model using the API's list of models.
+func CheckChat(cfg config.Config) CheckResult {
+	r := CheckResult{Name: "chat"}
+	cc := cfg.GetTranslator().Chat
+	if cc == nil {
+		r.Status = CheckSkip
+		r.Details = "translator.chat isn't configured"
+		return r
+	}
+	client, err := NewChatClient(cfg)
+	if err != nil {
+		return failed(r, err)
+	}
+	client.client.Timeout = doctorTimeout
+	b, err := client.do(http.MethodGet, strings.TrimSuffix(cc.BaseURL, "/")+"/models", nil)
+	if err != nil {
+		return failed(r, err)
+	}
+	models := struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(b, &models); err != nil {
+		return failed(r, errors.Wrapf(err, "Failed to deserialize the list of models"))
+	}
+	for _, m := range models.Data {
+		if m.ID == cc.Model {
+			r.Status = CheckPass
+			r.Details = fmt.Sprintf("model %v is accessible", cc.Model)
+			return r
+		}
+	}
+	r.Status = CheckFail
+	r.Details = fmt.Sprintf("%v doesn't serve model %v", cc.BaseURL, cc.Model)
+	return r
+}
+
+// CheckChrome checks Chrome is running with remote debugging enabled; this is needed to save graphs as images.
+// Chrome not running is a warning since it is only needed for --out-file.
+func CheckChrome(port int) CheckResult {
+	return checkChrome(fmt.Sprintf("http://127.0.0.1:%d", port))
+}
+
+func checkChrome(address string) CheckResult {
+	r := CheckResult{Name: "chrome"}
+	version := struct {
+		Browser string `json:"Browser"`
+	}{}
+	if err := getJSON(address+"/json/version", &version); err != nil {
+		r.Status = CheckWarn
+		r.Details = err.Error() + "; start chrome with --remote-debugging-port to save graphs"
+		return r
+	}
+	r.Status = CheckPass
+	r.Details = fmt.Sprintf("%v is listening on %v", version.Browser, address)
+	return r
+}
+
+func failed(r CheckResult, err error) CheckResult {
+	r.Status = CheckFail
+	r.Details = err.Error()
+	return r
+}
+
+// getJSON sends a GET request and deserializes the JSON response into out.
+func getJSON(endpoint string, out interface{}) error {
+	client := &http.Client{Timeout: doctorTimeout}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to connect to %v", endpoint)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read response from %v", endpoint)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%v returned status code %v", endpoint, resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return errors.Wrapf(err, "Failed to deserialize response from %v", endpoint)
+	}
+	return nil
+}
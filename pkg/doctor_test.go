@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jlewi/hccli/pkg/config"
+)
+
+func Test_CheckAIEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health-check" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"status": "READY"}`))
+	}))
+	defer server.Close()
+
+	type testCase struct {
+		name     string
+		endpoint string
+		expected CheckStatus
+	}
+
+	cases := []testCase{
+		{name: "healthy", endpoint: server.URL + "/", expected: CheckPass},
+		{name: "not-found", endpoint: server.URL + "/other", expected: CheckFail},
+		{name: "unset", endpoint: "", expected: CheckSkip},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := CheckAIEndpoint(config.Config{Translator: &config.TranslatorConfig{Endpoint: c.endpoint}})
+			if actual.Status != c.expected {
+				t.Errorf("Unexpected status; got %v want %v; details %v", actual.Status, c.expected, actual.Details)
+			}
+		})
+	}
+}
+
+func Test_CheckChrome(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Browser": "Chrome/120.0.0.0"}`))
+	}))
+	defer server.Close()
+
+	if actual := checkChrome(server.URL); actual.Status != CheckPass {
+		t.Errorf("Unexpected status; got %v want %v; details %v", actual.Status, CheckPass, actual.Details)
+	}
+
+	server.Close()
+	if actual := checkChrome(server.URL); actual.Status != CheckWarn {
+		t.Errorf("Unexpected status; got %v want %v; details %v", actual.Status, CheckWarn, actual.Details)
+	}
+}
@@ -0,0 +1,311 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// The fields of a query that are scored during an evaluation.
+const (
+	FieldBreakdowns   = "breakdowns"
+	FieldCalculations = "calculations"
+	FieldFilters      = "filters"
+	FieldOrders       = "orders"
+	FieldTimeRange    = "time_range"
+)
+
+// EvalFields is the list of fields scored during an evaluation.
+var EvalFields = []string{FieldBreakdowns, FieldCalculations, FieldFilters, FieldOrders, FieldTimeRange}
+
+// EvalCase is a single example in an evaluation dataset.
+type EvalCase struct {
+	Name string `json:"name"`
+	// NLQ is the natural language question.
+	NLQ string `json:"nlq"`
+	// Columns are the columns in the dataset; they are passed to the translator as a JSON list.
+	Columns []string `json:"columns"`
+	// Expected is the query the translator should produce.
+	Expected HoneycombQuery `json:"expected"`
+}
+
+// EvalCaseResult is the result of evaluating a single case.
+type EvalCaseResult struct {
+	Name string `json:"name"`
+	NLQ  string `json:"nlq"`
+	// Output is the raw output of the translator.
+	Output string          `json:"output"`
+	Actual *HoneycombQuery `json:"actual,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	// Fields reports whether each field in EvalFields matched the expected query.
+	Fields map[string]bool `json:"fields"`
+	// Correct is true if every field matched.
+	Correct bool `json:"correct"`
+	// Diff describes the fields that didn't match.
+	Diff []string `json:"diff,omitempty"`
+}
+
+// EvalReport summarizes the results of evaluating a dataset.
+type EvalReport struct {
+	Time  time.Time `json:"time"`
+	Total int       `json:"total"`
+	// Errors is the number of cases where translation failed or the output couldn't be parsed.
+	Errors int `json:"errors"`
+	// Accuracy is the fraction of cases where every field matched.
+	Accuracy float64 `json:"accuracy"`
+	// FieldAccuracy is the fraction of cases where each field matched.
+	FieldAccuracy map[string]float64 `json:"fieldAccuracy"`
+	Cases         []EvalCaseResult   `json:"cases"`
+}
+
+// ReadEvalDataset reads evaluation cases from a file.
+// Files ending in .jsonl contain one JSON case per line; any other file is parsed as a YAML or JSON list of cases.
+func ReadEvalDataset(path string) ([]EvalCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read dataset %v", path)
+	}
+
+	cases := make([]EvalCase, 0)
+	if filepath.Ext(path) == ".jsonl" {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			c := EvalCase{}
+			if err := json.Unmarshal([]byte(line), &c); err != nil {
+				return nil, errors.Wrapf(err, "Failed to parse case %d in %v", len(cases)+1, path)
+			}
+			cases = append(cases, c)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrapf(err, "Failed to read dataset %v", path)
+		}
+	} else {
+		// Round trip through JSON so the JSON field names of HoneycombQuery apply to YAML as well.
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse dataset %v", path)
+		}
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to convert dataset %v to JSON", path)
+		}
+		if err := json.Unmarshal(b, &cases); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse dataset %v", path)
+		}
+	}
+
+	for i := range cases {
+		if cases[i].Name == "" {
+			cases[i].Name = fmt.Sprintf("case-%d", i+1)
+		}
+	}
+	return cases, nil
+}
+
+// RunEval runs every case through the translator and scores the output against the expected query.
+func RunEval(t Translator, cases []EvalCase) *EvalReport {
+	log := zapr.NewLogger(zap.L())
+	report := &EvalReport{
+		Time:          time.Now(),
+		Total:         len(cases),
+		FieldAccuracy: make(map[string]float64),
+		Cases:         make([]EvalCaseResult, 0, len(cases)),
+	}
+
+	fieldCounts := make(map[string]int)
+	correct := 0
+	for _, c := range cases {
+		result := EvalCaseResult{
+			Name:   c.Name,
+			NLQ:    c.NLQ,
+			Fields: make(map[string]bool),
+		}
+
+		actual, output, err := translateCase(t, c)
+		result.Output = output
+		if err != nil {
+			log.Error(err, "Failed to translate case", "name", c.Name)
+			result.Error = err.Error()
+			for _, f := range EvalFields {
+				result.Fields[f] = false
+			}
+			report.Errors++
+			report.Cases = append(report.Cases, result)
+			continue
+		}
+
+		result.Actual = actual
+		result.Fields, result.Diff = ScoreQuery(c.Expected, *actual)
+		result.Correct = len(result.Diff) == 0
+		if result.Correct {
+			correct++
+		}
+		for f, ok := range result.Fields {
+			if ok {
+				fieldCounts[f]++
+			}
+		}
+		report.Cases = append(report.Cases, result)
+	}
+
+	if len(cases) > 0 {
+		report.Accuracy = float64(correct) / float64(len(cases))
+	}
+	for _, f := range EvalFields {
+		if len(cases) > 0 {
+			report.FieldAccuracy[f] = float64(fieldCounts[f]) / float64(len(cases))
+		}
+	}
+	return report
+}
+
+// translateCase runs a single case through the translator and parses the output.
+func translateCase(t Translator, c EvalCase) (*HoneycombQuery, string, error) {
+	cols, err := json.Marshal(c.Columns)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "Failed to serialize columns")
+	}
+	output, err := t.Translate(QueryInput{
+		NLQ:  c.NLQ,
+		COLS: string(cols),
+	})
+	if err != nil {
+		return nil, output, err
+	}
+	q, err := ParseQuery(output)
+	if err != nil {
+		return nil, output, err
+	}
+	return q, output, nil
+}
+
+// ScoreQuery compares each field in EvalFields of the actual query to the expected query.
+// It returns whether each field matched and a description of the fields that didn't.
+// Lists are compared without regard to order.
+func ScoreQuery(expected HoneycombQuery, actual HoneycombQuery) (map[string]bool, []string) {
+	fields := make(map[string]bool)
+	diff := make([]string, 0)
+	for _, f := range EvalFields {
+		e := fieldKeys(f, expected)
+		a := fieldKeys(f, actual)
+		fields[f] = equalStrings(e, a)
+		if !fields[f] {
+			diff = append(diff, fmt.Sprintf("%s: expected %v; got %v", f, e, a))
+		}
+	}
+	return fields, diff
+}
+
+// fieldKeys returns a sorted list of strings representing the value of a field.
+// Two queries have semantically equal values for the field iff their keys are equal.
+func fieldKeys(field string, q HoneycombQuery) []string {
+	n := NormalizeQuery(q)
+	keys := make([]string, 0)
+	switch field {
+	case FieldBreakdowns:
+		keys = append(keys, n.Breakdowns...)
+	case FieldCalculations:
+		keys = calculationNames(n.Calculations)
+	case FieldFilters:
+		keys = filterStrings(n.Filters)
+		// The combination only matters when there is more than one filter.
+		if len(n.Filters) > 1 {
+			keys = append(keys, "combination "+n.FilterCombination)
+		}
+	case FieldOrders:
+		keys = orderStrings(n.Orders)
+	case FieldTimeRange:
+		keys = append(keys, strconv.Itoa(n.TimeRange))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// effectiveTimeRange returns the length of the query's time window in seconds.
+func effectiveTimeRange(q HoneycombQuery) int {
+	if q.StartTime != 0 && q.EndTime != 0 {
+		return q.EndTime - q.StartTime
+	}
+	if q.TimeRange != 0 {
+		return q.TimeRange
+	}
+	return defaultTimeRange
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Markdown renders the report as markdown.
+func (r *EvalReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Evaluation Report\n\n")
+	fmt.Fprintf(&b, "* Time: %s\n", r.Time.Format(time.RFC3339))
+	fmt.Fprintf(&b, "* Cases: %d\n", r.Total)
+	fmt.Fprintf(&b, "* Errors: %d\n", r.Errors)
+	fmt.Fprintf(&b, "* Accuracy: %.1f%%\n\n", 100*r.Accuracy)
+
+	fmt.Fprintf(&b, "## Field Accuracy\n\n")
+	fmt.Fprintf(&b, "| Field | Accuracy |\n|---|---|\n")
+	for _, f := range EvalFields {
+		fmt.Fprintf(&b, "| %s | %.1f%% |\n", f, 100*r.FieldAccuracy[f])
+	}
+
+	fmt.Fprintf(&b, "\n## Cases\n\n")
+	fmt.Fprintf(&b, "| Case | Correct | %s |\n", strings.Join(EvalFields, " | "))
+	fmt.Fprintf(&b, "|---|---|%s\n", strings.Repeat("---|", len(EvalFields)))
+	for _, c := range r.Cases {
+		marks := make([]string, 0, len(EvalFields))
+		for _, f := range EvalFields {
+			marks = append(marks, checkMark(c.Fields[f]))
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", c.Name, checkMark(c.Correct), strings.Join(marks, " | "))
+	}
+
+	for _, c := range r.Cases {
+		if c.Correct {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", c.Name)
+		fmt.Fprintf(&b, "NLQ: %s\n\n", c.NLQ)
+		if c.Error != "" {
+			fmt.Fprintf(&b, "Error: %s\n\n", c.Error)
+		}
+		if len(c.Diff) > 0 {
+			fmt.Fprintf(&b, "```\n%s\n```\n", strings.Join(c.Diff, "\n"))
+		}
+	}
+	return b.String()
+}
+
+func checkMark(ok bool) string {
+	if ok {
+		return "✅"
+	}
+	return "❌"
+}
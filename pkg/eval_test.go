@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeTranslator returns a canned output for each natural language query.
+type fakeTranslator struct {
+	outputs map[string]string
+}
+
+func (f *fakeTranslator) Translate(in QueryInput) (string, error) {
+	return f.outputs[in.NLQ], nil
+}
+
+func Test_RunEval(t *testing.T) {
+	translator := &fakeTranslator{
+		outputs: map[string]string{
+			"slowest routes": "{'breakdowns': ['http.route', 'name'], 'calculations': [{'column': 'duration_ms', 'op': 'P99'}], 'orders': [{'column': 'duration_ms', 'op': 'P99', 'order': 'descending'}]}",
+			"errors by name": "{'breakdowns': ['name'], 'calculations': [{'op': 'COUNT'}], 'time_range': 3600}",
+			"garbage":        "not a query",
+		},
+	}
+
+	cases := []EvalCase{
+		{
+			Name: "slowest",
+			NLQ:  "slowest routes",
+			Expected: HoneycombQuery{
+				Breakdowns:   []string{"name", "http.route"},
+				Calculations: []Calculation{{Op: "P99", Column: "duration_ms"}},
+				Orders:       []Order{{Op: "P99", Column: "duration_ms", Order: "descending"}},
+				TimeRange:    7200,
+			},
+		},
+		{
+			Name: "errors",
+			NLQ:  "errors by name",
+			Expected: HoneycombQuery{
+				Breakdowns:   []string{"name"},
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Op: "exists", Column: "error"}},
+				TimeRange:    7200,
+			},
+		},
+		{
+			Name: "garbage",
+			NLQ:  "garbage",
+		},
+	}
+
+	report := RunEval(translator, cases)
+
+	if report.Errors != 1 {
+		t.Errorf("Expected 1 error; got %d", report.Errors)
+	}
+
+	correct := make([]bool, 0, len(report.Cases))
+	for _, c := range report.Cases {
+		correct = append(correct, c.Correct)
+	}
+	if d := cmp.Diff([]bool{true, false, false}, correct); d != "" {
+		t.Errorf("Unexpected correctness;diff:\n%v", d)
+	}
+
+	expected := map[string]float64{
+		FieldBreakdowns:   2.0 / 3,
+		FieldCalculations: 2.0 / 3,
+		FieldFilters:      1.0 / 3,
+		FieldOrders:       2.0 / 3,
+		FieldTimeRange:    1.0 / 3,
+	}
+	if d := cmp.Diff(expected, report.FieldAccuracy); d != "" {
+		t.Errorf("Unexpected field accuracy;diff:\n%v", d)
+	}
+}
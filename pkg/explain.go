@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TemplateExplainer is the name of the explainer used by ExplainQuery.
+const TemplateExplainer = "template"
+
+// Explainer describes queries in plain English; it is implemented by translators that can do more than answer
+// single questions e.g. ChatClient.
+type Explainer interface {
+	// Explain returns a description of the query. literal is the description produced by ExplainQuery which the
+	// explanation should agree with.
+	Explain(q HoneycombQuery, literal string) (*Translation, error)
+}
+
+// calculationDescriptions describe the calculations; %s is the column.
+var calculationDescriptions = map[string]string{
+	"SUM":            "the sum of %s",
+	"AVG":            "the average %s",
+	"MAX":            "the maximum %s",
+	"MIN":            "the minimum %s",
+	"COUNT_DISTINCT": "the number of distinct values of %s",
+	"HEATMAP":        "a heatmap of %s",
+	"RATE_AVG":       "the rate of change of the average %s",
+	"RATE_SUM":       "the rate of change of the sum of %s",
+	"RATE_MAX":       "the rate of change of the maximum %s",
+}
+
+// filterDescriptions describe the filter operators; the first %s is the column and the second the value.
+var filterDescriptions = map[string]string{
+	"=":                   "%s is %s",
+	"!=":                  "%s is not %s",
+	">":                   "%s is greater than %s",
+	">=":                  "%s is at least %s",
+	"<":                   "%s is less than %s",
+	"<=":                  "%s is at most %s",
+	"starts-with":         "%s starts with %s",
+	"does-not-start-with": "%s doesn't start with %s",
+	"ends-with":           "%s ends with %s",
+	"does-not-end-with":   "%s doesn't end with %s",
+	"contains":            "%s contains %s",
+	"does-not-contain":    "%s doesn't contain %s",
+	"exists":              "%s exists",
+	"does-not-exist":      "%s doesn't exist",
+	"in":                  "%s is one of %s",
+	"not-in":              "%s is not one of %s",
+}
+
+// ExplainQuery describes the query in plain English e.g.
+//
+//	P99 of duration_ms for root spans where error exists, grouped by http.route, over the last 7 days
+//
+// The description is produced from templates so the same query is always described the same way.
+func ExplainQuery(q HoneycombQuery) string {
+	calcs := make([]string, 0, len(q.Calculations))
+	for _, c := range q.Calculations {
+		calcs = append(calcs, explainCalculation(c.Op, columnName(c.Column)))
+	}
+	if len(calcs) == 0 {
+		calcs = append(calcs, explainCalculation("COUNT", ""))
+	}
+	s := joinWords(calcs, "and")
+
+	// Filtering on a missing parent is how root spans are selected so it gets a name of its own.
+	filters := make([]string, 0, len(q.Filters))
+	rootSpans := false
+	for _, f := range q.Filters {
+		if q.FilterCombination != "OR" && f.Op == "does-not-exist" && columnName(f.Column) == "trace.parent_id" {
+			rootSpans = true
+			continue
+		}
+		filters = append(filters, explainFilter(f))
+	}
+	if rootSpans {
+		s += " for root spans"
+	}
+	if len(filters) > 0 {
+		combination := "and"
+		if q.FilterCombination == "OR" {
+			combination = "or"
+		}
+		s += " where " + joinWords(filters, combination)
+	}
+
+	clauses := []string{s}
+	if len(q.Breakdowns) > 0 {
+		clauses = append(clauses, "grouped by "+joinWords(q.Breakdowns, "and"))
+	}
+	if len(q.Havings) > 0 {
+		havings := make([]string, 0, len(q.Havings))
+		for _, h := range q.Havings {
+			havings = append(havings, explainHaving(h))
+		}
+		clauses = append(clauses, "only including groups where "+joinWords(havings, "and"))
+	}
+	if len(q.Orders) > 0 {
+		orders := make([]string, 0, len(q.Orders))
+		for _, o := range q.Orders {
+			orders = append(orders, explainOrder(o))
+		}
+		clauses = append(clauses, "ordered by "+joinWords(orders, "then"))
+	}
+	if q.Limit > 0 {
+		clauses = append(clauses, fmt.Sprintf("limited to %d results", q.Limit))
+	}
+	if t := explainTime(q); t != "" {
+		clauses = append(clauses, t)
+	}
+	if q.Granularity > 0 {
+		clauses = append(clauses, "in intervals of "+explainDuration(q.Granularity))
+	}
+	return capitalize(strings.Join(clauses, ", "))
+}
+
+// RunExplainer returns a richer explanation of the query from the explainer; see Explainer.
+func RunExplainer(e Explainer, q HoneycombQuery) (*Translation, error) {
+	t, err := e.Explain(q, ExplainQuery(q))
+	if err != nil {
+		return nil, err
+	}
+	t.Output = strings.TrimSpace(t.Output)
+	if t.Output == "" {
+		return nil, errors.New("The explanation is empty")
+	}
+	return t, nil
+}
+
+func explainCalculation(op string, col string) string {
+	op = strings.ToUpper(op)
+	switch {
+	case op == "COUNT":
+		return "the count of events"
+	case op == "CONCURRENCY":
+		return "the concurrency of spans"
+	case percentiles[op] != 0:
+		return fmt.Sprintf("%s of %s", op, col)
+	}
+	if d, ok := calculationDescriptions[op]; ok {
+		return fmt.Sprintf(d, col)
+	}
+	return CalculationName(Calculation{Op: op, Column: col})
+}
+
+func explainFilter(f Filter) string {
+	col := columnName(f.Column)
+	d, ok := filterDescriptions[f.Op]
+	if !ok {
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s", col, f.Op, f.Value))
+	}
+	switch {
+	case filterOpsWithoutValue[f.Op]:
+		return fmt.Sprintf(d, col)
+	case f.Op == "in" || f.Op == "not-in":
+		return fmt.Sprintf(d, col, joinWords(f.ListValues(), "or"))
+	}
+	return fmt.Sprintf(d, col, f.Value)
+}
+
+func explainHaving(h Having) string {
+	calc := explainCalculation(h.CalculateOp, columnName(h.Column))
+	d, ok := filterDescriptions[h.Op]
+	if !ok {
+		return fmt.Sprintf("%s %s %s", calc, h.Op, formatValue(h.Value))
+	}
+	return fmt.Sprintf(d, calc, formatValue(h.Value))
+}
+
+func explainOrder(o Order) string {
+	s := o.Column
+	if o.Op != "" {
+		s = explainCalculation(o.Op, o.Column)
+	}
+	if strings.HasPrefix(strings.ToLower(o.Order), "desc") {
+		return s + " from highest to lowest"
+	}
+	return s + " from lowest to highest"
+}
+
+// explainTime describes the time range of the query.
+func explainTime(q HoneycombQuery) string {
+	format := func(seconds int) string {
+		return time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+	}
+	switch {
+	case q.StartTime != 0 && q.EndTime != 0:
+		return fmt.Sprintf("from %s to %s", format(q.StartTime), format(q.EndTime))
+	case q.TimeRange != 0 && q.EndTime != 0:
+		return fmt.Sprintf("over the %s before %s", explainDuration(q.TimeRange), format(q.EndTime))
+	case q.TimeRange != 0 && q.StartTime != 0:
+		return fmt.Sprintf("over the %s after %s", explainDuration(q.TimeRange), format(q.StartTime))
+	case q.TimeRange != 0:
+		// The last hour rather than the last 1 hour.
+		return "over the last " + strings.TrimPrefix(explainDuration(q.TimeRange), "1 ")
+	case q.StartTime != 0:
+		return "since " + format(q.StartTime)
+	}
+	return ""
+}
+
+// explainDuration describes a number of seconds using the largest unit that divides it evenly e.g. 604800 is
+// 7 days and 3600 is 1 hour.
+func explainDuration(seconds int) string {
+	units := []struct {
+		name    string
+		seconds int
+	}{{"day", 86400}, {"hour", 3600}, {"minute", 60}}
+	for _, u := range units {
+		if seconds%u.seconds == 0 {
+			n := seconds / u.seconds
+			if n == 1 {
+				return "1 " + u.name
+			}
+			return fmt.Sprintf("%d %ss", n, u.name)
+		}
+	}
+	if seconds == 1 {
+		return "1 second"
+	}
+	return fmt.Sprintf("%d seconds", seconds)
+}
+
+// joinWords joins the words as a list in a sentence e.g. a, b and c.
+func joinWords(words []string, conjunction string) string {
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " " + conjunction + " " + words[len(words)-1]
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ExplainQuery(t *testing.T) {
+	type testCase struct {
+		name     string
+		query    string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			name:     "root-spans",
+			query:    "P99(duration_ms) WHERE trace.parent_id does-not-exist AND error exists GROUP BY http.route LAST 7d",
+			expected: "P99 of duration_ms for root spans where error exists, grouped by http.route, over the last 7 days",
+		},
+		{
+			name:     "count",
+			query:    "COUNT LAST 1h",
+			expected: "The count of events, over the last hour",
+		},
+		{
+			name:     "no-calculations",
+			query:    `{"breakdowns": ["name"], "time_range": 7200}`,
+			expected: "The count of events, grouped by name, over the last 2 hours",
+		},
+		{
+			name:  "everything",
+			query: "COUNT, AVG(duration_ms) WHERE status_code >= 500 OR service.name in (api, web) GROUP BY service.name, name HAVING COUNT > 10 ORDER BY COUNT desc LIMIT 5 FROM 2026-10-01T00:00:00Z TO 2026-10-02T00:00:00Z GRANULARITY 1h",
+			expected: "The count of events and the average duration_ms where status_code is at least 500 or service.name is one of api or web, " +
+				"grouped by service.name and name, only including groups where the count of events is greater than 10, " +
+				"ordered by the count of events from highest to lowest, limited to 5 results, " +
+				"from 2026-10-01T00:00:00Z to 2026-10-02T00:00:00Z, in intervals of 1 hour",
+		},
+		{
+			name:     "order-by-breakdown",
+			query:    "COUNT_DISTINCT(user.id), HEATMAP(duration_ms) WHERE name != healthz GROUP BY region ORDER BY region asc LAST 90m",
+			expected: "The number of distinct values of user.id and a heatmap of duration_ms where name is not healthz, grouped by region, ordered by region from lowest to highest, over the last 90 minutes",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q, err := ParseAnyQuery(c.query)
+			if err != nil {
+				t.Fatalf("Failed to parse query; %v", err)
+			}
+			if d := cmp.Diff(c.expected, ExplainQuery(*q)); d != "" {
+				t.Errorf("Unexpected explanation;diff:\n%v", d)
+			}
+		})
+	}
+}
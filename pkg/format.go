@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats supported by FormatQuery.
+const (
+	FormatJSON    = "json"
+	FormatCompact = "compact"
+	FormatYAML    = "yaml"
+	FormatText    = "text"
+)
+
+// FormatQuery serializes a query in a canonical form.
+// Keys are sorted and empty fields and fields set to Honeycomb's defaults (filter_combination AND, limit 1000 and
+// time_range 7200) are removed.
+// The order of list elements is preserved because it controls how Honeycomb displays the results.
+// format is one of FormatJSON (indented), FormatCompact (single line JSON), FormatYAML or FormatText which
+// uses the syntax of ParseTextQuery.
+func FormatQuery(q HoneycombQuery, format string) ([]byte, error) {
+	if format == FormatText {
+		return []byte(FormatTextQuery(q) + "\n"), nil
+	}
+
+	m, err := canonicalQueryMap(q)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJSON, FormatCompact:
+		// Encode rather than Marshal so operators such as > aren't escaped for HTML.
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if format == FormatJSON {
+			enc.SetIndent("", "  ")
+		}
+		if err := enc.Encode(m); err != nil {
+			return nil, errors.Wrapf(err, "Failed to serialize query")
+		}
+		return buf.Bytes(), nil
+	case FormatYAML:
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(m); err != nil {
+			return nil, errors.Wrapf(err, "Failed to serialize query")
+		}
+		if err := enc.Close(); err != nil {
+			return nil, errors.Wrapf(err, "Failed to serialize query")
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errors.Errorf("Unsupported format %v; format should be one of %v, %v, %v or %v", format, FormatJSON, FormatCompact, FormatYAML, FormatText)
+	}
+}
+
+// canonicalQueryMap converts the query to a map with empty and default values removed.
+// Encoding a map rather than the struct is what gives us sorted keys.
+func canonicalQueryMap(q HoneycombQuery) (map[string]interface{}, error) {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to serialize query")
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrapf(err, "Failed to deserialize query")
+	}
+
+	if fc, ok := m["filter_combination"].(string); ok && (fc == "AND" || fc == "and") {
+		delete(m, "filter_combination")
+	}
+	if q.Limit == defaultLimit {
+		delete(m, "limit")
+	}
+	// With both a start and end time the time range is implied by them so it isn't a default.
+	if q.TimeRange == defaultTimeRange && (q.StartTime == 0 || q.EndTime == 0) {
+		delete(m, "time_range")
+	}
+	pruneEmpty(m)
+	return m, nil
+}
+
+// pruneEmpty removes top level fields that are null, empty strings, zeros, false or empty lists and maps.
+// Nested fields aren't pruned; zero and false are meaningful values of filters and havings e.g. COUNT > 0.
+func pruneEmpty(m map[string]interface{}) {
+	for k, v := range m {
+		switch t := v.(type) {
+		case nil:
+			delete(m, k)
+		case string:
+			if t == "" {
+				delete(m, k)
+			}
+		case float64:
+			if t == 0 {
+				delete(m, k)
+			}
+		case bool:
+			if !t {
+				delete(m, k)
+			}
+		case []interface{}:
+			if len(t) == 0 {
+				delete(m, k)
+			}
+		case map[string]interface{}:
+			if len(t) == 0 {
+				delete(m, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_FormatQuery(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		format   string
+		expected string
+	}
+
+	cases := []testCase{
+		{
+			name:   "python-to-json",
+			input:  "{'time_range': 7200, 'filter_combination': 'AND', 'calculations': [{'op': 'COUNT'}], 'breakdowns': ['name'], 'filters': [], 'granularity': 0, 'limit': 1000}",
+			format: FormatJSON,
+			expected: `{
+  "breakdowns": [
+    "name"
+  ],
+  "calculations": [
+    {
+      "op": "COUNT"
+    }
+  ]
+}
+`,
+		},
+		{
+			name:     "escaped-to-compact",
+			input:    `{\"breakdowns\": [\"http.method\"], \"calculations\": [{\"op\": \"COUNT\"}], \"filters\": [{\"column\": \"http.method\", \"op\": \"exists\"}, {\"column\": \"http.status_code\", \"op\": \">=\", \"value\": \"500\"}], \"filter_combination\": \"OR\"}`,
+			format:   FormatCompact,
+			expected: `{"breakdowns":["http.method"],"calculations":[{"op":"COUNT"}],"filter_combination":"OR","filters":[{"column":"http.method","op":"exists"},{"column":"http.status_code","op":">=","value":"500"}]}` + "\n",
+		},
+		{
+			name:     "zero-having-and-false-filter",
+			input:    `{"calculations":[{"op":"COUNT"}],"filters":[{"column":"error","op":"=","value":false}],"havings":[{"calculate_op":"COUNT","op":">","value":0}]}`,
+			format:   FormatCompact,
+			expected: `{"calculations":[{"op":"COUNT"}],"filters":[{"column":"error","op":"=","value":false}],"havings":[{"calculate_op":"COUNT","op":">","value":0}]}` + "\n",
+		},
+		{
+			name:   "quoted-to-yaml",
+			input:  `"{\"breakdowns\": [\"name\"], \"time_range\": 604800}"`,
+			format: FormatYAML,
+			expected: `breakdowns:
+  - name
+time_range: 604800
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q, err := ParseQuery(c.input)
+			if err != nil {
+				t.Fatalf("Failed to parse query; %v", err)
+			}
+			actual, err := FormatQuery(*q, c.format)
+			if err != nil {
+				t.Fatalf("Failed to format query; %v", err)
+			}
+			if d := cmp.Diff(c.expected, string(actual)); d != "" {
+				t.Fatalf("Unexpected output;diff:\n%v", d)
+			}
+		})
+	}
+}
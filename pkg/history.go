@@ -0,0 +1,231 @@
+package pkg
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	historyFile       = "history.jsonl"
+	historyColumnsDir = "columns"
+)
+
+// HistoryEntry records a single translation of a natural language question into a query.
+type HistoryEntry struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	NLQ     string    `json:"nlq"`
+	Dataset string    `json:"dataset,omitempty"`
+	// ColumnsHash identifies the columns passed to the translator; the columns are stored separately so they can be
+	// reused by replay without bloating the history.
+	ColumnsHash string `json:"columnsHash"`
+	// Translator identifies the backend; see TranslatorName.
+	Translator string `json:"translator"`
+	Model      string `json:"model,omitempty"`
+	Version    string `json:"version,omitempty"`
+	// Output is the raw output of the translator.
+	Output string          `json:"output,omitempty"`
+	Query  *HoneycombQuery `json:"query,omitempty"`
+	// PredictTime is the time in seconds the backend reported the model spent on the prediction.
+	PredictTime float64 `json:"predictTime,omitempty"`
+	// Latency is the time in seconds the translation took as measured by hccli.
+	Latency float64 `json:"latency"`
+	// Error is set if the translation failed.
+	Error string `json:"error,omitempty"`
+	// ParseError is set if the output couldn't be parsed as a query.
+	ParseError string `json:"parseError,omitempty"`
+	// ReplayOf is the ID of the entry this translation replayed.
+	ReplayOf string `json:"replayOf,omitempty"`
+	// Refines is the query that was changed if NLQ is an instruction to refine a query; see RunRefinement.
+	Refines *HoneycombQuery `json:"refines,omitempty"`
+}
+
+// RunTranslation translates the question and returns an entry describing the translation.
+// Errors are recorded in the entry so failed translations can be kept in the history; translation errors are
+// also returned. The output failing to parse as a query isn't treated as an error.
+func RunTranslation(t Translator, in QueryInput) (*HistoryEntry, error) {
+	return runTranslation(in.NLQ, in.COLS, func() (*Translation, error) {
+		return TranslateDetailed(t, in)
+	})
+}
+
+// runTranslation runs translate and returns an entry describing the translation of nlq; see RunTranslation.
+func runTranslation(nlq string, cols string, translate func() (*Translation, error)) (*HistoryEntry, error) {
+	start := time.Now()
+	e := &HistoryEntry{
+		Time:        start,
+		NLQ:         nlq,
+		ColumnsHash: hashColumns(cols),
+	}
+	e.ID = historyID(e)
+
+	translation, err := translate()
+	e.Latency = time.Since(start).Seconds()
+	if err != nil {
+		e.Error = err.Error()
+		return e, err
+	}
+	e.Output = translation.Output
+	e.Model = translation.Model
+	e.Version = translation.Version
+	e.PredictTime = translation.PredictTime
+
+	q, err := ParseQuery(translation.Output)
+	if err != nil {
+		e.ParseError = err.Error()
+		return e, nil
+	}
+	e.Query = q
+	return e, nil
+}
+
+// HistoryStore is a local store of translations.
+// Entries are appended to a JSONL file and the columns are stored once per distinct set of columns.
+type HistoryStore struct {
+	Dir string
+}
+
+// Append adds the entry to the history and stores its columns.
+func (s *HistoryStore) Append(e *HistoryEntry, cols string) error {
+	if err := os.MkdirAll(filepath.Join(s.Dir, historyColumnsDir), 0700); err != nil {
+		return errors.Wrapf(err, "Failed to create history directory %v", s.Dir)
+	}
+
+	colsFile := filepath.Join(s.Dir, historyColumnsDir, e.ColumnsHash+".json")
+	if _, err := os.Stat(colsFile); os.IsNotExist(err) {
+		if err := os.WriteFile(colsFile, []byte(cols), 0600); err != nil {
+			return errors.Wrapf(err, "Failed to write columns %v", colsFile)
+		}
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize history entry")
+	}
+	f, err := os.OpenFile(filepath.Join(s.Dir, historyFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to open history file")
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return errors.Wrapf(err, "Failed to write history entry")
+	}
+	return nil
+}
+
+// List returns the entries in the order they were recorded.
+// A missing history is treated as empty.
+func (s *HistoryStore) List() ([]HistoryEntry, error) {
+	entries := make([]HistoryEntry, 0)
+	f, err := os.Open(filepath.Join(s.Dir, historyFile))
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open history file")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		e := HistoryEntry{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse history entry %d", len(entries)+1)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to read history file")
+	}
+	return entries, nil
+}
+
+// Get returns the entry with the given ID; a unique prefix of the ID is also accepted.
+func (s *HistoryStore) Get(id string) (*HistoryEntry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var match *HistoryEntry
+	for i := range entries {
+		if entries[i].ID == id {
+			return &entries[i], nil
+		}
+		if id != "" && strings.HasPrefix(entries[i].ID, id) {
+			if match != nil {
+				return nil, errors.Errorf("History ID %v is ambiguous", id)
+			}
+			match = &entries[i]
+		}
+	}
+	if match == nil {
+		return nil, errors.Errorf("History entry %v not found", id)
+	}
+	return match, nil
+}
+
+// Columns returns the columns stored for the hash.
+func (s *HistoryStore) Columns(hash string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(s.Dir, historyColumnsDir, hash+".json"))
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read columns %v", hash)
+	}
+	return string(b), nil
+}
+
+// WriteHistoryCSV writes the entries as CSV. The query is written in the compact JSON format.
+func WriteHistoryCSV(w io.Writer, entries []HistoryEntry) error {
+	cw := csv.NewWriter(w)
+	header := []string{"id", "time", "nlq", "dataset", "columns_hash", "translator", "model", "version", "output", "query", "predict_time", "latency", "error", "parse_error", "replay_of"}
+	if err := cw.Write(header); err != nil {
+		return errors.Wrapf(err, "Failed to write CSV")
+	}
+	for _, e := range entries {
+		query := ""
+		if e.Query != nil {
+			b, err := FormatQuery(*e.Query, FormatCompact)
+			if err != nil {
+				return err
+			}
+			query = strings.TrimSpace(string(b))
+		}
+		row := []string{
+			e.ID, e.Time.Format(time.RFC3339), e.NLQ, e.Dataset, e.ColumnsHash, e.Translator, e.Model, e.Version,
+			e.Output, query, strconv.FormatFloat(e.PredictTime, 'f', -1, 64), strconv.FormatFloat(e.Latency, 'f', -1, 64),
+			e.Error, e.ParseError, e.ReplayOf,
+		}
+		if err := cw.Write(row); err != nil {
+			return errors.Wrapf(err, "Failed to write CSV")
+		}
+	}
+	cw.Flush()
+	return errors.Wrapf(cw.Error(), "Failed to write CSV")
+}
+
+// hashColumns returns a short hash identifying the columns.
+func hashColumns(cols string) string {
+	sum := sha256.Sum256([]byte(cols))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// historyID returns an ID for the entry that sorts by time.
+func historyID(e *HistoryEntry) string {
+	sum := sha256.Sum256([]byte(e.Time.Format(time.RFC3339Nano) + e.NLQ))
+	return e.Time.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(sum[:])[:6]
+}
@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+// detailedTranslator reports metadata about its predictions and fails for unknown questions.
+type detailedTranslator struct {
+	outputs map[string]string
+}
+
+func (d *detailedTranslator) Translate(in QueryInput) (string, error) {
+	t, err := d.TranslateDetailed(in)
+	if err != nil {
+		return "", err
+	}
+	return t.Output, nil
+}
+
+func (d *detailedTranslator) TranslateDetailed(in QueryInput) (*Translation, error) {
+	output, ok := d.outputs[in.NLQ]
+	if !ok {
+		return nil, errors.Errorf("No output for %v", in.NLQ)
+	}
+	return &Translation{Output: output, Model: "owner/model", Version: "v1", PredictTime: 0.25}, nil
+}
+
+func Test_History(t *testing.T) {
+	translator := &detailedTranslator{
+		outputs: map[string]string{
+			"errors by name": "{'breakdowns': ['name'], 'calculations': [{'op': 'COUNT'}]}",
+			"garbage":        "not a query",
+		},
+	}
+	store := &HistoryStore{Dir: t.TempDir()}
+	cols := `["name", "duration_ms"]`
+
+	ok, err := RunTranslation(translator, QueryInput{NLQ: "errors by name", COLS: cols})
+	if err != nil {
+		t.Fatalf("Failed to translate; %v", err)
+	}
+	expected := &HoneycombQuery{Breakdowns: []string{"name"}, Calculations: []Calculation{{Op: "COUNT"}}}
+	if d := cmp.Diff(expected, ok.Query); d != "" {
+		t.Errorf("Unexpected query;diff:\n%v", d)
+	}
+	if ok.Model != "owner/model" || ok.Version != "v1" || ok.PredictTime != 0.25 {
+		t.Errorf("Translation metadata wasn't recorded; got %+v", ok)
+	}
+
+	unparsed, err := RunTranslation(translator, QueryInput{NLQ: "garbage", COLS: cols})
+	if err != nil {
+		t.Fatalf("Failed to translate; %v", err)
+	}
+	if unparsed.Query != nil || unparsed.ParseError == "" {
+		t.Errorf("Expected a parse error; got %+v", unparsed)
+	}
+
+	failed, err := RunTranslation(translator, QueryInput{NLQ: "unknown", COLS: cols})
+	if err == nil || failed.Error == "" {
+		t.Errorf("Expected the translation error to be returned and recorded; got %+v", failed)
+	}
+
+	for _, e := range []*HistoryEntry{ok, unparsed, failed} {
+		if err := store.Append(e, cols); err != nil {
+			t.Fatalf("Failed to append entry; %v", err)
+		}
+	}
+
+	entries, err := store.List()
+	if err != nil {
+		t.Fatalf("Failed to list history; %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries; got %d", len(entries))
+	}
+	if d := cmp.Diff(ok.Query, entries[0].Query); d != "" {
+		t.Errorf("Unexpected query after round trip;diff:\n%v", d)
+	}
+
+	actual, err := store.Get(ok.ID)
+	if err != nil {
+		t.Fatalf("Failed to get entry; %v", err)
+	}
+	if actual.NLQ != "errors by name" {
+		t.Errorf("Got the wrong entry %+v", actual)
+	}
+
+	actualCols, err := store.Columns(actual.ColumnsHash)
+	if err != nil {
+		t.Fatalf("Failed to read columns; %v", err)
+	}
+	if actualCols != cols {
+		t.Errorf("Unexpected columns %v", actualCols)
+	}
+
+	if _, err := store.Get("missing"); err == nil {
+		t.Errorf("Expected an error for a missing entry")
+	}
+
+	var b bytes.Buffer
+	if err := WriteHistoryCSV(&b, entries); err != nil {
+		t.Fatalf("Failed to write CSV; %v", err)
+	}
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV; %v", err)
+	}
+	if len(rows) != 4 {
+		t.Errorf("Expected a header and 3 rows; got %d rows", len(rows))
+	}
+}
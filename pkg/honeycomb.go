@@ -2,16 +2,19 @@ package pkg
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/go-logr/zapr"
 	"github.com/jlewi/hccli/pkg/config"
-	"github.com/jlewi/hydros/pkg/files"
+	"github.com/jlewi/hccli/pkg/secrets"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -23,17 +26,14 @@ const (
 
 type HoneycombClient struct {
 	apiKey string
+	// client sends the requests; http.DefaultClient is used if it is nil.
+	client *http.Client
 }
 
 func NewHoneycombClient(config config.Config) (*HoneycombClient, error) {
-	apiKeyBytes, err := files.Read(config.HoneycombAPIKeyFile)
+	apiKey, err := secrets.Resolve(config.HoneycombAPIKeyFile)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to read honeycomb API key from file %s", config.HoneycombAPIKeyFile)
-	}
-
-	apiKey := strings.TrimSpace(string(apiKeyBytes))
-	if apiKey == "" {
-		return nil, errors.New("Honeycomb API key is empty")
+		return nil, errors.Wrapf(err, "Failed to read honeycomb API key from %s", config.HoneycombAPIKeyFile)
 	}
 
 	return &HoneycombClient{
@@ -41,6 +41,13 @@ func NewHoneycombClient(config config.Config) (*HoneycombClient, error) {
 	}, nil
 }
 
+// Environment returns an identifier for the Honeycomb environment the client's API key belongs to.
+// API keys are scoped to an environment so a hash of the key identifies it without storing the key.
+func (h *HoneycombClient) Environment() string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(h.apiKey)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
 type HoneycombColumn struct {
 	Id          string    `json:"id,omitempty"`
 	KeyName     string    `json:"key_name,omitempty"`
@@ -93,34 +100,288 @@ func (h *HoneycombClient) GetColumns(datasetSlug string) ([]HoneycombColumn, err
 }
 
 type HoneycombQuery struct {
-	ID           *string  `json:"id,omitempty"`
-	Breakdowns   []string `json:"breakdowns,omitempty"`
-	Calculations []struct {
-		Op     string      `json:"op,omitempty"`
-		Column interface{} `json:"column,omitempty"`
-	} `json:"calculations,omitempty"`
-	Filters []struct {
-		Op     string      `json:"op,omitempty"`
-		Column interface{} `json:"column,omitempty"`
-		Value  string      `json:"value,omitempty"`
-	} `json:"filters"`
-	FilterCombination string `json:"filter_combination,omitempty"`
-	Granularity       int    `json:"granularity,omitempty"`
-	Orders            []struct {
-		Column string `json:"column,omitempty"`
-		Op     string `json:"op,omitempty"`
-		Order  string `json:"order,omitempty"`
-	} `json:"orders,omitempty"`
-	Limit     int `json:"limit,omitempty"`
-	StartTime int `json:"start_time,omitempty"`
-	EndTime   int `json:"end_time,omitempty"`
-	TimeRange int `json:"time_range,omitempty"`
-	Havings   []struct {
-		CalculateOp string      `json:"calculate_op,omitempty"`
-		Column      interface{} `json:"column,omitempty"`
-		Op          string      `json:"op,omitempty"`
-		Value       int         `json:"value,omitempty"`
-	} `json:"havings,omitempty"`
+	ID                *string       `json:"id,omitempty"`
+	Breakdowns        []string      `json:"breakdowns,omitempty"`
+	Calculations      []Calculation `json:"calculations,omitempty"`
+	Filters           []Filter      `json:"filters"`
+	FilterCombination string        `json:"filter_combination,omitempty"`
+	Granularity       int           `json:"granularity,omitempty"`
+	Orders            []Order       `json:"orders,omitempty"`
+	Limit             int           `json:"limit,omitempty"`
+	StartTime         int           `json:"start_time,omitempty"`
+	EndTime           int           `json:"end_time,omitempty"`
+	TimeRange         int           `json:"time_range,omitempty"`
+	Havings           []Having      `json:"havings,omitempty"`
+}
+
+// Calculation is a single calculation (e.g. COUNT or P99(duration_ms)) in a query.
+type Calculation struct {
+	Op     string      `json:"op,omitempty"`
+	Column interface{} `json:"column,omitempty"`
+}
+
+// Filter restricts the events a query operates on.
+type Filter struct {
+	Op     string      `json:"op,omitempty"`
+	Column interface{} `json:"column,omitempty"`
+	Value  string      `json:"value,omitempty"`
+	// Values are the values of list filters e.g. for the in and not-in operators. When they are set they are
+	// serialized as the list value in place of Value.
+	Values []string `json:"-"`
+	// RawValue is the JSON of a value that isn't a string or a list of strings e.g. 500, true or [200, 201].
+	// It is serialized in place of Value or Values while they still hold the same values so numbers and booleans
+	// from UI links and Honeycomb keep their type.
+	RawValue json.RawMessage `json:"-"`
+}
+
+// ListValues returns the values of a list filter. Lists written as a single string e.g. by the model are split on
+// commas; an empty value is an empty list.
+func (f Filter) ListValues() []string {
+	if f.Values != nil {
+		return f.Values
+	}
+	values := make([]string, 0)
+	if strings.TrimSpace(f.Value) == "" {
+		return values
+	}
+	for _, v := range strings.Split(f.Value, ",") {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return values
+}
+
+// MarshalJSON writes RawValue if it still matches the value of the filter otherwise it writes Values as the list
+// value of the filter if they are set.
+// HTML characters aren't escaped so operators in values e.g. > are readable in formatted queries and links.
+func (f Filter) MarshalJSON() ([]byte, error) {
+	type filter Filter
+	var v interface{} = filter(f)
+	switch {
+	case f.rawValueMatches():
+		v = struct {
+			filter
+			Value json.RawMessage `json:"value"`
+		}{filter: filter(f), Value: f.RawValue}
+	case f.Values != nil:
+		v = struct {
+			filter
+			Value []string `json:"value"`
+		}{filter: filter(f), Value: f.Values}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+// rawValueMatches returns true if RawValue is set and holds the same values as Value or Values i.e. they haven't
+// been changed since the filter was parsed.
+func (f Filter) rawValueMatches() bool {
+	raw := bytes.TrimSpace(f.RawValue)
+	if len(raw) == 0 {
+		return false
+	}
+	if raw[0] != '[' {
+		v, err := filterValue(raw)
+		return err == nil && f.Values == nil && v == f.Value
+	}
+	values, err := filterValues(raw)
+	if err != nil || f.Values == nil || len(values) != len(f.Values) {
+		return false
+	}
+	for i := range values {
+		if values[i] != f.Values[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// UnmarshalJSON accepts filter values of any JSON type. Filters on numeric and boolean columns have numeric and
+// boolean values in UI links and the queries returned by Honeycomb; Value holds their JSON text e.g. 500 or true and
+// RawValue keeps the JSON so they are written back with the same type. Lists e.g. for the in operator are stored in
+// Values.
+func (f *Filter) UnmarshalJSON(b []byte) error {
+	type filter Filter
+	raw := struct {
+		filter
+		Value json.RawMessage `json:"value,omitempty"`
+	}{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*f = Filter(raw.filter)
+	trimmed := bytes.TrimSpace(raw.Value)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		values, err := filterValues(trimmed)
+		if err != nil {
+			return err
+		}
+		f.Values = values
+	} else {
+		value, err := filterValue(trimmed)
+		if err != nil {
+			return err
+		}
+		f.Value = value
+	}
+	if isTypedValue(trimmed) {
+		f.RawValue = append(json.RawMessage{}, trimmed...)
+	}
+	return nil
+}
+
+// filterValues returns the string representations of the items of a list filter value.
+func filterValues(raw json.RawMessage) ([]string, error) {
+	items := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		v, err := filterValue(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// isTypedValue returns true if the JSON value is a number or boolean or a list containing one.
+func isTypedValue(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || raw[0] == '"' || string(raw) == "null" {
+		return false
+	}
+	if raw[0] != '[' {
+		return true
+	}
+	items := make([]json.RawMessage, 0)
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return false
+	}
+	for _, item := range items {
+		if isTypedValue(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterValue returns the string representation of a scalar filter value; see Filter.UnmarshalJSON.
+func filterValue(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	switch raw[0] {
+	case '"':
+		s := ""
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	case '[', '{':
+		return "", errors.Errorf("Filter value %s should be a string, number, boolean or list of them", raw)
+	default:
+		// Numbers and booleans.
+		return string(raw), nil
+	}
+}
+
+// Order controls how the results of a query are sorted.
+// If Op is set the results are ordered by that calculation otherwise they are ordered by the breakdown Column.
+type Order struct {
+	Column string `json:"column,omitempty"`
+	Op     string `json:"op,omitempty"`
+	Order  string `json:"order,omitempty"`
+}
+
+// Having filters the groups of a query based on the value of a calculation.
+type Having struct {
+	CalculateOp string      `json:"calculate_op,omitempty"`
+	Column      interface{} `json:"column,omitempty"`
+	Op          string      `json:"op,omitempty"`
+	Value       float64     `json:"value"`
+}
+
+// maxQueryLimit is the largest limit Honeycomb accepts.
+const maxQueryLimit = 1000
+
+// ValidateQuery checks that a query is well formed before it is sent to Honeycomb.
+// It catches mistakes such as unknown operators or orders that reference calculations not in the query.
+func ValidateQuery(q HoneycombQuery) error {
+	calcs := make(map[string]bool)
+	for _, c := range q.Calculations {
+		op := strings.ToUpper(c.Op)
+		if !calculationOps[op] {
+			return errors.Errorf("Calculation %v is not a Honeycomb calculation", c.Op)
+		}
+		if op != "COUNT" && op != "CONCURRENCY" && columnName(c.Column) == "" {
+			return errors.Errorf("Calculation %v requires a column", c.Op)
+		}
+		calcs[CalculationName(Calculation{Op: op, Column: c.Column})] = true
+	}
+
+	for _, f := range q.Filters {
+		if !isFilterOp(f.Op) {
+			return errors.Errorf("Filter operator %v is not a Honeycomb filter operator", f.Op)
+		}
+		if columnName(f.Column) == "" {
+			return errors.Errorf("Filter %v is missing a column", f.Op)
+		}
+	}
+
+	switch strings.ToUpper(q.FilterCombination) {
+	case "", "AND", "OR":
+	default:
+		return errors.Errorf("filter_combination %v is invalid; it should be AND or OR", q.FilterCombination)
+	}
+
+	breakdowns := make(map[string]bool)
+	for _, b := range q.Breakdowns {
+		breakdowns[b] = true
+	}
+	for _, o := range q.Orders {
+		switch {
+		case o.Op != "":
+			name := CalculationName(Calculation{Op: strings.ToUpper(o.Op), Column: o.Column})
+			// COUNT is the implicit calculation of a query without calculations.
+			if !calcs[name] && !(len(q.Calculations) == 0 && name == "COUNT") {
+				return errors.Errorf("Order %v refers to a calculation that isn't in the query", name)
+			}
+		case !breakdowns[o.Column]:
+			return errors.Errorf("Order by column %v refers to a column that isn't a breakdown", o.Column)
+		}
+	}
+
+	for _, h := range q.Havings {
+		name := CalculationName(Calculation{Op: strings.ToUpper(h.CalculateOp), Column: h.Column})
+		if !calcs[name] {
+			return errors.Errorf("Having %v refers to a calculation that isn't in the query", name)
+		}
+		if !isHavingOp(h.Op) {
+			return errors.Errorf("Having operator %v is not a Honeycomb having operator; it should be one of =, !=, >, >=, < or <=", h.Op)
+		}
+	}
+
+	if q.Limit < 0 || q.Limit > maxQueryLimit {
+		return errors.Errorf("Limit %d is out of range; it should be between 1 and %d", q.Limit, maxQueryLimit)
+	}
+	if q.StartTime != 0 && q.EndTime != 0 && q.TimeRange != 0 {
+		return errors.New("At most two of start_time, end_time and time_range can be set")
+	}
+	if q.StartTime != 0 && q.EndTime != 0 && q.StartTime >= q.EndTime {
+		return errors.Errorf("start_time %d should be before end_time %d", q.StartTime, q.EndTime)
+	}
+	if q.TimeRange < 0 || q.Granularity < 0 {
+		return errors.New("time_range and granularity can't be negative")
+	}
+	return nil
 }
 
 func (h *HoneycombClient) CreateQuery(datasetSlug string, q HoneycombQuery) (string, error) {
@@ -172,3 +433,173 @@ func (h *HoneycombClient) CreateQuery(datasetSlug string, q HoneycombQuery) (str
 	}
 	return id, nil
 }
+
+const (
+	// queryResultPollInterval is how often RunQuery checks whether a query result is complete.
+	queryResultPollInterval = time.Second
+	// queryResultTimeout is how long RunQuery waits for a query result.
+	queryResultTimeout = time.Minute
+)
+
+// queryResultResponse is the response of the Query Data API.
+type queryResultResponse struct {
+	ID       string      `json:"id"`
+	Complete bool        `json:"complete"`
+	Data     QueryResult `json:"data"`
+}
+
+// RunQuery runs the query using the Query Data API and waits for the results.
+// The query is created first since the Query Data API runs existing queries.
+// N.B. The Query Data API is only available on some Honeycomb plans and requires an API key with permission to run
+// queries.
+func (h *HoneycombClient) RunQuery(datasetSlug string, q HoneycombQuery) (*QueryResult, error) {
+	log := zapr.NewLogger(zap.L())
+	qid, err := h.CreateQuery(datasetSlug, q)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]interface{}{
+		"query_id":       qid,
+		"disable_series": true,
+	}
+	result := &queryResultResponse{}
+	endpoint := fmt.Sprintf("https://api.honeycomb.io/1/query_results/%s", datasetSlug)
+	log.Info("Running query", "endpoint", endpoint, "queryID", qid)
+	if err := h.do(http.MethodPost, endpoint, request, result); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(queryResultTimeout)
+	for !result.Complete {
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("Timed out waiting for query result %v", result.ID)
+		}
+		time.Sleep(queryResultPollInterval)
+		endpoint := fmt.Sprintf("https://api.honeycomb.io/1/query_results/%s/%s", datasetSlug, result.ID)
+		result = &queryResultResponse{}
+		if err := h.do(http.MethodGet, endpoint, nil, result); err != nil {
+			return nil, err
+		}
+	}
+	return &result.Data, nil
+}
+
+// do sends a request to the Honeycomb API and deserializes the response into out.
+// in is serialized as the JSON body of the request if it isn't nil.
+func (h *HoneycombClient) do(method string, endpoint string, in interface{}, out interface{}) error {
+	log := zapr.NewLogger(zap.L())
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to serialize request")
+		}
+		body = bytes.NewBuffer(b)
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to create request")
+	}
+	req.Header.Set(honeycombAPIKeyHeader, h.apiKey)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := h.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to send request")
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to read response body")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Info("Request failed", "endpoint", endpoint, "status", resp.StatusCode, "body", string(respBody))
+		return &HoneycombAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return errors.Wrapf(err, "Failed to deserialize response body")
+	}
+	return nil
+}
+
+// HoneycombAPIError is returned when the Honeycomb API responds with an error status.
+type HoneycombAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HoneycombAPIError) Error() string {
+	return fmt.Sprintf("Request failed with status code %v; body %v", e.StatusCode, e.Body)
+}
+
+// ListDatasets returns the datasets in the environment the API key belongs to.
+func (h *HoneycombClient) ListDatasets() ([]HoneycombDataset, error) {
+	log := zapr.NewLogger(zap.L())
+	endpoint := "https://api.honeycomb.io/1/datasets"
+	log.Info("Listing datasets", "endpoint", endpoint)
+	datasets := make([]HoneycombDataset, 0)
+	if err := h.do(http.MethodGet, endpoint, nil, &datasets); err != nil {
+		return nil, err
+	}
+	return datasets, nil
+}
+
+// GetQuery returns the query with the ID.
+func (h *HoneycombClient) GetQuery(datasetSlug string, id string) (*HoneycombQuery, error) {
+	log := zapr.NewLogger(zap.L())
+	endpoint := fmt.Sprintf("https://api.honeycomb.io/1/queries/%s/%s", url.PathEscape(datasetSlug), url.PathEscape(id))
+	log.Info("Getting query", "endpoint", endpoint)
+	q := &HoneycombQuery{}
+	if err := h.do(http.MethodGet, endpoint, nil, q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// GetResultQueryID returns the ID of the query that produced the query result.
+func (h *HoneycombClient) GetResultQueryID(datasetSlug string, resultID string) (string, error) {
+	log := zapr.NewLogger(zap.L())
+	endpoint := fmt.Sprintf("https://api.honeycomb.io/1/query_results/%s/%s", url.PathEscape(datasetSlug), url.PathEscape(resultID))
+	log.Info("Getting query result", "endpoint", endpoint)
+	result := struct {
+		QueryID string `json:"query_id"`
+	}{}
+	if err := h.do(http.MethodGet, endpoint, nil, &result); err != nil {
+		return "", err
+	}
+	if result.QueryID == "" {
+		return "", errors.Errorf("Query result %v doesn't include a query ID", resultID)
+	}
+	return result.QueryID, nil
+}
+
+// HoneycombAuth describes the team and environment an API key belongs to.
+type HoneycombAuth struct {
+	Team struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	} `json:"team"`
+	Environment struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	} `json:"environment"`
+}
+
+// Auth verifies the API key and returns the team and environment it belongs to.
+func (h *HoneycombClient) Auth() (*HoneycombAuth, error) {
+	auth := &HoneycombAuth{}
+	if err := h.do(http.MethodGet, "https://api.honeycomb.io/1/auth", nil, auth); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
@@ -2,10 +2,14 @@ package pkg
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/jlewi/hccli/pkg/app"
 	"github.com/jlewi/hydros/pkg/util"
 )
@@ -80,3 +84,156 @@ func Test_CreateQuery(t *testing.T) {
 	}
 	t.Logf("Created query %s", queryId)
 }
+
+// rewriteTransport sends every request to the server at url.
+type rewriteTransport struct {
+	url *url.URL
+}
+
+func (r *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = r.url.Scheme
+	req.URL.Host = r.url.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func Test_GetQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/queries/api/q1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"id":"q1","calculations":[{"op":"COUNT"}],"filters":[{"column":"http.status_code","op":">=","value":500},{"column":"duration_ms","op":">","value":1.5},{"column":"error","op":"=","value":false}],"time_range":7200}`))
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server URL; %v", err)
+	}
+
+	client := &HoneycombClient{apiKey: "key", client: &http.Client{Transport: &rewriteTransport{url: u}}}
+	q, err := client.GetQuery("api", "q1")
+	if err != nil {
+		t.Fatalf("Failed to get query; %v", err)
+	}
+	expected := &HoneycombQuery{
+		ID:           PtrToString("q1"),
+		Calculations: []Calculation{{Op: "COUNT"}},
+		Filters: []Filter{
+			{Column: "http.status_code", Op: ">=", Value: "500", RawValue: json.RawMessage("500")},
+			{Column: "duration_ms", Op: ">", Value: "1.5", RawValue: json.RawMessage("1.5")},
+			{Column: "error", Op: "=", Value: "false", RawValue: json.RawMessage("false")},
+		},
+		TimeRange: 7200,
+	}
+	if d := cmp.Diff(expected, q); d != "" {
+		t.Errorf("Unexpected query;diff:\n%v", d)
+	}
+}
+
+func Test_ValidateQuery(t *testing.T) {
+	type testCase struct {
+		name    string
+		query   HoneycombQuery
+		wantErr bool
+	}
+
+	cases := []testCase{
+		{
+			name: "valid",
+			query: HoneycombQuery{
+				Breakdowns:   []string{"name"},
+				Calculations: []Calculation{{Op: "COUNT"}, {Op: "P99", Column: "duration_ms"}},
+				Filters:      []Filter{{Op: "exists", Column: "error"}},
+				Orders:       []Order{{Op: "P99", Column: "duration_ms", Order: "descending"}, {Column: "name"}},
+				Havings:      []Having{{CalculateOp: "COUNT", Op: ">", Value: 10}},
+				TimeRange:    3600,
+			},
+		},
+		{
+			name:  "implicit-count-order",
+			query: HoneycombQuery{Orders: []Order{{Op: "COUNT", Order: "descending"}}},
+		},
+		{
+			name:    "unknown-calculation",
+			query:   HoneycombQuery{Calculations: []Calculation{{Op: "MEDIAN", Column: "duration_ms"}}},
+			wantErr: true,
+		},
+		{
+			name:    "calculation-missing-column",
+			query:   HoneycombQuery{Calculations: []Calculation{{Op: "AVG"}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown-filter",
+			query:   HoneycombQuery{Filters: []Filter{{Op: "like", Column: "name", Value: "a"}}},
+			wantErr: true,
+		},
+		{
+			name:    "order-not-in-calculations",
+			query:   HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}, Orders: []Order{{Op: "MAX", Column: "duration_ms"}}},
+			wantErr: true,
+		},
+		{
+			name:    "having-not-in-calculations",
+			query:   HoneycombQuery{Havings: []Having{{CalculateOp: "COUNT", Op: ">", Value: 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown-having-operator",
+			query:   HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}, Havings: []Having{{CalculateOp: "COUNT", Op: "=>", Value: 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "too-many-time-fields",
+			query:   HoneycombQuery{StartTime: 1, EndTime: 2, TimeRange: 1},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateQuery(c.query)
+			if c.wantErr && err == nil {
+				t.Errorf("Expected an error")
+			}
+			if !c.wantErr && err != nil {
+				t.Errorf("Unexpected error; %v", err)
+			}
+		})
+	}
+}
+
+func Test_FilterValueTypes(t *testing.T) {
+	in := `[{"op":"=","column":"status","value":500},{"op":"=","column":"error","value":false},{"op":"in","column":"code","value":[200,"a,b"]},{"op":"in","column":"name","value":["x","y"]},{"op":"=","column":"name","value":"500"}]`
+	filters := make([]Filter, 0)
+	if err := json.Unmarshal([]byte(in), &filters); err != nil {
+		t.Fatalf("Failed to parse filters; %v", err)
+	}
+	b, err := json.Marshal(filters)
+	if err != nil {
+		t.Fatalf("Failed to serialize filters; %v", err)
+	}
+	if d := cmp.Diff(in, string(b)); d != "" {
+		t.Errorf("Filter values should keep their type;diff:\n%v", d)
+	}
+
+	formatted, err := FormatQuery(HoneycombQuery{Filters: []Filter{filters[0], filters[2]}}, FormatCompact)
+	if err != nil {
+		t.Fatalf("Failed to format query; %v", err)
+	}
+	expected := `{"filters":[{"column":"status","op":"=","value":500},{"column":"code","op":"in","value":[200,"a,b"]}]}` + "\n"
+	if d := cmp.Diff(expected, string(formatted)); d != "" {
+		t.Errorf("Formatted filter values should keep their type;diff:\n%v", d)
+	}
+
+	// A value that has been changed is written as a string.
+	filters[0].Value = "404"
+	b, err = json.Marshal(filters[0])
+	if err != nil {
+		t.Fatalf("Failed to serialize filter; %v", err)
+	}
+	if d := cmp.Diff(`{"op":"=","column":"status","value":"404"}`, string(b)); d != "" {
+		t.Errorf("Changed value should be written as a string;diff:\n%v", d)
+	}
+}
@@ -0,0 +1,188 @@
+package pkg
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// queryNameRe is the pattern names of saved queries must match; names are used as file names.
+var queryNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// SavedQuery is a query stored in the local query library along with where it came from.
+type SavedQuery struct {
+	Name    string `json:"name"`
+	Dataset string `json:"dataset,omitempty"`
+	// NLQ is the natural language question the query was translated from.
+	NLQ string `json:"nlq,omitempty"`
+	// Translator identifies the model that translated the question; see TranslatorName.
+	Translator string    `json:"translator,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// QueryID and URL are set once the query has been created in Honeycomb.
+	QueryID string         `json:"queryID,omitempty"`
+	URL     string         `json:"url,omitempty"`
+	Query   HoneycombQuery `json:"query"`
+}
+
+// QueryLibrary is a directory of saved queries; each query is stored as a JSON file named after the query.
+type QueryLibrary struct {
+	Dir string
+}
+
+// Save writes the query to the library.
+// It is an error to overwrite an existing query unless overwrite is true.
+func (l *QueryLibrary) Save(q SavedQuery, overwrite bool) error {
+	if !queryNameRe.MatchString(q.Name) {
+		return errors.Errorf("Query name %q is invalid; names can only contain letters, digits, ., _ and -", q.Name)
+	}
+	if q.CreatedAt.IsZero() {
+		q.CreatedAt = time.Now()
+	}
+	path := l.path(q.Name)
+	if _, err := os.Stat(path); err == nil && !overwrite {
+		return errors.Errorf("Query %v already exists; use a different name or overwrite it", q.Name)
+	}
+
+	if err := os.MkdirAll(l.Dir, 0700); err != nil {
+		return errors.Wrapf(err, "Failed to create query library %v", l.Dir)
+	}
+	b, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "Failed to serialize query %v", q.Name)
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0600); err != nil {
+		return errors.Wrapf(err, "Failed to write query %v", path)
+	}
+	return nil
+}
+
+// Get returns the saved query with the given name.
+func (l *QueryLibrary) Get(name string) (*SavedQuery, error) {
+	if !queryNameRe.MatchString(name) {
+		return nil, errors.Errorf("Query name %q is invalid", name)
+	}
+	data, err := os.ReadFile(l.path(name))
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("Query %v not found in %v", name, l.Dir)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read query %v", name)
+	}
+	q := &SavedQuery{}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse query %v", l.path(name))
+	}
+	return q, nil
+}
+
+// List returns the saved queries sorted by name.
+// A missing directory is treated as empty.
+func (l *QueryLibrary) List() ([]SavedQuery, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if os.IsNotExist(err) {
+		return []SavedQuery{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read query library %v", l.Dir)
+	}
+
+	queries := make([]SavedQuery, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		q, err := l.Get(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, *q)
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].Name < queries[j].Name
+	})
+	return queries, nil
+}
+
+// Remove deletes the saved query with the given name.
+func (l *QueryLibrary) Remove(name string) error {
+	if _, err := l.Get(name); err != nil {
+		return err
+	}
+	if err := os.Remove(l.path(name)); err != nil {
+		return errors.Wrapf(err, "Failed to remove query %v", name)
+	}
+	return nil
+}
+
+// Search returns the saved queries whose name or natural language question fuzzily match the term.
+// The best matches come first; matches on the name rank above matches on the question.
+func (l *QueryLibrary) Search(term string) ([]SavedQuery, error) {
+	queries, err := l.List()
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		query SavedQuery
+		score int
+	}
+	matches := make([]match, 0, len(queries))
+	for _, q := range queries {
+		score := fuzzyScore(term, q.Name)
+		if score >= 0 {
+			score += 1000
+		}
+		if s := fuzzyScore(term, q.NLQ); s > score {
+			score = s
+		}
+		if score >= 0 {
+			matches = append(matches, match{query: q, score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	results := make([]SavedQuery, 0, len(matches))
+	for _, m := range matches {
+		results = append(results, m.query)
+	}
+	return results, nil
+}
+
+func (l *QueryLibrary) path(name string) string {
+	return filepath.Join(l.Dir, name+".json")
+}
+
+// fuzzyScore scores how well text matches the pattern ignoring case; higher is better and -1 means no match.
+// Substring matches score highest. Otherwise every word of the pattern must appear in the text in order as a
+// subsequence e.g. "err svc" matches "errors by service"; the fewer characters skipped the higher the score.
+func fuzzyScore(pattern string, text string) int {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	text = strings.ToLower(text)
+	if pattern == "" {
+		return 0
+	}
+	if i := strings.Index(text, pattern); i >= 0 {
+		return 500 - min(i, 499)
+	}
+
+	pattern = strings.Join(strings.Fields(pattern), "")
+	skipped := 0
+	pos := 0
+	for _, r := range pattern {
+		i := strings.IndexRune(text[pos:], r)
+		if i < 0 {
+			return -1
+		}
+		skipped += i
+		pos += i + len(string(r))
+	}
+	return 400 - min(skipped, 399)
+}
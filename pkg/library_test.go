@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_QueryLibrary(t *testing.T) {
+	lib := &QueryLibrary{Dir: t.TempDir()}
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	queries := []SavedQuery{
+		{
+			Name:       "slow-checkout",
+			Dataset:    "prod",
+			NLQ:        "what are the slowest checkout requests",
+			Translator: "endpoint:http://localhost:8080",
+			CreatedAt:  created,
+			Query:      HoneycombQuery{Calculations: []Calculation{{Op: "P99", Column: "duration_ms"}}},
+		},
+		{
+			Name:      "errors",
+			NLQ:       "count errors by service",
+			CreatedAt: created,
+			Query:     HoneycombQuery{Breakdowns: []string{"service.name"}, Calculations: []Calculation{{Op: "COUNT"}}},
+		},
+	}
+	for _, q := range queries {
+		if err := lib.Save(q, false); err != nil {
+			t.Fatalf("Failed to save %v; %v", q.Name, err)
+		}
+	}
+
+	if err := lib.Save(queries[0], false); err == nil {
+		t.Errorf("Expected an error saving a query that already exists")
+	}
+	if err := lib.Save(SavedQuery{Name: "../escape"}, false); err == nil {
+		t.Errorf("Expected an error saving a query with an invalid name")
+	}
+
+	actual, err := lib.Get("slow-checkout")
+	if err != nil {
+		t.Fatalf("Failed to get query; %v", err)
+	}
+	if d := cmp.Diff(queries[0], *actual); d != "" {
+		t.Errorf("Unexpected query;diff:\n%v", d)
+	}
+
+	listed, err := lib.List()
+	if err != nil {
+		t.Fatalf("Failed to list queries; %v", err)
+	}
+	if d := cmp.Diff([]string{"errors", "slow-checkout"}, savedQueryNames(listed)); d != "" {
+		t.Errorf("Unexpected queries;diff:\n%v", d)
+	}
+
+	type searchCase struct {
+		term     string
+		expected []string
+	}
+	searches := []searchCase{
+		{term: "checkout", expected: []string{"slow-checkout"}},
+		{term: "slw chk", expected: []string{"slow-checkout"}},
+		{term: "by service", expected: []string{"errors"}},
+		// Name matches rank above question matches.
+		{term: "err", expected: []string{"errors"}},
+		{term: "s", expected: []string{"slow-checkout", "errors"}},
+		{term: "nomatch", expected: []string{}},
+	}
+	for _, s := range searches {
+		results, err := lib.Search(s.term)
+		if err != nil {
+			t.Fatalf("Failed to search; %v", err)
+		}
+		if d := cmp.Diff(s.expected, savedQueryNames(results)); d != "" {
+			t.Errorf("Unexpected results for %q;diff:\n%v", s.term, d)
+		}
+	}
+
+	if err := lib.Remove("errors"); err != nil {
+		t.Fatalf("Failed to remove query; %v", err)
+	}
+	if _, err := lib.Get("errors"); err == nil {
+		t.Errorf("Expected an error getting a removed query")
+	}
+}
+
+func savedQueryNames(queries []SavedQuery) []string {
+	names := make([]string, 0, len(queries))
+	for _, q := range queries {
+		names = append(names, q.Name)
+	}
+	return names
+}
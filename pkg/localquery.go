@@ -0,0 +1,745 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultTimeRange is the time range Honeycomb uses when a query doesn't specify one.
+	defaultTimeRange = 7200
+	// defaultLimit is the limit Honeycomb uses when a query doesn't specify one.
+	defaultLimit = 1000
+	// heatmapBuckets is the number of buckets used to compute a HEATMAP locally.
+	heatmapBuckets = 10
+)
+
+// percentiles maps the Honeycomb percentile operators to the corresponding quantile.
+var percentiles = map[string]float64{
+	"P001": 0.001,
+	"P01":  0.01,
+	"P05":  0.05,
+	"P10":  0.10,
+	"P20":  0.20,
+	"P25":  0.25,
+	"P50":  0.50,
+	"P75":  0.75,
+	"P80":  0.80,
+	"P90":  0.90,
+	"P95":  0.95,
+	"P99":  0.99,
+	"P999": 0.999,
+}
+
+// Event is a single event read from a local events file.
+type Event struct {
+	// Time is the timestamp of the event. It is the zero value if the event didn't have a timestamp.
+	Time time.Time
+	Data map[string]interface{}
+}
+
+// QueryResult is the result of running a query.
+// The layout mirrors the data returned by Honeycomb's Query Data API.
+type QueryResult struct {
+	Series  []QueryResultSeries `json:"series,omitempty"`
+	Results []QueryResultRow    `json:"results"`
+}
+
+// QueryResultRow is the value of the calculations for a single group.
+// Data contains the breakdown values keyed by column and the calculations keyed by CalculationName.
+type QueryResultRow struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// QueryResultSeries is the value of the calculations for a single group in a single granularity bucket.
+type QueryResultSeries struct {
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// HeatmapBucket is a single bucket of a HEATMAP calculation.
+type HeatmapBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// LocalQueryOptions controls how a query is executed against local events.
+type LocalQueryOptions struct {
+	// Now is the time relative time ranges are computed from. Defaults to the current time.
+	Now time.Time
+	// Series computes the value of the calculations for each group in each granularity bucket; see QueryResult.Series.
+	Series bool
+}
+
+// ReadEventsFile reads events from a file containing newline delimited JSON.
+func ReadEventsFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open events file %v", path)
+	}
+	defer f.Close()
+	return ReadEvents(f)
+}
+
+// ReadEvents reads newline delimited JSON events.
+// Each line can either be a flat JSON object or be in Honeycomb's batch format i.e. {"time": ..., "data": {...}}.
+// For flat objects the timestamp is read from the "time", "timestamp" or "Timestamp" field.
+func ReadEvents(r io.Reader) ([]Event, error) {
+	events := make([]Event, 0, 100)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		raw := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse event on line %d", lineNum)
+		}
+
+		e := Event{Data: raw}
+		if data, ok := raw["data"].(map[string]interface{}); ok {
+			e.Data = data
+		}
+
+		for _, k := range []string{"time", "timestamp", "Timestamp"} {
+			v, ok := raw[k]
+			if !ok {
+				continue
+			}
+			t, err := parseEventTime(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to parse timestamp of event on line %d", lineNum)
+			}
+			e.Time = t
+			break
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to read events")
+	}
+	return events, nil
+}
+
+// parseEventTime parses a timestamp which is either an RFC3339 string or seconds since the epoch.
+func parseEventTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case string:
+		return time.Parse(time.RFC3339Nano, t)
+	case float64:
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	default:
+		return time.Time{}, errors.Errorf("Unsupported timestamp %v", v)
+	}
+}
+
+// LatestEventTime returns the timestamp of the most recent event.
+func LatestEventTime(events []Event) time.Time {
+	latest := time.Time{}
+	for _, e := range events {
+		if e.Time.After(latest) {
+			latest = e.Time
+		}
+	}
+	return latest
+}
+
+// CalculationName returns the name Honeycomb uses for a calculation in query results e.g. "P99(duration_ms)".
+func CalculationName(c Calculation) string {
+	col := columnName(c.Column)
+	if col == "" {
+		return c.Op
+	}
+	return fmt.Sprintf("%s(%s)", c.Op, col)
+}
+
+// columnName converts the column of a calculation, filter or having to a string.
+func columnName(c interface{}) string {
+	if c == nil {
+		return ""
+	}
+	if s, ok := c.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", c)
+}
+
+// ExecuteLocalQuery executes a Honeycomb query against a set of local events.
+// Events without a timestamp are treated as falling inside the query's time range but aren't included in
+// the time series. The time series is only computed if opts.Series is set.
+func ExecuteLocalQuery(q HoneycombQuery, events []Event, opts LocalQueryOptions) (*QueryResult, error) {
+	q = normalizeOperators(q)
+	if err := validateLocalQuery(q); err != nil {
+		return nil, err
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	start, end := queryTimeWindow(q, now)
+
+	matched := make([]Event, 0, len(events))
+	for _, e := range events {
+		if !e.Time.IsZero() && (e.Time.Before(start) || !e.Time.Before(end)) {
+			continue
+		}
+		ok, err := matchFilters(q, e)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, e)
+		}
+	}
+
+	calcs := q.Calculations
+	if len(calcs) == 0 {
+		calcs = []Calculation{{Op: "COUNT"}}
+	}
+
+	groups := groupEvents(q.Breakdowns, matched)
+
+	rows := make([]QueryResultRow, 0, len(groups))
+	rowGroups := make(map[int]*eventGroup)
+	for _, g := range groups {
+		data := g.breakdownData(q.Breakdowns)
+		for _, c := range calcs {
+			v, err := calculate(c, g.events)
+			if err != nil {
+				return nil, err
+			}
+			data[CalculationName(c)] = v
+		}
+
+		keep, err := matchHavings(q.Havings, data)
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			continue
+		}
+		rowGroups[len(rows)] = g
+		rows = append(rows, QueryResultRow{Data: data})
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	orders := q.Orders
+	if len(orders) == 0 {
+		orders = []Order{{Op: calcs[0].Op, Column: columnName(calcs[0].Column), Order: "descending"}}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return lessRows(orders, rows[order[i]], rows[order[j]])
+	})
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	if len(order) > limit {
+		order = order[:limit]
+	}
+
+	result := &QueryResult{
+		Results: make([]QueryResultRow, 0, len(order)),
+	}
+	for _, i := range order {
+		result.Results = append(result.Results, rows[i])
+	}
+
+	if !opts.Series {
+		return result, nil
+	}
+
+	granularity := q.Granularity
+	if granularity <= 0 {
+		granularity = PickGranularity(int(end.Sub(start).Seconds()))
+	}
+	step := time.Duration(granularity) * time.Second
+	// Align the buckets to multiples of the granularity the way Honeycomb does.
+	for bucketStart := start.Truncate(step); bucketStart.Before(end); bucketStart = bucketStart.Add(step) {
+		bucketEnd := bucketStart.Add(step)
+		for _, i := range order {
+			g := rowGroups[i]
+			inBucket := make([]Event, 0, len(g.events))
+			for _, e := range g.events {
+				if !e.Time.IsZero() && !e.Time.Before(bucketStart) && e.Time.Before(bucketEnd) {
+					inBucket = append(inBucket, e)
+				}
+			}
+			data := g.breakdownData(q.Breakdowns)
+			for _, c := range calcs {
+				v, err := calculate(c, inBucket)
+				if err != nil {
+					return nil, err
+				}
+				data[CalculationName(c)] = v
+			}
+			result.Series = append(result.Series, QueryResultSeries{Time: bucketStart, Data: data})
+		}
+	}
+	return result, nil
+}
+
+// normalizeOperators returns a copy of the query with its operators in the case the engine uses; calculations are
+// upper case and filter operators lower case. Honeycomb and ValidateQuery accept operators in either case.
+func normalizeOperators(q HoneycombQuery) HoneycombQuery {
+	q.Calculations = slices.Clone(q.Calculations)
+	for i := range q.Calculations {
+		q.Calculations[i].Op = strings.ToUpper(q.Calculations[i].Op)
+	}
+	q.Filters = slices.Clone(q.Filters)
+	for i := range q.Filters {
+		q.Filters[i].Op = strings.ToLower(q.Filters[i].Op)
+	}
+	q.Orders = slices.Clone(q.Orders)
+	for i := range q.Orders {
+		q.Orders[i].Op = strings.ToUpper(q.Orders[i].Op)
+	}
+	q.Havings = slices.Clone(q.Havings)
+	for i := range q.Havings {
+		q.Havings[i].CalculateOp = strings.ToUpper(q.Havings[i].CalculateOp)
+	}
+	return q
+}
+
+// validateLocalQuery checks that the query only uses operators the local engine supports.
+func validateLocalQuery(q HoneycombQuery) error {
+	for _, c := range q.Calculations {
+		if _, ok := percentiles[c.Op]; ok {
+			continue
+		}
+		switch c.Op {
+		case "COUNT":
+		case "SUM", "AVG", "MAX", "MIN", "COUNT_DISTINCT", "HEATMAP":
+			if columnName(c.Column) == "" {
+				return errors.Errorf("Calculation %v requires a column", c.Op)
+			}
+		default:
+			return errors.Errorf("Calculation %v is not supported", c.Op)
+		}
+	}
+
+	for _, f := range q.Filters {
+		if !isFilterOp(f.Op) {
+			return errors.Errorf("Filter operator %v is not supported", f.Op)
+		}
+	}
+
+	switch strings.ToUpper(q.FilterCombination) {
+	case "", "AND", "OR":
+	default:
+		return errors.Errorf("filter_combination %v is not supported; it should be AND or OR", q.FilterCombination)
+	}
+	return nil
+}
+
+// isFilterOp returns true if op is one of Honeycomb's filter operators; the case of op is ignored.
+func isFilterOp(op string) bool {
+	switch strings.ToLower(op) {
+	case "=", "!=", ">", ">=", "<", "<=",
+		"starts-with", "does-not-start-with", "ends-with", "does-not-end-with",
+		"exists", "does-not-exist", "contains", "does-not-contain", "in", "not-in":
+		return true
+	default:
+		return false
+	}
+}
+
+// isHavingOp returns true if op is one of the operators Honeycomb supports in havings.
+func isHavingOp(op string) bool {
+	switch op {
+	case "=", "!=", ">", ">=", "<", "<=":
+		return true
+	default:
+		return false
+	}
+}
+
+// queryTimeWindow returns the [start, end) window of the query.
+func queryTimeWindow(q HoneycombQuery, now time.Time) (time.Time, time.Time) {
+	timeRange := time.Duration(q.TimeRange) * time.Second
+	if q.TimeRange == 0 {
+		timeRange = defaultTimeRange * time.Second
+	}
+	switch {
+	case q.StartTime != 0 && q.EndTime != 0:
+		return time.Unix(int64(q.StartTime), 0), time.Unix(int64(q.EndTime), 0)
+	case q.StartTime != 0:
+		start := time.Unix(int64(q.StartTime), 0)
+		return start, start.Add(timeRange)
+	case q.EndTime != 0:
+		end := time.Unix(int64(q.EndTime), 0)
+		return end.Add(-timeRange), end
+	default:
+		return now.Add(-timeRange), now
+	}
+}
+
+func matchFilters(q HoneycombQuery, e Event) (bool, error) {
+	if len(q.Filters) == 0 {
+		return true, nil
+	}
+	isOr := strings.ToUpper(q.FilterCombination) == "OR"
+	for _, f := range q.Filters {
+		ok, err := matchFilter(f, e)
+		if err != nil {
+			return false, err
+		}
+		if isOr && ok {
+			return true, nil
+		}
+		if !isOr && !ok {
+			return false, nil
+		}
+	}
+	return !isOr, nil
+}
+
+// matchFilter returns true if the event matches the filter.
+// Events which are missing the column only match does-not-exist.
+func matchFilter(f Filter, e Event) (bool, error) {
+	v, ok := e.Data[columnName(f.Column)]
+	exists := ok && v != nil
+	switch f.Op {
+	case "exists":
+		return exists, nil
+	case "does-not-exist":
+		return !exists, nil
+	}
+	if !exists {
+		return false, nil
+	}
+
+	s := formatValue(v)
+	switch f.Op {
+	case "=":
+		return valuesEqual(v, f.Value), nil
+	case "!=":
+		return !valuesEqual(v, f.Value), nil
+	case ">":
+		return compareToFilter(v, f.Value) > 0, nil
+	case ">=":
+		return compareToFilter(v, f.Value) >= 0, nil
+	case "<":
+		return compareToFilter(v, f.Value) < 0, nil
+	case "<=":
+		return compareToFilter(v, f.Value) <= 0, nil
+	case "starts-with":
+		return strings.HasPrefix(s, f.Value), nil
+	case "does-not-start-with":
+		return !strings.HasPrefix(s, f.Value), nil
+	case "ends-with":
+		return strings.HasSuffix(s, f.Value), nil
+	case "does-not-end-with":
+		return !strings.HasSuffix(s, f.Value), nil
+	case "contains":
+		return strings.Contains(s, f.Value), nil
+	case "does-not-contain":
+		return !strings.Contains(s, f.Value), nil
+	case "in", "not-in":
+		found := false
+		for _, candidate := range f.ListValues() {
+			if valuesEqual(v, candidate) {
+				found = true
+				break
+			}
+		}
+		return found == (f.Op == "in"), nil
+	default:
+		return false, errors.Errorf("Filter operator %v is not supported", f.Op)
+	}
+}
+
+// valuesEqual compares an event value to a filter value which is always a string.
+func valuesEqual(v interface{}, filterValue string) bool {
+	switch t := v.(type) {
+	case float64:
+		f, err := strconv.ParseFloat(filterValue, 64)
+		return err == nil && f == t
+	case bool:
+		b, err := strconv.ParseBool(filterValue)
+		return err == nil && b == t
+	default:
+		return formatValue(v) == filterValue
+	}
+}
+
+// compareToFilter compares an event value to a filter value.
+// Values are compared numerically when both are numbers and lexically otherwise.
+func compareToFilter(v interface{}, filterValue string) int {
+	if n, ok := toFloat(v); ok {
+		if f, err := strconv.ParseFloat(filterValue, 64); err == nil {
+			return compareFloats(n, f)
+		}
+	}
+	return strings.Compare(formatValue(v), filterValue)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// formatValue converts an event value to a string.
+func formatValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprintf("%v", t)
+		}
+		return string(b)
+	}
+}
+
+// eventGroup is the set of events with the same breakdown values.
+type eventGroup struct {
+	values []interface{}
+	events []Event
+}
+
+// breakdownData returns a new map containing the breakdown values of the group.
+func (g *eventGroup) breakdownData(breakdowns []string) map[string]interface{} {
+	data := make(map[string]interface{}, len(breakdowns))
+	for i, b := range breakdowns {
+		data[b] = g.values[i]
+	}
+	return data
+}
+
+// groupEvents groups events by their breakdown values. Groups are returned in the order they are first seen.
+func groupEvents(breakdowns []string, events []Event) []*eventGroup {
+	groups := make([]*eventGroup, 0)
+	index := make(map[string]*eventGroup)
+	if len(breakdowns) == 0 {
+		return []*eventGroup{{values: []interface{}{}, events: events}}
+	}
+	for _, e := range events {
+		values := make([]interface{}, len(breakdowns))
+		keyParts := make([]string, len(breakdowns))
+		for i, b := range breakdowns {
+			values[i] = e.Data[b]
+			keyParts[i] = fmt.Sprintf("%T:%v", values[i], formatValue(values[i]))
+		}
+		key := strings.Join(keyParts, "\x00")
+		g, ok := index[key]
+		if !ok {
+			g = &eventGroup{values: values}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.events = append(g.events, e)
+	}
+	return groups
+}
+
+// calculate computes a single calculation over a set of events.
+// The result is nil if there are no values for the column.
+func calculate(c Calculation, events []Event) (interface{}, error) {
+	if c.Op == "COUNT" {
+		return len(events), nil
+	}
+
+	col := columnName(c.Column)
+	if c.Op == "COUNT_DISTINCT" {
+		distinct := make(map[string]bool)
+		for _, e := range events {
+			if v, ok := e.Data[col]; ok && v != nil {
+				distinct[formatValue(v)] = true
+			}
+		}
+		return len(distinct), nil
+	}
+
+	values := make([]float64, 0, len(events))
+	for _, e := range events {
+		if f, ok := toFloat(e.Data[col]); ok {
+			values = append(values, f)
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	sort.Float64s(values)
+
+	if p, ok := percentiles[c.Op]; ok {
+		// Use the nearest rank method.
+		rank := int(math.Ceil(p*float64(len(values)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		return values[rank], nil
+	}
+
+	switch c.Op {
+	case "SUM", "AVG":
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		if c.Op == "AVG" {
+			return sum / float64(len(values)), nil
+		}
+		return sum, nil
+	case "MAX":
+		return values[len(values)-1], nil
+	case "MIN":
+		return values[0], nil
+	case "HEATMAP":
+		return heatmap(values), nil
+	default:
+		return nil, errors.Errorf("Calculation %v is not supported", c.Op)
+	}
+}
+
+// heatmap buckets sorted values into equal width buckets.
+func heatmap(values []float64) []HeatmapBucket {
+	min := values[0]
+	max := values[len(values)-1]
+	width := (max - min) / heatmapBuckets
+	if width == 0 {
+		return []HeatmapBucket{{Min: min, Max: max, Count: len(values)}}
+	}
+	buckets := make([]HeatmapBucket, heatmapBuckets)
+	for i := range buckets {
+		buckets[i].Min = min + float64(i)*width
+		buckets[i].Max = min + float64(i+1)*width
+	}
+	for _, v := range values {
+		i := int((v - min) / width)
+		if i >= heatmapBuckets {
+			i = heatmapBuckets - 1
+		}
+		buckets[i].Count++
+	}
+	return buckets
+}
+
+// matchHavings returns true if the calculations of a group satisfy all the havings.
+func matchHavings(havings []Having, data map[string]interface{}) (bool, error) {
+	for _, h := range havings {
+		name := CalculationName(Calculation{Op: h.CalculateOp, Column: h.Column})
+		raw, ok := data[name]
+		if !ok {
+			return false, errors.Errorf("Having references calculation %v which isn't in the query", name)
+		}
+		v, ok := toFloat(raw)
+		if !ok {
+			return false, nil
+		}
+		cmp := compareFloats(v, h.Value)
+		var keep bool
+		switch h.Op {
+		case "=":
+			keep = cmp == 0
+		case "!=":
+			keep = cmp != 0
+		case ">":
+			keep = cmp > 0
+		case ">=":
+			keep = cmp >= 0
+		case "<":
+			keep = cmp < 0
+		case "<=":
+			keep = cmp <= 0
+		default:
+			return false, errors.Errorf("Having operator %v is not supported", h.Op)
+		}
+		if !keep {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lessRows returns true if row a should be sorted before row b.
+func lessRows(orders []Order, a, b QueryResultRow) bool {
+	for _, o := range orders {
+		key := o.Column
+		if o.Op != "" {
+			key = CalculationName(Calculation{Op: o.Op, Column: o.Column})
+		}
+		c := compareResultValues(a.Data[key], b.Data[key])
+		if c == 0 {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(o.Order), "desc") {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+// compareResultValues compares two values in a result; nil values sort first.
+func compareResultValues(a, b interface{}) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if i, ok := a.(int); ok {
+		a = float64(i)
+	}
+	if i, ok := b.(int); ok {
+		b = float64(i)
+	}
+	af, aok := a.(float64)
+	bf, bok := b.(float64)
+	if aok && bok {
+		return compareFloats(af, bf)
+	}
+	return strings.Compare(formatValue(a), formatValue(b))
+}
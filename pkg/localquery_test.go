@@ -0,0 +1,160 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testEvents = `{"time": "2024-03-21T10:00:00Z", "data": {"name": "GET /", "duration_ms": 10, "service.name": "frontend"}}
+{"time": "2024-03-21T10:01:00Z", "data": {"name": "GET /", "duration_ms": 30, "service.name": "frontend", "error": true}}
+{"time": "2024-03-21T10:02:00Z", "data": {"name": "POST /cart", "duration_ms": 100, "service.name": "checkout", "trace.parent_id": "abc"}}
+{"timestamp": "2024-03-21T10:03:00Z", "name": "POST /cart", "duration_ms": 200, "service.name": "checkout"}
+{"timestamp": "2024-03-21T08:00:00Z", "name": "GET /", "duration_ms": 1000, "service.name": "frontend"}
+`
+
+func Test_ExecuteLocalQuery(t *testing.T) {
+	type testCase struct {
+		name     string
+		query    HoneycombQuery
+		expected []map[string]interface{}
+	}
+
+	cases := []testCase{
+		{
+			name: "count-by-name",
+			query: HoneycombQuery{
+				Breakdowns:   []string{"name"},
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Orders:       []Order{{Op: "COUNT", Order: "descending"}},
+			},
+			expected: []map[string]interface{}{
+				{"name": "GET /", "COUNT": 2},
+				{"name": "POST /cart", "COUNT": 2},
+			},
+		},
+		{
+			name: "filters-and-percentiles",
+			query: HoneycombQuery{
+				Calculations: []Calculation{{Op: "P50", Column: "duration_ms"}, {Op: "MAX", Column: "duration_ms"}, {Op: "COUNT_DISTINCT", Column: "name"}},
+				Filters: []Filter{
+					{Op: "does-not-exist", Column: "trace.parent_id"},
+					{Op: ">=", Column: "duration_ms", Value: "20"},
+				},
+			},
+			expected: []map[string]interface{}{
+				{"P50(duration_ms)": 30.0, "MAX(duration_ms)": 200.0, "COUNT_DISTINCT(name)": 2},
+			},
+		},
+		{
+			name: "or-in-having-limit",
+			query: HoneycombQuery{
+				Breakdowns:        []string{"service.name"},
+				Calculations:      []Calculation{{Op: "SUM", Column: "duration_ms"}, {Op: "COUNT"}},
+				Filters:           []Filter{{Op: "in", Column: "service.name", Value: "checkout, frontend"}, {Op: "exists", Column: "error"}},
+				FilterCombination: "OR",
+				Havings:           []Having{{CalculateOp: "COUNT", Op: ">", Value: 1}},
+				Orders:            []Order{{Column: "service.name", Order: "ascending"}},
+				Limit:             1,
+			},
+			expected: []map[string]interface{}{
+				{"service.name": "checkout", "SUM(duration_ms)": 300.0, "COUNT": 2},
+			},
+		},
+		{
+			// Operators are matched regardless of case like ValidateQuery does.
+			name: "operator-case",
+			query: HoneycombQuery{
+				Calculations: []Calculation{{Op: "count"}},
+				Filters:      []Filter{{Op: "EXISTS", Column: "error"}},
+			},
+			expected: []map[string]interface{}{
+				{"COUNT": 1},
+			},
+		},
+		{
+			// A list filter without values doesn't match events without the column.
+			name: "empty-in",
+			query: HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Op: "in", Column: "missing"}},
+			},
+			expected: []map[string]interface{}{
+				{"COUNT": 0},
+			},
+		},
+		{
+			name: "fractional-having",
+			query: HoneycombQuery{
+				Breakdowns:   []string{"name"},
+				Calculations: []Calculation{{Op: "AVG", Column: "duration_ms"}},
+				Havings:      []Having{{CalculateOp: "AVG", Column: "duration_ms", Op: ">=", Value: 20.5}},
+			},
+			expected: []map[string]interface{}{
+				{"name": "POST /cart", "AVG(duration_ms)": 150.0},
+			},
+		},
+	}
+
+	events, err := ReadEvents(strings.NewReader(testEvents))
+	if err != nil {
+		t.Fatalf("Failed to read events; %v", err)
+	}
+
+	now, err := time.Parse(time.RFC3339, "2024-03-21T10:30:00Z")
+	if err != nil {
+		t.Fatalf("Failed to parse time; %v", err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := ExecuteLocalQuery(c.query, events, LocalQueryOptions{Now: now})
+			if err != nil {
+				t.Fatalf("Failed to execute query; %v", err)
+			}
+			actual := make([]map[string]interface{}, 0, len(result.Results))
+			for _, r := range result.Results {
+				actual = append(actual, r.Data)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Fatalf("Unexpected results;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ExecuteLocalQuerySeries(t *testing.T) {
+	events, err := ReadEvents(strings.NewReader(testEvents))
+	if err != nil {
+		t.Fatalf("Failed to read events; %v", err)
+	}
+
+	q := HoneycombQuery{
+		Calculations: []Calculation{{Op: "COUNT"}},
+		StartTime:    int(time.Date(2024, 3, 21, 10, 0, 0, 0, time.UTC).Unix()),
+		EndTime:      int(time.Date(2024, 3, 21, 10, 4, 0, 0, time.UTC).Unix()),
+		Granularity:  120,
+	}
+	result, err := ExecuteLocalQuery(q, events, LocalQueryOptions{})
+	if err != nil {
+		t.Fatalf("Failed to execute query; %v", err)
+	}
+	if len(result.Series) != 0 {
+		t.Errorf("The series should only be computed when it is requested; got %v", result.Series)
+	}
+
+	result, err = ExecuteLocalQuery(q, events, LocalQueryOptions{Series: true})
+	if err != nil {
+		t.Fatalf("Failed to execute query; %v", err)
+	}
+
+	counts := make([]interface{}, 0, len(result.Series))
+	for _, s := range result.Series {
+		counts = append(counts, s.Data["COUNT"])
+	}
+	if d := cmp.Diff([]interface{}{2, 2}, counts); d != "" {
+		t.Fatalf("Unexpected series;diff:\n%v", d)
+	}
+}
@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseQuery parses a HoneycombQuery from a string.
+// In addition to JSON it accepts
+//   - YAML using the same field names as JSON
+//   - the python dictionary syntax the model outputs e.g. {'breakdowns': ['name'], 'calculations': [{'op': 'COUNT'}]}
+//   - JSON encoded as a JSON string e.g. "{\"breakdowns\": [\"name\"]}"
+//   - JSON with escaped quotes as in the commands in our notebooks e.g. {\"breakdowns\": [\"name\"]}
+func ParseQuery(s string) (*HoneycombQuery, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "\"") {
+		unquoted := ""
+		if err := json.Unmarshal([]byte(s), &unquoted); err != nil {
+			return nil, errors.Wrapf(err, "Failed to unquote query")
+		}
+		return ParseQuery(unquoted)
+	}
+
+	q := &HoneycombQuery{}
+	jsonErr := json.Unmarshal([]byte(s), q)
+	if jsonErr == nil {
+		return q, nil
+	}
+
+	if strings.Contains(s, `\"`) {
+		q = &HoneycombQuery{}
+		if err := json.Unmarshal([]byte(strings.ReplaceAll(s, `\"`, `"`)), q); err == nil {
+			return q, nil
+		}
+	}
+
+	if converted, err := pythonToJSON(s); err == nil {
+		q = &HoneycombQuery{}
+		if err := json.Unmarshal([]byte(converted), q); err != nil {
+			return nil, errors.Wrapf(err, "Failed to unmarshal query")
+		}
+		return q, nil
+	}
+
+	q, err := parseYAMLQuery(s)
+	if err != nil {
+		return nil, errors.Wrapf(jsonErr, "Query isn't valid JSON, YAML or a python dictionary")
+	}
+	return q, nil
+}
+
+// ParseAnyQuery parses a query in any of the formats accepted by ParseQuery or in the text syntax
+// e.g. "COUNT WHERE error exists GROUP BY name LAST 7d".
+func ParseAnyQuery(s string) (*HoneycombQuery, error) {
+	q, err := ParseQuery(s)
+	if err == nil {
+		return q, nil
+	}
+	q, textErr := ParseTextQuery(s)
+	if textErr == nil {
+		return q, nil
+	}
+	return nil, errors.Errorf("Query isn't valid JSON, YAML or a python dictionary (%v) and isn't valid text syntax (%v)", err, textErr)
+}
+
+// parseYAMLQuery parses a query written in YAML using the same field names as the JSON representation.
+// Unknown fields are an error; otherwise text queries containing ": " e.g. WHERE msg = "a: b" would parse as a
+// mapping with a single unknown key i.e. an empty query.
+func parseYAMLQuery(s string) (*HoneycombQuery, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse YAML")
+	}
+	if _, ok := raw.(map[string]interface{}); !ok {
+		return nil, errors.New("YAML query should be a mapping")
+	}
+	// Round trip through JSON so the JSON field names apply.
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to convert YAML to JSON")
+	}
+	q := &HoneycombQuery{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(q); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal query")
+	}
+	return q, nil
+}
+
+// pythonToJSON converts a python literal made of dicts, lists, strings, numbers, booleans and None to JSON.
+func pythonToJSON(s string) (string, error) {
+	var out strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\'' || r == '"':
+			value, end, err := readPythonString(runes, i)
+			if err != nil {
+				return "", err
+			}
+			b, err := json.Marshal(value)
+			if err != nil {
+				return "", errors.Wrapf(err, "Failed to serialize string")
+			}
+			out.Write(b)
+			i = end
+		case r == '}' || r == ']' || r == ')':
+			// Python allows trailing commas but JSON doesn't.
+			trimmed := strings.TrimRight(out.String(), " \t\r\n")
+			if strings.HasSuffix(trimmed, ",") {
+				trimmed = trimmed[:len(trimmed)-1]
+				out.Reset()
+				out.WriteString(trimmed)
+			}
+			if r == ')' {
+				r = ']'
+			}
+			out.WriteRune(r)
+		case r == '(':
+			out.WriteRune('[')
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(runes) && strings.ContainsRune("0123456789.eE+-", runes[j]) {
+				j++
+			}
+			out.WriteString(string(runes[i:j]))
+			i = j - 1
+		case isIdentStart(r):
+			j := i
+			for j < len(runes) && (isIdentStart(runes[j]) || (runes[j] >= '0' && runes[j] <= '9')) {
+				j++
+			}
+			switch ident := string(runes[i:j]); ident {
+			case "True":
+				out.WriteString("true")
+			case "False":
+				out.WriteString("false")
+			case "None":
+				out.WriteString("null")
+			default:
+				return "", errors.Errorf("Unexpected identifier %v", ident)
+			}
+			i = j - 1
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String(), nil
+}
+
+// readPythonString reads the python string starting at runes[start].
+// It returns the unescaped value and the index of the closing quote.
+func readPythonString(runes []rune, start int) (string, int, error) {
+	quote := runes[start]
+	var value strings.Builder
+	for i := start + 1; i < len(runes); i++ {
+		r := runes[i]
+		if r == quote {
+			return value.String(), i, nil
+		}
+		if r != '\\' || i+1 >= len(runes) {
+			value.WriteRune(r)
+			continue
+		}
+		i++
+		switch runes[i] {
+		case '\\', '\'', '"':
+			value.WriteRune(runes[i])
+			continue
+		case 'a', 'b', 'f', 'n', 'r', 't', 'v', 'x', 'u', 'U', '0', '1', '2', '3', '4', '5', '6', '7':
+			// The escapes strconv.Quote writes e.g. \x01 which FormatTextQuery uses for control characters.
+			rest := string(runes[i-1:])
+			c, multibyte, tail, err := strconv.UnquoteChar(rest, 0)
+			if err == nil {
+				if multibyte {
+					value.WriteRune(c)
+				} else {
+					value.WriteByte(byte(c))
+				}
+				i += len([]rune(rest)) - len([]rune(tail)) - 2
+				continue
+			}
+		}
+		// Other escapes e.g. \d in a regular expression are kept as is.
+		value.WriteRune('\\')
+		value.WriteRune(runes[i])
+	}
+	return "", 0, errors.Errorf("Unterminated string starting at offset %d", start)
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
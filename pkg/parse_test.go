@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ParseQuery(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected HoneycombQuery
+	}
+
+	cases := []testCase{
+		{
+			name:  "json",
+			input: `{"breakdowns": ["name"], "calculations": [{"op": "COUNT"}], "time_range": 7200}`,
+			expected: HoneycombQuery{
+				Breakdowns:   []string{"name"},
+				Calculations: []Calculation{{Op: "COUNT"}},
+				TimeRange:    7200,
+			},
+		},
+		{
+			name:  "python",
+			input: "{'breakdowns': ['http.route'], 'calculations': [{'column': 'duration_ms', 'op': 'MAX'}], 'filters': [{'column': 'trace.parent_id', 'op': 'does-not-exist'}, {'column': 'name', 'op': '=', 'value': 'it\\'s'},], 'time_range': 7200}",
+			expected: HoneycombQuery{
+				Breakdowns:   []string{"http.route"},
+				Calculations: []Calculation{{Op: "MAX", Column: "duration_ms"}},
+				Filters: []Filter{
+					{Op: "does-not-exist", Column: "trace.parent_id"},
+					{Op: "=", Column: "name", Value: "it's"},
+				},
+				TimeRange: 7200,
+			},
+		},
+		{
+			name:  "fractional-having",
+			input: `{"calculations": [{"op": "P99", "column": "duration_ms"}], "havings": [{"calculate_op": "P99", "column": "duration_ms", "op": ">", "value": 1.5}]}`,
+			expected: HoneycombQuery{
+				Calculations: []Calculation{{Op: "P99", Column: "duration_ms"}},
+				Havings:      []Having{{CalculateOp: "P99", Column: "duration_ms", Op: ">", Value: 1.5}},
+			},
+		},
+		{
+			name:  "yaml",
+			input: "breakdowns: [name]\ncalculations:\n  - op: COUNT\ntime_range: 7200",
+			expected: HoneycombQuery{
+				Breakdowns:   []string{"name"},
+				Calculations: []Calculation{{Op: "COUNT"}},
+				TimeRange:    7200,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := ParseQuery(c.input)
+			if err != nil {
+				t.Fatalf("Failed to parse query; %v", err)
+			}
+			if d := cmp.Diff(c.expected, *actual); d != "" {
+				t.Fatalf("Unexpected query;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ParseAnyQuery(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected *HoneycombQuery
+	}
+
+	cases := []testCase{
+		{
+			// The text contains ": " so it is also a YAML mapping with a single unknown key.
+			name:  "text-with-colon",
+			input: `COUNT WHERE msg = "a: b" LAST 2h`,
+			expected: &HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Column: "msg", Op: "=", Value: "a: b"}},
+				TimeRange:    7200,
+			},
+		},
+		{
+			name:  "yaml-unknown-field",
+			input: "calculation:\n  - op: COUNT",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := ParseAnyQuery(c.input)
+			if c.expected == nil {
+				if err == nil {
+					t.Fatalf("Expected an error; got %+v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse query; %v", err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected query;diff:\n%v", d)
+			}
+		})
+	}
+}
@@ -19,6 +19,65 @@ type Translator interface {
 	Translate(nlq QueryInput) (string, error)
 }
 
+// Translation is the output of a translator along with metadata about the prediction.
+type Translation struct {
+	Output string `json:"output"`
+	// Model and Version identify the model that made the prediction if the backend reports them.
+	Model   string `json:"model,omitempty"`
+	Version string `json:"version,omitempty"`
+	// PredictTime is the time in seconds the backend reports the model spent making the prediction.
+	PredictTime float64 `json:"predictTime,omitempty"`
+}
+
+// DetailedTranslator is implemented by translators that can report metadata about their predictions.
+type DetailedTranslator interface {
+	TranslateDetailed(nlq QueryInput) (*Translation, error)
+}
+
+// TranslateDetailed runs the translator and returns the output along with any metadata the translator reports.
+func TranslateDetailed(t Translator, in QueryInput) (*Translation, error) {
+	if d, ok := t.(DetailedTranslator); ok {
+		return d.TranslateDetailed(in)
+	}
+	output, err := t.Translate(in)
+	if err != nil {
+		return nil, err
+	}
+	return &Translation{Output: output}, nil
+}
+
+// NewTranslator creates the Translator selected by the configuration.
+// Replicate is used if it is configured, then a chat model, otherwise the model served at the translator's endpoint
+// is used.
+func NewTranslator(cfg config.Config) (Translator, error) {
+	log := zapr.NewLogger(zap.L())
+	if cfg.GetTranslator().Replicate != nil {
+		log.Info("Using Replicate translator")
+		return NewReplicateClient(cfg)
+	}
+	if cfg.GetTranslator().Chat != nil {
+		log.Info("Using chat translator")
+		return NewChatClient(cfg)
+	}
+	log.Info("Using model on K8s")
+	return &Predictor{
+		Config: &cfg,
+	}, nil
+}
+
+// TranslatorName returns a short description of the translator selected by the configuration
+// e.g. replicate:owner/model, chat:gpt-4o or endpoint:http://localhost:8080.
+func TranslatorName(cfg config.Config) string {
+	t := cfg.GetTranslator()
+	if t.Replicate != nil {
+		return "replicate:" + t.Replicate.Model
+	}
+	if t.Chat != nil {
+		return "chat:" + t.Chat.Model
+	}
+	return "endpoint:" + t.Endpoint
+}
+
 // Query represents a query for the model; not a honeycomb query.
 type Query struct {
 	Input               *QueryInput  `json:"input,omitempty"`
@@ -62,7 +121,7 @@ func (p *Predictor) Predict(inQuery QueryInput) (*Query, error) {
 	}
 	buff := bytes.NewBuffer(b)
 
-	endpoint := strings.TrimSuffix(p.Config.AIEndpoint, "/") + "/predictions"
+	endpoint := strings.TrimSuffix(p.Config.GetTranslator().Endpoint, "/") + "/predictions"
 	log.Info("Sending prediction request", "endpoint", endpoint, "query", string(b))
 	req, err := http.NewRequest(http.MethodPost, endpoint, buff)
 	if err != nil {
@@ -99,9 +158,28 @@ func (p *Predictor) Predict(inQuery QueryInput) (*Query, error) {
 }
 
 func (p *Predictor) Translate(inQuery QueryInput) (string, error) {
-	query, err := p.Predict(inQuery)
+	t, err := p.TranslateDetailed(inQuery)
 	if err != nil {
 		return "", err
 	}
-	return *query.Output, err
+	return t.Output, nil
+}
+
+// TranslateDetailed returns the query along with the model version and prediction time reported by the server.
+func (p *Predictor) TranslateDetailed(inQuery QueryInput) (*Translation, error) {
+	query, err := p.Predict(inQuery)
+	if err != nil {
+		return nil, err
+	}
+	if query.Output == nil {
+		return nil, errors.New("Prediction response didn't include an output")
+	}
+	t := &Translation{
+		Output:      *query.Output,
+		PredictTime: query.Metrics.PredictTime,
+	}
+	if query.Version != nil {
+		t.Version = *query.Version
+	}
+	return t, nil
 }
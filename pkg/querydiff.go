@@ -0,0 +1,251 @@
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QueryDifference is a single difference between two queries.
+// For lists Removed and Added are individual elements; for scalars they are the old and new values.
+type QueryDifference struct {
+	Field   string `json:"field"`
+	Removed string `json:"removed,omitempty"`
+	Added   string `json:"added,omitempty"`
+}
+
+// String returns a human readable representation of the difference.
+func (d QueryDifference) String() string {
+	switch {
+	case d.Removed != "" && d.Added != "":
+		return fmt.Sprintf("~ %s: %s -> %s", d.Field, d.Removed, d.Added)
+	case d.Removed != "":
+		return fmt.Sprintf("- %s: %s", d.Field, d.Removed)
+	default:
+		return fmt.Sprintf("+ %s: %s", d.Field, d.Added)
+	}
+}
+
+// NormalizeQuery returns a copy of the query in a canonical form so that semantically equivalent queries are equal.
+//
+// Breakdowns, calculations, filters and havings are sorted since their order doesn't change the results.
+// Orders aren't sorted because they determine the precedence of the sort keys.
+// Defaults are filled in e.g. filter_combination is AND, the limit is 1000 and the time range is 2 hours.
+// The time window is expressed as a time_range plus a start_time if the window is absolute.
+// The ID is dropped since it doesn't affect the results.
+func NormalizeQuery(q HoneycombQuery) HoneycombQuery {
+	n := HoneycombQuery{
+		Granularity: q.Granularity,
+		Limit:       q.Limit,
+	}
+
+	if len(q.Breakdowns) > 0 {
+		n.Breakdowns = append([]string{}, q.Breakdowns...)
+		sort.Strings(n.Breakdowns)
+	}
+
+	for _, c := range q.Calculations {
+		n.Calculations = append(n.Calculations, Calculation{Op: strings.ToUpper(c.Op), Column: normalizeColumn(c.Column)})
+	}
+	sort.SliceStable(n.Calculations, func(i, j int) bool {
+		return CalculationName(n.Calculations[i]) < CalculationName(n.Calculations[j])
+	})
+
+	for _, f := range q.Filters {
+		nf := Filter{Op: strings.ToLower(f.Op), Column: normalizeColumn(f.Column), Value: f.Value}
+		if nf.Op == "in" || nf.Op == "not-in" || f.Values != nil {
+			// Lists written as a single string are the same filter as the list.
+			nf.Value, nf.Values = "", f.ListValues()
+		}
+		n.Filters = append(n.Filters, nf)
+	}
+	sort.SliceStable(n.Filters, func(i, j int) bool {
+		return formatFilter(n.Filters[i]) < formatFilter(n.Filters[j])
+	})
+
+	n.FilterCombination = strings.ToUpper(q.FilterCombination)
+	if n.FilterCombination == "" {
+		n.FilterCombination = "AND"
+	}
+
+	for _, o := range q.Orders {
+		order := "ascending"
+		if strings.HasPrefix(strings.ToLower(o.Order), "desc") {
+			order = "descending"
+		}
+		n.Orders = append(n.Orders, Order{Column: o.Column, Op: strings.ToUpper(o.Op), Order: order})
+	}
+
+	for _, h := range q.Havings {
+		n.Havings = append(n.Havings, Having{CalculateOp: strings.ToUpper(h.CalculateOp), Column: normalizeColumn(h.Column), Op: h.Op, Value: h.Value})
+	}
+	sort.SliceStable(n.Havings, func(i, j int) bool {
+		return formatHaving(n.Havings[i]) < formatHaving(n.Havings[j])
+	})
+
+	if n.Limit == 0 {
+		n.Limit = defaultLimit
+	}
+
+	n.TimeRange = effectiveTimeRange(q)
+	switch {
+	case q.StartTime != 0:
+		n.StartTime = q.StartTime
+	case q.EndTime != 0:
+		n.StartTime = q.EndTime - n.TimeRange
+	}
+	return n
+}
+
+// normalizeColumn converts empty columns to nil so that a missing column and an empty column are equal.
+func normalizeColumn(c interface{}) interface{} {
+	name := columnName(c)
+	if name == "" {
+		return nil
+	}
+	return name
+}
+
+// DiffQueries returns the semantic differences between two queries.
+// Both queries are normalized first so differences in ordering and defaults aren't reported.
+// An empty list means the queries are equivalent.
+func DiffQueries(a HoneycombQuery, b HoneycombQuery) []QueryDifference {
+	na := NormalizeQuery(a)
+	nb := NormalizeQuery(b)
+
+	diffs := make([]QueryDifference, 0)
+	diffs = append(diffs, diffSets("breakdowns", na.Breakdowns, nb.Breakdowns)...)
+	diffs = append(diffs, diffSets("calculations", calculationNames(na.Calculations), calculationNames(nb.Calculations))...)
+	diffs = append(diffs, diffSets("filters", filterStrings(na.Filters), filterStrings(nb.Filters))...)
+	// The combination only matters when there is more than one filter.
+	if len(na.Filters) > 1 || len(nb.Filters) > 1 {
+		diffs = append(diffs, diffScalar("filter_combination", na.FilterCombination, nb.FilterCombination)...)
+	}
+	diffs = append(diffs, diffLists("orders", orderStrings(na.Orders), orderStrings(nb.Orders))...)
+	diffs = append(diffs, diffSets("havings", havingStrings(na.Havings), havingStrings(nb.Havings))...)
+	diffs = append(diffs, diffScalar("limit", strconv.Itoa(na.Limit), strconv.Itoa(nb.Limit))...)
+	diffs = append(diffs, diffScalar("granularity", formatGranularity(na.Granularity), formatGranularity(nb.Granularity))...)
+	diffs = append(diffs, diffScalar("time_range", strconv.Itoa(na.TimeRange), strconv.Itoa(nb.TimeRange))...)
+	diffs = append(diffs, diffScalar("start_time", formatStartTime(na.StartTime), formatStartTime(nb.StartTime))...)
+	return diffs
+}
+
+func formatGranularity(g int) string {
+	if g == 0 {
+		return "auto"
+	}
+	return strconv.Itoa(g)
+}
+
+func formatStartTime(t int) string {
+	if t == 0 {
+		return "relative"
+	}
+	return strconv.Itoa(t)
+}
+
+// formatFilter returns a human readable representation of a filter e.g. `duration_ms > 100`.
+func formatFilter(f Filter) string {
+	s := columnName(f.Column) + " " + f.Op
+	if f.Values != nil {
+		values := make([]string, 0, len(f.Values))
+		for _, v := range f.Values {
+			values = append(values, strconv.Quote(v))
+		}
+		return s + " (" + strings.Join(values, ", ") + ")"
+	}
+	if f.Value != "" {
+		s += " " + strconv.Quote(f.Value)
+	}
+	return s
+}
+
+// formatOrder returns a human readable representation of an order e.g. `COUNT descending`.
+func formatOrder(o Order) string {
+	key := o.Column
+	if o.Op != "" {
+		key = CalculationName(Calculation{Op: o.Op, Column: o.Column})
+	}
+	order := o.Order
+	if order == "" {
+		order = "ascending"
+	}
+	return key + " " + order
+}
+
+// formatHaving returns a human readable representation of a having e.g. `COUNT > 10`.
+func formatHaving(h Having) string {
+	return fmt.Sprintf("%s %s %s", CalculationName(Calculation{Op: h.CalculateOp, Column: h.Column}), h.Op, formatValue(h.Value))
+}
+
+func calculationNames(calcs []Calculation) []string {
+	names := make([]string, 0, len(calcs))
+	for _, c := range calcs {
+		names = append(names, CalculationName(c))
+	}
+	return names
+}
+
+func filterStrings(filters []Filter) []string {
+	s := make([]string, 0, len(filters))
+	for _, f := range filters {
+		s = append(s, formatFilter(f))
+	}
+	return s
+}
+
+func orderStrings(orders []Order) []string {
+	s := make([]string, 0, len(orders))
+	for _, o := range orders {
+		s = append(s, formatOrder(o))
+	}
+	return s
+}
+
+func havingStrings(havings []Having) []string {
+	s := make([]string, 0, len(havings))
+	for _, h := range havings {
+		s = append(s, formatHaving(h))
+	}
+	return s
+}
+
+// diffSets reports the elements removed from and added to a list ignoring order.
+// Duplicates are counted so [a, a] and [a] differ.
+func diffSets(field string, a []string, b []string) []QueryDifference {
+	counts := make(map[string]int)
+	for _, v := range b {
+		counts[v]++
+	}
+	diffs := make([]QueryDifference, 0)
+	for _, v := range a {
+		if counts[v] > 0 {
+			counts[v]--
+			continue
+		}
+		diffs = append(diffs, QueryDifference{Field: field, Removed: v})
+	}
+	for _, v := range b {
+		if counts[v] > 0 {
+			counts[v]--
+			diffs = append(diffs, QueryDifference{Field: field, Added: v})
+		}
+	}
+	return diffs
+}
+
+// diffLists reports the change to a list where the order of the elements matters.
+func diffLists(field string, a []string, b []string) []QueryDifference {
+	if equalStrings(a, b) {
+		return nil
+	}
+	return []QueryDifference{{Field: field, Removed: "[" + strings.Join(a, ", ") + "]", Added: "[" + strings.Join(b, ", ") + "]"}}
+}
+
+func diffScalar(field string, a string, b string) []QueryDifference {
+	if a == b {
+		return nil
+	}
+	return []QueryDifference{{Field: field, Removed: a, Added: b}}
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_DiffQueries(t *testing.T) {
+	type testCase struct {
+		name     string
+		a        HoneycombQuery
+		b        HoneycombQuery
+		expected []string
+	}
+
+	cases := []testCase{
+		{
+			name: "equivalent",
+			a: HoneycombQuery{
+				Breakdowns:   []string{"name", "http.route"},
+				Calculations: []Calculation{{Op: "COUNT"}, {Op: "P99", Column: "duration_ms"}},
+				Filters:      []Filter{{Op: "exists", Column: "error"}, {Op: ">", Column: "duration_ms", Value: "100"}},
+				StartTime:    1000,
+				EndTime:      8200,
+			},
+			b: HoneycombQuery{
+				Breakdowns:        []string{"http.route", "name"},
+				Calculations:      []Calculation{{Op: "p99", Column: "duration_ms"}, {Op: "COUNT"}},
+				Filters:           []Filter{{Op: ">", Column: "duration_ms", Value: "100"}, {Op: "exists", Column: "error"}},
+				FilterCombination: "AND",
+				StartTime:         1000,
+				TimeRange:         7200,
+				Limit:             1000,
+			},
+			expected: []string{},
+		},
+		{
+			name:     "default-time-range",
+			a:        HoneycombQuery{},
+			b:        HoneycombQuery{TimeRange: 7200},
+			expected: []string{},
+		},
+		{
+			name: "different",
+			a: HoneycombQuery{
+				Breakdowns:   []string{"name"},
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Orders:       []Order{{Op: "COUNT", Order: "descending"}},
+				TimeRange:    3600,
+			},
+			b: HoneycombQuery{
+				Breakdowns:   []string{"http.route"},
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Op: "=", Column: "service.name", Value: "api"}},
+				Orders:       []Order{{Op: "COUNT", Order: "desc"}},
+				TimeRange:    7200,
+			},
+			expected: []string{
+				"- breakdowns: name",
+				"+ breakdowns: http.route",
+				`+ filters: service.name = "api"`,
+				"~ time_range: 3600 -> 7200",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := make([]string, 0)
+			for _, d := range DiffQueries(c.a, c.b) {
+				actual = append(actual, d.String())
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Fatalf("Unexpected differences;diff:\n%v", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// queryFieldClauses maps the fields SetQueryField can set to the clause of the text syntax used to parse the value.
+var queryFieldClauses = map[string]string{
+	"calculations":       "",
+	"where":              "WHERE",
+	"breakdowns":         "GROUP BY",
+	"havings":            "HAVING",
+	"orders":             "ORDER BY",
+	"limit":              "LIMIT",
+	"granularity":        "GRANULARITY",
+	"since":              "LAST",
+	"filter_combination": "",
+}
+
+// queryFieldAliases are alternative names for the fields e.g. the names used in the JSON format of queries.
+var queryFieldAliases = map[string]string{
+	"calc":       "calculations",
+	"filters":    "where",
+	"group_by":   "breakdowns",
+	"order_by":   "orders",
+	"time_range": "since",
+	"last":       "since",
+}
+
+// QueryFields returns the names of the fields SetQueryField can set.
+func QueryFields() []string {
+	fields := make([]string, 0, len(queryFieldClauses))
+	for f := range queryFieldClauses {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// SetQueryField replaces a field of the query. The value is written the same way as the corresponding clause of the
+// text syntax (see ParseTextQuery) e.g.
+//
+//	calculations  COUNT, P99(duration_ms)
+//	where         service.name = api AND error exists
+//	breakdowns    http.route, service.name
+//	since         2h
+//	limit         50
+//
+// An empty value clears the field.
+func SetQueryField(q *HoneycombQuery, field string, value string) error {
+	name := strings.ToLower(field)
+	if alias, ok := queryFieldAliases[name]; ok {
+		name = alias
+	}
+	clause, ok := queryFieldClauses[name]
+	if !ok {
+		return errors.Errorf("Unknown query field %v; the fields are %v", field, strings.Join(QueryFields(), ", "))
+	}
+	value = strings.TrimSpace(value)
+
+	if name == "filter_combination" {
+		switch strings.ToUpper(value) {
+		case "", "AND":
+			q.FilterCombination = ""
+		case "OR":
+			q.FilterCombination = "OR"
+		default:
+			return errors.Errorf("filter_combination should be AND or OR not %v", value)
+		}
+		return nil
+	}
+
+	parsed := &HoneycombQuery{}
+	if value != "" {
+		var err error
+		parsed, err = ParseTextQuery(strings.TrimSpace(clause + " " + value))
+		if err != nil {
+			return errors.Wrapf(err, "Failed to parse the value of %v", name)
+		}
+	}
+
+	switch name {
+	case "calculations":
+		q.Calculations = parsed.Calculations
+	case "where":
+		q.Filters = parsed.Filters
+		q.FilterCombination = parsed.FilterCombination
+	case "breakdowns":
+		q.Breakdowns = parsed.Breakdowns
+	case "havings":
+		q.Havings = parsed.Havings
+	case "orders":
+		q.Orders = parsed.Orders
+	case "limit":
+		q.Limit = parsed.Limit
+	case "granularity":
+		q.Granularity = parsed.Granularity
+	case "since":
+		q.TimeRange = parsed.TimeRange
+		q.StartTime = 0
+		q.EndTime = 0
+	}
+	return nil
+}
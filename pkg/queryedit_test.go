@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_SetQueryField(t *testing.T) {
+	type testCase struct {
+		name     string
+		field    string
+		value    string
+		expected HoneycombQuery
+		err      bool
+	}
+
+	base := func() HoneycombQuery {
+		return HoneycombQuery{
+			Calculations: []Calculation{{Op: "COUNT"}},
+			Filters:      []Filter{{Column: "error", Op: "exists"}},
+			Breakdowns:   []string{"name"},
+			StartTime:    100,
+			EndTime:      200,
+			Limit:        10,
+		}
+	}
+
+	cases := []testCase{
+		{
+			name:  "limit",
+			field: "limit",
+			value: "50",
+			expected: HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Column: "error", Op: "exists"}},
+				Breakdowns:   []string{"name"},
+				StartTime:    100,
+				EndTime:      200,
+				Limit:        50,
+			},
+		},
+		{
+			name:  "breakdowns-alias",
+			field: "group_by",
+			value: "name, service.name",
+			expected: HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Column: "error", Op: "exists"}},
+				Breakdowns:   []string{"name", "service.name"},
+				StartTime:    100,
+				EndTime:      200,
+				Limit:        10,
+			},
+		},
+		{
+			name:  "where-or",
+			field: "where",
+			value: "status_code >= 500 OR error exists",
+			expected: HoneycombQuery{
+				Calculations:      []Calculation{{Op: "COUNT"}},
+				Filters:           []Filter{{Column: "status_code", Op: ">=", Value: "500"}, {Column: "error", Op: "exists"}},
+				FilterCombination: "OR",
+				Breakdowns:        []string{"name"},
+				StartTime:         100,
+				EndTime:           200,
+				Limit:             10,
+			},
+		},
+		{
+			name:  "since-clears-absolute-time",
+			field: "since",
+			value: "2h",
+			expected: HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Column: "error", Op: "exists"}},
+				Breakdowns:   []string{"name"},
+				TimeRange:    7200,
+				Limit:        10,
+			},
+		},
+		{
+			name:  "clear",
+			field: "breakdowns",
+			value: "",
+			expected: HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Column: "error", Op: "exists"}},
+				StartTime:    100,
+				EndTime:      200,
+				Limit:        10,
+			},
+		},
+		{
+			name:  "unknown",
+			field: "colour",
+			value: "red",
+			err:   true,
+		},
+		{
+			name:  "invalid",
+			field: "limit",
+			value: "many",
+			err:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := base()
+			err := SetQueryField(&q, c.field, c.value)
+			if c.err {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetQueryField failed; %v", err)
+			}
+			if d := cmp.Diff(c.expected, q); d != "" {
+				t.Errorf("Unexpected query;diff:\n%v", d)
+			}
+		})
+	}
+}
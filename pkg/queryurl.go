@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// QueryGetter looks up queries and query results by ID; it is implemented by HoneycombClient.
+type QueryGetter interface {
+	GetQuery(datasetSlug string, id string) (*HoneycombQuery, error)
+	GetResultQueryID(datasetSlug string, resultID string) (string, error)
+}
+
+// ParseQueryURL parses a link to a query in the Honeycomb UI. Two kinds of links are supported
+//
+//	template links   https://ui.honeycomb.io/<team>/environments/<env>/datasets/<dataset>?query={...}
+//	result links     https://ui.honeycomb.io/<team>/environments/<env>/datasets/<dataset>/result/<id>
+//
+// Classic links without the environment are also supported. Links without a dataset are environment wide so the
+// dataset is AllDatasets. The query is only set for template links; use URLToQuery to look up the query of a result.
+func ParseQueryURL(link string) (*QueryLink, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse URL %v", link)
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("%v isn't an absolute URL", link)
+	}
+
+	l := &QueryLink{URL: link}
+	if err := parseUIPath(u, l); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse URL %v", link)
+	}
+
+	if raw, ok := rawQueryParam(u.RawQuery); ok {
+		q, err := parseQueryParam(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse the query parameter of %v", link)
+		}
+		l.Query = q
+	}
+	if l.Query == nil && l.ResultID == "" {
+		return nil, errors.Errorf("%v isn't a link to a query; it should have a query parameter or be a link to a result", link)
+	}
+	return l, nil
+}
+
+// URLToQuery returns the query of a link to the Honeycomb UI; see ParseQueryURL. The queries of result links are
+// looked up with the getter; it can be nil for template links.
+func URLToQuery(link string, getter QueryGetter) (*QueryLink, error) {
+	l, err := ParseQueryURL(link)
+	if err != nil {
+		return nil, err
+	}
+	if l.Query != nil {
+		return l, nil
+	}
+	if getter == nil {
+		return nil, errors.Errorf("The query of result %v has to be fetched from Honeycomb", l.ResultID)
+	}
+	l.QueryID, err = getter.GetResultQueryID(l.Dataset, l.ResultID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get query result %v", l.ResultID)
+	}
+	l.Query, err = getter.GetQuery(l.Dataset, l.QueryID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get query %v", l.QueryID)
+	}
+	// The ID is reported separately; leaving it in the query would stop the query being created again.
+	l.Query.ID = nil
+	return l, nil
+}
+
+// parseUIPath sets the team, environment, dataset and result of the link from the path of a URL in the Honeycomb UI
+// e.g. /<team>/environments/<env>/datasets/<dataset>/result/<id>. The dataset is AllDatasets if the path doesn't
+// have one.
+func parseUIPath(u *url.URL, l *QueryLink) error {
+	l.Dataset = AllDatasets
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	for i := 0; i < len(segments); i++ {
+		next := ""
+		if i+1 < len(segments) {
+			var err error
+			next, err = url.PathUnescape(segments[i+1])
+			if err != nil {
+				return err
+			}
+		}
+		switch segments[i] {
+		case "environments":
+			l.Environment = next
+		case "datasets":
+			l.Dataset = next
+		case "result":
+			l.ResultID = next
+		default:
+			if i == 0 {
+				team, err := url.PathUnescape(segments[i])
+				if err != nil {
+					return err
+				}
+				l.Team = team
+			}
+			continue
+		}
+		i++
+	}
+	return nil
+}
+
+// rawQueryParam returns the undecoded value of the query parameter.
+// Anything after the parameter is included since links written without encoding the JSON e.g. by QueryToURL can
+// contain &; see parseQueryParam.
+func rawQueryParam(rawQuery string) (string, bool) {
+	offset := 0
+	for _, p := range strings.Split(rawQuery, "&") {
+		if strings.HasPrefix(p, "query=") {
+			return rawQuery[offset+len("query="):], true
+		}
+		offset += len(p) + 1
+	}
+	return "", false
+}
+
+// parseQueryParam parses the value of the query parameter. Links copied from the UI are percent encoded but links
+// written by hand or by QueryToURL contain raw JSON which can include & and + so the value is tried with fewer of the
+// following parameters until it parses.
+func parseQueryParam(raw string) (*HoneycombQuery, error) {
+	decoders := []func(string) (string, error){url.QueryUnescape}
+	if strings.ContainsAny(raw, `{"'`) {
+		// + is only a space in encoded values and raw values can contain % e.g. in a filter value.
+		decoders = []func(string) (string, error){url.PathUnescape, func(s string) (string, error) { return s, nil }}
+	}
+
+	var firstErr error
+	for {
+		for _, decode := range decoders {
+			v, err := decode(raw)
+			if err != nil {
+				continue
+			}
+			q, err := ParseQuery(v)
+			if err == nil {
+				return q, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		i := strings.LastIndex(raw, "&")
+		if i < 0 {
+			break
+		}
+		raw = raw[:i]
+	}
+	if firstErr == nil {
+		firstErr = errors.New("The query parameter isn't percent encoded correctly")
+	}
+	return nil, firstErr
+}
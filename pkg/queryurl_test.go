@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+// fakeQueryGetter returns the queries of the results in a single dataset.
+type fakeQueryGetter struct {
+	dataset string
+	results map[string]string
+	queries map[string]HoneycombQuery
+}
+
+func (f *fakeQueryGetter) GetQuery(datasetSlug string, id string) (*HoneycombQuery, error) {
+	q, ok := f.queries[id]
+	if !ok || datasetSlug != f.dataset {
+		return nil, errors.Errorf("query %v/%v not found", datasetSlug, id)
+	}
+	q.ID = PtrToString(id)
+	return &q, nil
+}
+
+func (f *fakeQueryGetter) GetResultQueryID(datasetSlug string, resultID string) (string, error) {
+	id, ok := f.results[resultID]
+	if !ok || datasetSlug != f.dataset {
+		return "", errors.Errorf("result %v/%v not found", datasetSlug, resultID)
+	}
+	return id, nil
+}
+
+func Test_URLToQuery(t *testing.T) {
+	type testCase struct {
+		name     string
+		link     string
+		expected *QueryLink
+		err      bool
+	}
+
+	q := HoneycombQuery{
+		Calculations: []Calculation{{Op: "COUNT"}},
+		Filters:      []Filter{{Column: "http.route", Op: "=", Value: "/a&b+c"}},
+		TimeRange:    3600,
+	}
+	raw := `{"calculations":[{"op":"COUNT"}],"filters":[{"op":"=","column":"http.route","value":"/a&b+c"}],"time_range":3600}`
+	base := "https://ui.honeycomb.io/team/environments/prod"
+
+	getter := &fakeQueryGetter{
+		dataset: "api",
+		results: map[string]string{"mm2wZinaKtT": "q1"},
+		queries: map[string]HoneycombQuery{"q1": q},
+	}
+
+	cases := []testCase{
+		{
+			name:     "template-raw",
+			link:     base + "/datasets/api?query=" + raw,
+			expected: &QueryLink{Team: "team", Environment: "prod", Dataset: "api", Query: &q},
+		},
+		{
+			name:     "template-encoded",
+			link:     base + "/datasets/api?query=" + url.QueryEscape(raw) + "&omitMissingValues",
+			expected: &QueryLink{Team: "team", Environment: "prod", Dataset: "api", Query: &q},
+		},
+		{
+			name:     "template-raw-with-params",
+			link:     base + "/datasets/api?query=" + raw + "&vis=table",
+			expected: &QueryLink{Team: "team", Environment: "prod", Dataset: "api", Query: &q},
+		},
+		{
+			// Filters on numeric and boolean columns have numeric and boolean values.
+			name: "template-typed-values",
+			link: base + "/datasets/api?query=" + url.QueryEscape(`{"calculations":[{"op":"COUNT"}],"filters":[{"column":"http.status_code","op":">=","value":500},{"column":"error","op":"=","value":true},{"column":"http.method","op":"in","value":["GET","POST"]}]}`),
+			expected: &QueryLink{Team: "team", Environment: "prod", Dataset: "api", Query: &HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters: []Filter{
+					{Column: "http.status_code", Op: ">=", Value: "500", RawValue: json.RawMessage("500")},
+					{Column: "error", Op: "=", Value: "true", RawValue: json.RawMessage("true")},
+					{Column: "http.method", Op: "in", Values: []string{"GET", "POST"}},
+				},
+			}},
+		},
+		{
+			name:     "environment-wide",
+			link:     base + "?query=" + url.QueryEscape(raw),
+			expected: &QueryLink{Team: "team", Environment: "prod", Dataset: AllDatasets, Query: &q},
+		},
+		{
+			name:     "classic",
+			link:     "https://ui.honeycomb.io/team/datasets/api?query=" + url.QueryEscape(raw),
+			expected: &QueryLink{Team: "team", Dataset: "api", Query: &q},
+		},
+		{
+			name:     "result",
+			link:     base + "/datasets/api/result/mm2wZinaKtT",
+			expected: &QueryLink{Team: "team", Environment: "prod", Dataset: "api", ResultID: "mm2wZinaKtT", QueryID: "q1", Query: &q},
+		},
+		{
+			name:     "result-trailing-path",
+			link:     base + "/datasets/api/result/mm2wZinaKtT/a1b2c3?tab=traces",
+			expected: &QueryLink{Team: "team", Environment: "prod", Dataset: "api", ResultID: "mm2wZinaKtT", QueryID: "q1", Query: &q},
+		},
+		{
+			name: "unknown-result",
+			link: base + "/datasets/api/result/missing",
+			err:  true,
+		},
+		{
+			name: "not-a-query",
+			link: base + "/datasets/api",
+			err:  true,
+		},
+		{
+			name: "bad-query",
+			link: base + "/datasets/api?query=" + url.QueryEscape("not a query"),
+			err:  true,
+		},
+		{
+			name: "relative",
+			link: "/datasets/api?query=" + raw,
+			err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := URLToQuery(c.link, getter)
+			if c.err {
+				if err == nil {
+					t.Fatalf("Expected an error; got %+v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse URL; %v", err)
+			}
+			c.expected.URL = c.link
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected query link;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_URLToQueryRoundTrip(t *testing.T) {
+	q := HoneycombQuery{
+		Calculations: []Calculation{{Op: "P99", Column: "duration_ms"}},
+		Filters: []Filter{
+			{Column: "name", Op: "starts-with", Value: "GET 50%"},
+			{Column: "http.route", Op: "in", Values: []string{"/a,b", "/c"}},
+		},
+		Breakdowns: []string{"http.route"},
+		TimeRange:  7200,
+	}
+	link, err := QueryToURL(q, "https://ui.honeycomb.io/team/environments/prod", "api")
+	if err != nil {
+		t.Fatalf("Failed to create URL; %v", err)
+	}
+	decoded, err := url.QueryUnescape(link)
+	if err != nil {
+		t.Fatalf("Failed to decode URL; %v", err)
+	}
+	if !strings.Contains(decoded, `"value":["/a,b","/c"]`) {
+		t.Errorf("List values should be written as a list; got %v", decoded)
+	}
+	actual, err := URLToQuery(link, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse URL; %v", err)
+	}
+	if d := cmp.Diff(&q, actual.Query); d != "" {
+		t.Errorf("Query didn't survive the round trip;diff:\n%v", d)
+	}
+
+	text, err := ParseTextQuery(FormatTextQuery(q))
+	if err != nil {
+		t.Fatalf("Failed to parse text query; %v", err)
+	}
+	if d := cmp.Diff(q.Filters, text.Filters); d != "" {
+		t.Errorf("Filters didn't survive the text round trip;diff:\n%v", d)
+	}
+}
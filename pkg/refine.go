@@ -0,0 +1,347 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// RefineInput asks for an earlier query to be changed e.g. "same as before but for the last hour".
+type RefineInput struct {
+	// Questions are the question the query answers followed by any earlier follow ups.
+	Questions []string
+	Query     HoneycombQuery
+	// Instruction describes the change.
+	Instruction string
+	// COLS are the serialized columns of the dataset; see QueryInput.
+	COLS string
+}
+
+// Refiner changes an earlier query as described by an instruction.
+// The output of the translation is the modified query in any of the formats accepted by ParseQuery.
+type Refiner interface {
+	Refine(in RefineInput) (*Translation, error)
+}
+
+// NewRefiner returns the Refiner to use with the translator.
+// Translators that implement Refiner (e.g. chat models) are used first and the rules are used if they fail.
+// Other translators were trained to answer a single question so the rules are tried first; instructions the rules
+// don't understand are sent to the translator along with the earlier questions and the query.
+func NewRefiner(t Translator) Refiner {
+	if r, ok := t.(Refiner); ok {
+		return &fallbackRefiner{refiners: []Refiner{r, &RuleRefiner{}}}
+	}
+	return &fallbackRefiner{refiners: []Refiner{&RuleRefiner{}, &PromptRefiner{Translator: t}}}
+}
+
+// RunRefinement refines the query and returns an entry describing the refinement; see RunTranslation.
+// The NLQ of the entry is the instruction.
+func RunRefinement(r Refiner, in RefineInput) (*HistoryEntry, error) {
+	e, err := runTranslation(in.Instruction, in.COLS, func() (*Translation, error) {
+		return r.Refine(in)
+	})
+	previous := in.Query
+	e.Refines = &previous
+	return e, err
+}
+
+// fallbackRefiner tries each refiner in turn until one produces a query.
+type fallbackRefiner struct {
+	refiners []Refiner
+}
+
+func (f *fallbackRefiner) Refine(in RefineInput) (*Translation, error) {
+	log := zapr.NewLogger(zap.L())
+	problems := make([]string, 0, len(f.refiners))
+	for _, r := range f.refiners {
+		t, err := r.Refine(in)
+		if err == nil {
+			err = validateRefinement(t.Output)
+		}
+		if err == nil {
+			return t, nil
+		}
+		log.V(1).Info("Refiner failed", "refiner", fmt.Sprintf("%T", r), "instruction", in.Instruction, "err", err.Error())
+		problems = append(problems, err.Error())
+	}
+	return nil, errors.Errorf("Failed to refine the query; %v", strings.Join(problems, "; "))
+}
+
+// validateRefinement checks the output of a refiner is a query Honeycomb will accept so a refinement that breaks the
+// query e.g. by ordering on a breakdown it removed falls through to the next refiner.
+func validateRefinement(output string) error {
+	q, err := ParseQuery(output)
+	if err != nil {
+		return err
+	}
+	return ValidateQuery(*q)
+}
+
+// PromptRefiner refines queries with a translator that only answers single questions. The translator is sent the
+// earlier questions, the instruction and the query as one question.
+type PromptRefiner struct {
+	Translator Translator
+}
+
+func (p *PromptRefiner) Refine(in RefineInput) (*Translation, error) {
+	b, err := json.Marshal(in.Query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to serialize query")
+	}
+	questions := append(append([]string{}, in.Questions...), in.Instruction)
+	nlq := fmt.Sprintf("%s\nThe previous query was %s", strings.Join(questions, ". "), string(b))
+	return TranslateDetailed(p.Translator, QueryInput{NLQ: nlq, COLS: in.COLS})
+}
+
+// RuleRefiner refines queries without a model by recognizing common edits:
+//
+//	time range   for the last hour, past 30 minutes, last 7d
+//	limit        limit 20, top 5
+//	breakdowns   group by http.route, also break down by region, remove the breakdown on name
+//	filters      where status_code >= 500, only where service.name = api, remove the filter on error
+//
+// Filters and breakdowns are written the same way as in the text syntax; see ParseTextQuery.
+// Breakdowns replace the existing ones unless the instruction says add, also, too or as well.
+type RuleRefiner struct{}
+
+// RuleRefinerModel is the model reported in the translations produced by RuleRefiner.
+const RuleRefinerModel = "rules"
+
+// refineRule is an edit RuleRefiner recognizes. apply is called with the submatches of pattern.
+type refineRule struct {
+	pattern *regexp.Regexp
+	apply   func(q *HoneycombQuery, m []string, additive bool) error
+}
+
+var (
+	// refineFillers are stripped from the start of instructions.
+	refineFillers = regexp.MustCompile(`(?i)^(?:(?:same as before|same query|same|but|and|now|then|please|instead)\b|,)\s*`)
+	// refineAdditive are words that make breakdowns be added rather than replaced.
+	refineAdditive = regexp.MustCompile(`(?i)(^also\b|\s+(too|as well)$)`)
+	refineInstead  = regexp.MustCompile(`(?i)\s+instead$`)
+	refineAnd      = regexp.MustCompile(`(?i)\s+and\s+`)
+
+	refineUnits = map[string]int{
+		"s": 1, "sec": 1, "secs": 1, "second": 1, "seconds": 1,
+		"m": 60, "min": 60, "mins": 60, "minute": 60, "minutes": 60,
+		"h": 3600, "hr": 3600, "hrs": 3600, "hour": 3600, "hours": 3600,
+		"d": 86400, "day": 86400, "days": 86400,
+		"w": 604800, "week": 604800, "weeks": 604800,
+	}
+
+	refineRules = []refineRule{
+		{
+			pattern: regexp.MustCompile(`(?i)^(?:(?:for|over|in|during|from) )?(?:the )?(?:last|past|previous) (?:(\d+) ?)?([a-z]+)$`),
+			apply:   refineTimeRange,
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)^(?:limit(?: it)?(?: to)?|(?:only )?(?:show )?(?:the )?top) (\d+)(?: results| rows| groups)?$`),
+			apply: func(q *HoneycombQuery, m []string, _ bool) error {
+				limit, err := strconv.Atoi(m[1])
+				if err != nil {
+					return errors.Wrapf(err, "%v isn't a valid limit", m[1])
+				}
+				q.Limit = limit
+				return nil
+			},
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)^(?:remove|drop|clear) (?:the |all )?(?:breakdowns?|grouping|group by)(?: (?:on|by|of) (.+))?$`),
+			apply: func(q *HoneycombQuery, m []string, _ bool) error {
+				if m[1] == "" {
+					q.Breakdowns = nil
+					dropBreakdownOrders(q)
+					return nil
+				}
+				remove, err := refineColumns(m[1])
+				if err != nil {
+					return err
+				}
+				kept := make([]string, 0, len(q.Breakdowns))
+				for _, b := range q.Breakdowns {
+					if !slices.Contains(remove, b) {
+						kept = append(kept, b)
+					}
+				}
+				if len(kept) == len(q.Breakdowns) {
+					return errors.Errorf("The query isn't grouped by %v", m[1])
+				}
+				q.Breakdowns = kept
+				dropBreakdownOrders(q)
+				return nil
+			},
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)^(?:(?:add (?:a )?)?(?:group(?:ed)?|break(?: ?down)?|broken down|breakdown|split|segment)(?: it)? (?:by|on)|add (?:a )?breakdown(?: by| on)?) (.+)$`),
+			apply: func(q *HoneycombQuery, m []string, additive bool) error {
+				columns, err := refineColumns(m[1])
+				if err != nil {
+					return err
+				}
+				if !additive && !strings.HasPrefix(strings.ToLower(m[0]), "add ") {
+					q.Breakdowns = columns
+					dropBreakdownOrders(q)
+					return nil
+				}
+				for _, c := range columns {
+					if !slices.Contains(q.Breakdowns, c) {
+						q.Breakdowns = append(q.Breakdowns, c)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)^(?:remove|drop|clear) (?:the |all )?filters?(?: (?:on|for) (.+))?$`),
+			apply: func(q *HoneycombQuery, m []string, _ bool) error {
+				if m[1] == "" {
+					q.Filters = nil
+					q.FilterCombination = ""
+					return nil
+				}
+				remove, err := refineColumns(m[1])
+				if err != nil {
+					return err
+				}
+				kept := make([]Filter, 0, len(q.Filters))
+				for _, f := range q.Filters {
+					if col, ok := f.Column.(string); !ok || !slices.Contains(remove, col) {
+						kept = append(kept, f)
+					}
+				}
+				if len(kept) == len(q.Filters) {
+					return errors.Errorf("The query doesn't filter on %v", m[1])
+				}
+				q.Filters = kept
+				if len(kept) < 2 {
+					q.FilterCombination = ""
+				}
+				return nil
+			},
+		},
+		{
+			pattern: regexp.MustCompile(`(?i)^(?:(?:add (?:a )?)?filter(?: it)?(?: (?:by|on|to|for|where))?|(?:only )?where|only(?: when| for| show)?|filtered (?:by|to)|restrict(?: it)? to) (.+)$`),
+			apply: func(q *HoneycombQuery, m []string, _ bool) error {
+				parsed, err := ParseTextQuery("WHERE " + m[1])
+				if err != nil {
+					return errors.Wrapf(err, "Failed to parse the filter %v", m[1])
+				}
+				if len(q.Filters) > 0 && (q.FilterCombination == "OR" || parsed.FilterCombination == "OR") {
+					return errors.New("Filters can only be added to queries that combine their filters with AND")
+				}
+				q.Filters = append(q.Filters, parsed.Filters...)
+				if len(q.Filters) == len(parsed.Filters) {
+					q.FilterCombination = parsed.FilterCombination
+				}
+				return nil
+			},
+		},
+	}
+)
+
+func (r *RuleRefiner) Refine(in RefineInput) (*Translation, error) {
+	q, err := RefineWithRules(in.Query, in.Instruction)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to serialize query")
+	}
+	return &Translation{Output: string(b), Model: RuleRefinerModel}, nil
+}
+
+// RefineWithRules applies the edit described by the instruction to a copy of the query; see RuleRefiner.
+// An error is returned if the instruction isn't one of the edits the rules recognize.
+func RefineWithRules(query HoneycombQuery, instruction string) (*HoneycombQuery, error) {
+	s := strings.TrimRight(strings.TrimSpace(instruction), ".!")
+	additive := false
+	for {
+		if refineAdditive.MatchString(s) {
+			additive = true
+		}
+		trimmed := refineInstead.ReplaceAllString(refineAdditive.ReplaceAllString(s, ""), "")
+		trimmed = strings.TrimSpace(refineFillers.ReplaceAllString(trimmed, ""))
+		if trimmed == s {
+			break
+		}
+		s = trimmed
+	}
+
+	for _, rule := range refineRules {
+		m := rule.pattern.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		q := copyQuery(query)
+		if err := rule.apply(&q, m, additive); err != nil {
+			return nil, err
+		}
+		return &q, nil
+	}
+	return nil, errors.Errorf("The rules don't recognize the instruction %q", instruction)
+}
+
+// refineTimeRange sets a relative time range; m is the amount (which defaults to 1) and the unit.
+func refineTimeRange(q *HoneycombQuery, m []string, _ bool) error {
+	unit, ok := refineUnits[strings.ToLower(m[2])]
+	if !ok {
+		return errors.Errorf("%v isn't a unit of time", m[2])
+	}
+	n := 1
+	if m[1] != "" {
+		var err error
+		n, err = strconv.Atoi(m[1])
+		if err != nil || n <= 0 {
+			return errors.Errorf("%v isn't a valid amount of time", m[1])
+		}
+	}
+	q.TimeRange = n * unit
+	q.StartTime = 0
+	q.EndTime = 0
+	if q.Granularity != 0 {
+		q.Granularity = PickGranularity(q.TimeRange)
+	}
+	return nil
+}
+
+// refineColumns parses a list of columns such as "region and service.name" or "region, name".
+func refineColumns(s string) ([]string, error) {
+	s = refineAnd.ReplaceAllString(strings.TrimSpace(s), ", ")
+	parsed, err := ParseTextQuery("GROUP BY " + s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse the columns %v", s)
+	}
+	return parsed.Breakdowns, nil
+}
+
+// dropBreakdownOrders removes the orders on columns that are no longer breakdowns; orders on calculations are kept.
+func dropBreakdownOrders(q *HoneycombQuery) {
+	if len(q.Orders) == 0 {
+		return
+	}
+	kept := make([]Order, 0, len(q.Orders))
+	for _, o := range q.Orders {
+		if o.Op != "" || slices.Contains(q.Breakdowns, o.Column) {
+			kept = append(kept, o)
+		}
+	}
+	q.Orders = kept
+}
+
+// copyQuery returns a copy of the query that doesn't share slices with it.
+func copyQuery(q HoneycombQuery) HoneycombQuery {
+	q.Breakdowns = slices.Clone(q.Breakdowns)
+	q.Calculations = slices.Clone(q.Calculations)
+	q.Filters = slices.Clone(q.Filters)
+	q.Orders = slices.Clone(q.Orders)
+	q.Havings = slices.Clone(q.Havings)
+	return q
+}
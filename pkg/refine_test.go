@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_RefineWithRules(t *testing.T) {
+	type testCase struct {
+		name        string
+		query       *HoneycombQuery
+		instruction string
+		expected    string
+		err         bool
+	}
+
+	base := HoneycombQuery{
+		Calculations: []Calculation{{Op: "COUNT"}},
+		Filters:      []Filter{{Column: "error", Op: "exists"}},
+		Breakdowns:   []string{"name"},
+		StartTime:    100,
+		EndTime:      200,
+		Limit:        10,
+	}
+
+	ordered := base
+	ordered.Orders = []Order{{Column: "name", Order: "ascending"}, {Op: "COUNT", Order: "descending"}}
+
+	cases := []testCase{
+		{
+			name:        "last-hour",
+			instruction: "same as before but for the last hour",
+			expected:    "COUNT WHERE error exists GROUP BY name LAST 1h LIMIT 10",
+		},
+		{
+			name:        "past-minutes",
+			instruction: "Now over the past 30 minutes.",
+			expected:    "COUNT WHERE error exists GROUP BY name LAST 30m LIMIT 10",
+		},
+		{
+			name:        "compact-duration",
+			instruction: "last 7d instead",
+			expected:    "COUNT WHERE error exists GROUP BY name LAST 7d LIMIT 10",
+		},
+		{
+			name:        "limit",
+			instruction: "only show the top 5",
+			expected:    "COUNT WHERE error exists GROUP BY name FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 5",
+		},
+		{
+			name:        "replace-breakdown",
+			instruction: "group by http.route and service.name instead",
+			expected:    "COUNT WHERE error exists GROUP BY http.route, service.name FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "add-breakdown-too",
+			instruction: "break down by region too",
+			expected:    "COUNT WHERE error exists GROUP BY name, region FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "add-breakdown-also",
+			instruction: "and also group by name, region",
+			expected:    "COUNT WHERE error exists GROUP BY name, region FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "remove-breakdown",
+			instruction: "remove the breakdown on name",
+			expected:    "COUNT WHERE error exists FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "remove-breakdown-orders",
+			query:       &ordered,
+			instruction: "remove the breakdown on name",
+			expected:    "COUNT WHERE error exists ORDER BY COUNT desc FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "replace-breakdown-orders",
+			query:       &ordered,
+			instruction: "group by region",
+			expected:    "COUNT WHERE error exists GROUP BY region ORDER BY COUNT desc FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "add-filter",
+			instruction: "only where service.name = api",
+			expected:    "COUNT WHERE error exists AND service.name = api GROUP BY name FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "add-filters",
+			instruction: "filter to status_code >= 500 and http.route starts-with /api",
+			expected:    "COUNT WHERE error exists AND status_code >= 500 AND http.route starts-with /api GROUP BY name FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "remove-filter",
+			instruction: "drop the filter on error",
+			expected:    "COUNT GROUP BY name FROM 1970-01-01T00:01:40Z TO 1970-01-01T00:03:20Z LIMIT 10",
+		},
+		{
+			name:        "add-or-filter",
+			instruction: "where status_code >= 500 OR duration_ms > 1000",
+			err:         true,
+		},
+		{
+			name:        "unknown",
+			instruction: "only errors",
+			err:         true,
+		},
+		{
+			name:        "unknown-unit",
+			instruction: "for the last fortnight",
+			err:         true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			query := base
+			if c.query != nil {
+				query = *c.query
+			}
+			actual, err := RefineWithRules(query, c.instruction)
+			if c.err {
+				if err == nil {
+					t.Fatalf("Expected an error; got %v", FormatTextQuery(*actual))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to refine query; %v", err)
+			}
+			if d := cmp.Diff(c.expected, FormatTextQuery(*actual)); d != "" {
+				t.Errorf("Unexpected query;diff:\n%v", d)
+			}
+		})
+	}
+
+	if d := cmp.Diff([]string{"name"}, base.Breakdowns); d != "" {
+		t.Errorf("The original query was modified;diff:\n%v", d)
+	}
+}
+
+func Test_NewRefiner(t *testing.T) {
+	// The translator is only asked the follow up that the rules don't recognize.
+	prompt := "count requests. only errors\nThe previous query was {\"calculations\":[{\"op\":\"COUNT\"}],\"filters\":null}"
+	translator := &fakeTranslator{
+		outputs: map[string]string{
+			prompt: "{'calculations': [{'op': 'COUNT'}], 'filters': [{'column': 'error', 'op': '=', 'value': 'true'}]}",
+		},
+	}
+	r := NewRefiner(translator)
+	in := RefineInput{
+		Questions: []string{"count requests"},
+		Query:     HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}},
+	}
+
+	in.Instruction = "for the last hour"
+	e, err := RunRefinement(r, in)
+	if err != nil {
+		t.Fatalf("Failed to refine query; %v", err)
+	}
+	if e.Model != RuleRefinerModel || e.Query.TimeRange != 3600 || e.Refines == nil {
+		t.Errorf("Expected the rules to set the time range; got %+v", e)
+	}
+
+	in.Instruction = "only errors"
+	e, err = RunRefinement(r, in)
+	if err != nil {
+		t.Fatalf("Failed to refine query; %v", err)
+	}
+	if e.Model == RuleRefinerModel || len(e.Query.Filters) != 1 {
+		t.Errorf("Expected the translator's query; got %+v", e)
+	}
+}
+
+// fakeRefiner returns a canned refinement.
+type fakeRefiner struct {
+	output string
+}
+
+func (f *fakeRefiner) Refine(in RefineInput) (*Translation, error) {
+	return &Translation{Output: f.output, Model: "fake"}, nil
+}
+
+func Test_FallbackRefinerValidates(t *testing.T) {
+	// The first refiner orders by a column that isn't a breakdown so Honeycomb would reject its query.
+	r := &fallbackRefiner{refiners: []Refiner{
+		&fakeRefiner{output: `{"calculations": [{"op": "COUNT"}], "orders": [{"column": "name"}]}`},
+		&RuleRefiner{},
+	}}
+	in := RefineInput{
+		Query:       HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}, Breakdowns: []string{"name"}, Orders: []Order{{Column: "name"}}},
+		Instruction: "remove the breakdown",
+	}
+	e, err := RunRefinement(r, in)
+	if err != nil {
+		t.Fatalf("Failed to refine query; %v", err)
+	}
+	if e.Model != RuleRefinerModel || len(e.Query.Orders) != 0 || len(e.Query.Breakdowns) != 0 {
+		t.Errorf("Expected the rules' query; got %+v", e)
+	}
+}
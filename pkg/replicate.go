@@ -2,11 +2,10 @@ package pkg
 
 import (
 	"context"
-	"strings"
 
 	"github.com/go-logr/zapr"
 	"github.com/jlewi/hccli/pkg/config"
-	"github.com/jlewi/hydros/pkg/files"
+	"github.com/jlewi/hccli/pkg/secrets"
 	"github.com/pkg/errors"
 	"github.com/replicate/replicate-go"
 	"go.uber.org/zap"
@@ -19,11 +18,15 @@ type ReplicateClient struct {
 }
 
 func NewReplicateClient(cfg config.Config) (*ReplicateClient, error) {
-	token, err := files.Read(cfg.Replicate.APITokenFile)
+	r := cfg.GetTranslator().Replicate
+	if r == nil {
+		return nil, errors.New("translator.replicate isn't configured")
+	}
+	token, err := secrets.Resolve(r.APITokenFile)
 	if err != nil {
-		return nil, errors.Wrapf(err, "Failed to read Replicate API token from file %s", cfg.Replicate.APITokenFile)
+		return nil, errors.Wrapf(err, "Failed to read Replicate API token from %s", r.APITokenFile)
 	}
-	r8, err := replicate.NewClient(replicate.WithToken(strings.TrimSpace(string(token))))
+	r8, err := replicate.NewClient(replicate.WithToken(token))
 	if err != nil {
 		return nil, errors.Wrapf(err, "Failed to create Replicate client")
 	}
@@ -35,6 +38,15 @@ func NewReplicateClient(cfg config.Config) (*ReplicateClient, error) {
 
 // Translate takes a natural language query and returns the honeycomb query as a string
 func (p *ReplicateClient) Translate(inQuery QueryInput) (string, error) {
+	t, err := p.TranslateDetailed(inQuery)
+	if err != nil {
+		return "", err
+	}
+	return t.Output, nil
+}
+
+// TranslateDetailed returns the query along with the model, version and prediction time reported by Replicate.
+func (p *ReplicateClient) TranslateDetailed(inQuery QueryInput) (*Translation, error) {
 	log := zapr.NewLogger(zap.L())
 
 	input := replicate.PredictionInput{
@@ -42,20 +54,41 @@ func (p *ReplicateClient) Translate(inQuery QueryInput) (string, error) {
 		"cols": inQuery.COLS,
 	}
 
+	model := p.config.GetTranslator().Replicate.Model
+	id, err := replicate.ParseIdentifier(model)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse Replicate model %v", model)
+	}
+	if id.Version == nil {
+		return nil, errors.Errorf("Replicate model %v should include a version i.e. owner/name:version", model)
+	}
+
 	// Run a model and wait for its output
 	log.Info("Sending prediction to Replicate", "query", inQuery)
-	output, err := p.client.Run(context.Background(), p.config.Replicate.Model, input, nil)
+	ctx := context.Background()
+	prediction, err := p.client.CreatePrediction(ctx, *id.Version, input, nil, false)
 	if err != nil {
-		return "", errors.Wrapf(err, "Failed to run model")
+		return nil, errors.Wrapf(err, "Failed to run model")
+	}
+	if err := p.client.Wait(ctx, prediction); err != nil {
+		return nil, errors.Wrapf(err, "Failed to run model")
 	}
 
-	log.Info("Received query from Replicate", "output", output)
+	log.Info("Received query from Replicate", "output", prediction.Output)
 
-	outputQuery, ok := output.(string)
+	outputQuery, ok := prediction.Output.(string)
 
 	if !ok {
-		return "", errors.New("Failed to convert output to string")
+		return nil, errors.New("Failed to convert output to string")
 	}
 
-	return outputQuery, nil
+	t := &Translation{
+		Output:  outputQuery,
+		Model:   prediction.Model,
+		Version: prediction.Version,
+	}
+	if prediction.Metrics != nil && prediction.Metrics.PredictTime != nil {
+		t.PredictTime = *prediction.Metrics.PredictTime
+	}
+	return t, nil
 }
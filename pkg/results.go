@@ -0,0 +1,125 @@
+package pkg
+
+// The types in this file are the results commands print with --output json or yaml.
+// Scripts and notebooks depend on their field names so fields should only be added, never renamed or removed.
+
+// TranslationResult is the result of translating a natural language question into a query.
+type TranslationResult struct {
+	// ID identifies the translation in the history.
+	ID         string `json:"id"`
+	NLQ        string `json:"nlq"`
+	Dataset    string `json:"dataset,omitempty"`
+	Translator string `json:"translator"`
+	Model      string `json:"model,omitempty"`
+	Version    string `json:"version,omitempty"`
+	// Output is the raw output of the translator.
+	Output string `json:"output"`
+	// Query is missing if the output couldn't be parsed as a query.
+	Query *HoneycombQuery `json:"query,omitempty"`
+	// Latency is the time in seconds the translation took.
+	Latency float64 `json:"latency"`
+	// SavedAs is the name the query was saved under in the query library.
+	SavedAs string `json:"savedAs,omitempty"`
+	// OutFile is the file the query was written to.
+	OutFile  string   `json:"outFile,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	// Refines is the query that was changed if NLQ is an instruction to refine a query.
+	Refines *HoneycombQuery `json:"refines,omitempty"`
+}
+
+// NewTranslationResult creates the result of the translation recorded in the history entry.
+func NewTranslationResult(e *HistoryEntry) *TranslationResult {
+	r := &TranslationResult{
+		ID:         e.ID,
+		NLQ:        e.NLQ,
+		Dataset:    e.Dataset,
+		Translator: e.Translator,
+		Model:      e.Model,
+		Version:    e.Version,
+		Output:     e.Output,
+		Query:      e.Query,
+		Latency:    e.Latency,
+		Warnings:   make([]string, 0),
+		Refines:    e.Refines,
+	}
+	if e.ParseError != "" {
+		r.Warnings = append(r.Warnings, "The output couldn't be parsed as a query; "+e.ParseError)
+	}
+	return r
+}
+
+// CreatedQuery is a query created in a single dataset.
+type CreatedQuery struct {
+	Dataset string `json:"dataset"`
+	QueryID string `json:"queryID,omitempty"`
+	// URL is only set if baseURL is configured.
+	URL string `json:"url,omitempty"`
+	// Error is set if the query couldn't be created in the dataset.
+	Error string `json:"error,omitempty"`
+}
+
+// CreateQueryResult is the result of creating a query in one or more datasets.
+type CreateQueryResult struct {
+	Query   HoneycombQuery `json:"query"`
+	Queries []CreatedQuery `json:"queries"`
+}
+
+// QueryURL is a link to a query in a single dataset.
+type QueryURL struct {
+	Dataset string `json:"dataset"`
+	URL     string `json:"url"`
+}
+
+// QueryURLResult is the result of turning a query into links.
+type QueryURLResult struct {
+	Query HoneycombQuery `json:"query"`
+	URLs  []QueryURL     `json:"urls"`
+	// OutFile is the file a PNG of the graph was saved to.
+	OutFile string `json:"outFile,omitempty"`
+}
+
+// QueryLink is a query parsed from a link to the Honeycomb UI; see URLToQuery.
+type QueryLink struct {
+	URL         string `json:"url"`
+	Team        string `json:"team,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	// Dataset is AllDatasets for environment wide queries.
+	Dataset string `json:"dataset"`
+	// ResultID and QueryID are only set for links to query results.
+	ResultID string          `json:"resultID,omitempty"`
+	QueryID  string          `json:"queryID,omitempty"`
+	Query    *HoneycombQuery `json:"query"`
+}
+
+// LocalQueryResult is the result of running a query against local events.
+type LocalQueryResult struct {
+	Query HoneycombQuery `json:"query"`
+	// Columns are the breakdowns followed by the names of the calculations; see CalculationName.
+	Columns []string            `json:"columns"`
+	Results []QueryResultRow    `json:"results"`
+	Series  []QueryResultSeries `json:"series,omitempty"`
+}
+
+// QueryDiffResult is the result of comparing two queries.
+type QueryDiffResult struct {
+	Equivalent  bool              `json:"equivalent"`
+	Differences []QueryDifference `json:"differences"`
+}
+
+// ReplayResult is the result of translating a past question again.
+type ReplayResult struct {
+	Original *HistoryEntry `json:"original"`
+	Replay   *HistoryEntry `json:"replay"`
+	// Differences is only set if both outputs could be parsed as queries.
+	Differences []QueryDifference `json:"differences,omitempty"`
+}
+
+// ExplainResult is the result of describing a query in plain English.
+type ExplainResult struct {
+	Query       HoneycombQuery `json:"query"`
+	Explanation string         `json:"explanation"`
+	// Explainer is TemplateExplainer or the translator that wrote the explanation; see TranslatorName.
+	Explainer string   `json:"explainer"`
+	Model     string   `json:"model,omitempty"`
+	Warnings  []string `json:"warnings"`
+}
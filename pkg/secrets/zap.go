@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// redactingCore is a zapcore.Core that removes resolved secrets from log messages and string fields.
+type redactingCore struct {
+	zapcore.Core
+}
+
+// NewRedactingCore wraps core so secrets are redacted before entries are written.
+// Use it with zap.WrapCore.
+func NewRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core}
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(redactFields(fields))}
+}
+
+func (c *redactingCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	e.Message = Redact(e.Message)
+	return c.Core.Write(e, redactFields(fields))
+}
+
+// redactFields redacts string, error and stringer fields as well as structs, maps and objects e.g. a Config logged
+// with zapr; other fields such as numbers are passed through.
+func redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = Redact(f.String)
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				f.Interface = &redactedError{err: err}
+			}
+		case zapcore.StringerType:
+			if s, ok := f.Interface.(interface{ String() string }); ok && s != nil {
+				f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: Redact(s.String())}
+			}
+		case zapcore.ReflectType:
+			f = zapcore.Field{Key: f.Key, Type: zapcore.ReflectType, Interface: redactValue(f.Interface)}
+		case zapcore.ObjectMarshalerType:
+			if m, ok := f.Interface.(zapcore.ObjectMarshaler); ok && m != nil {
+				enc := zapcore.NewMapObjectEncoder()
+				if err := m.MarshalLogObject(enc); err != nil {
+					f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: Redact(fmt.Sprintf("%+v", m))}
+				} else {
+					f = zapcore.Field{Key: f.Key, Type: zapcore.ReflectType, Interface: redactValue(enc.Fields)}
+				}
+			}
+		}
+		redacted[i] = f
+	}
+	return redacted
+}
+
+// redactValue returns a copy of v with the secrets redacted from every string.
+// v is converted to its JSON form, which is how zap encodes it, so the strings of nested structs and maps are
+// redacted after they are unescaped. Values that can't be converted are logged as redacted strings.
+func redactValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Redact(fmt.Sprintf("%+v", v))
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return Redact(string(b))
+	}
+	return redactGeneric(generic)
+}
+
+// redactGeneric redacts the strings in a value decoded from JSON.
+func redactGeneric(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return Redact(t)
+	case []interface{}:
+		for i := range t {
+			t[i] = redactGeneric(t[i])
+		}
+		return t
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(t))
+		for k, c := range t {
+			redacted[Redact(k)] = redactGeneric(c)
+		}
+		return redacted
+	default:
+		return v
+	}
+}
+
+// redactedError redacts an error's message including the verbose message with the stack trace zap logs.
+type redactedError struct {
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return Redact(e.err.Error())
+}
+
+func (e *redactedError) Format(s fmt.State, verb rune) {
+	format := "%" + string(verb)
+	if s.Flag('+') {
+		format = "%+" + string(verb)
+	}
+	fmt.Fprint(s, Redact(fmt.Sprintf(format, e.err)))
+}
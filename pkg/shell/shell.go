@@ -0,0 +1,374 @@
+// Package shell implements the interactive session used by hccli shell to explore a dataset.
+package shell
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/zapr"
+	"github.com/jlewi/hccli/pkg"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Actions are the operations on the current query that need Honeycomb, a browser or Chrome.
+type Actions interface {
+	// Run runs the query and prints the results to w.
+	Run(w io.Writer, dataset string, q pkg.HoneycombQuery) error
+	// Open opens the query in a browser.
+	Open(w io.Writer, dataset string, q pkg.HoneycombQuery) error
+	// Screenshot saves a PNG of the query's graph to file.
+	Screenshot(w io.Writer, dataset string, q pkg.HoneycombQuery, file string) error
+}
+
+// Session is an interactive session exploring a single dataset.
+// The session keeps the current query so follow up questions and edits apply to it.
+type Session struct {
+	Dataset    string
+	Translator pkg.Translator
+	// TranslatorName identifies the translator in the history; see pkg.TranslatorName.
+	TranslatorName string
+	// Refiner applies follow ups to the current query; it defaults to pkg.NewRefiner(Translator).
+	Refiner pkg.Refiner
+	// Columns are the names of the dataset's columns; they are used for completion.
+	Columns []string
+	// PromptColumns returns the serialized columns to send to the translator for the question.
+	PromptColumns func(nlq string) (string, error)
+	// History records the translations if it isn't nil.
+	History *pkg.HistoryStore
+	Actions Actions
+	Out     io.Writer
+
+	// Questions are the question the current query answers followed by any follow ups.
+	Questions []string
+	Query     *pkg.HoneycombQuery
+	// previous are the earlier versions of the current query; see undo.
+	previous []pkg.HoneycombQuery
+}
+
+// command is a command of the shell.
+type command struct {
+	name  string
+	usage string
+	help  string
+}
+
+// commands are the commands of the shell; any other input is treated as a question.
+var commands = []command{
+	{name: "ask", usage: "ask <question>", help: "Translate a new question, discarding the current query"},
+	{name: "show", usage: "show [text|json|yaml]", help: "Print the current query; the default is the text syntax"},
+	{name: "set", usage: "set <field> <value>", help: "Change a field of the current query e.g. set limit 50 or set where error exists"},
+	{name: "explain", usage: "explain", help: "Describe the current query in plain English"},
+	{name: "query", usage: "query <query>", help: "Replace the current query with one written in the text syntax or JSON"},
+	{name: "undo", usage: "undo", help: "Go back to the previous version of the query"},
+	{name: "run", usage: "run", help: "Run the current query with the Query Data API and print the results"},
+	{name: "open", usage: "open", help: "Open the current query in a browser"},
+	{name: "screenshot", usage: "screenshot <file>", help: "Save a PNG of the current query's graph"},
+	{name: "columns", usage: "columns [search]", help: "List the dataset's columns"},
+	{name: "help", usage: "help", help: "Print this help"},
+	{name: "exit", usage: "exit", help: "Leave the shell; quit and Ctrl-D also work"},
+}
+
+// showFormats are the formats show accepts.
+var showFormats = []string{pkg.FormatText, pkg.FormatJSON, pkg.FormatYAML}
+
+// Help prints the commands of the shell.
+func (s *Session) Help() {
+	fmt.Fprintln(s.Out, "Ask a question to translate it into a query. If there is a current query anything that isn't a command")
+	fmt.Fprintln(s.Out, "is a follow up that changes it e.g. \"now only errors\" or \"group by region too\". Lines that start with a")
+	fmt.Fprintln(s.Out, "command but don't match its usage e.g. \"show me the slowest endpoints\" are questions too.")
+	fmt.Fprintln(s.Out)
+	for _, c := range commands {
+		fmt.Fprintf(s.Out, "  %-24s %s\n", c.usage, c.help)
+	}
+	fmt.Fprintf(s.Out, "\nThe fields of set are %s.\n", strings.Join(pkg.QueryFields(), ", "))
+}
+
+// Handle runs a line of input. It returns true if the session should end.
+func (s *Session) Handle(line string) (bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return false, nil
+	}
+	name, rest, _ := strings.Cut(line, " ")
+	name = strings.ToLower(name)
+	rest = strings.TrimSpace(rest)
+	if !isCommand(name, rest) {
+		if s.Query == nil {
+			return false, s.Ask(line)
+		}
+		return false, s.FollowUp(line)
+	}
+
+	switch name {
+	case "exit", "quit":
+		return true, nil
+	case "help", "?":
+		s.Help()
+		return false, nil
+	case "ask":
+		if rest == "" {
+			return false, errors.New("Usage: ask <question>")
+		}
+		return false, s.Ask(rest)
+	case "show":
+		return false, s.Show(strings.ToLower(rest))
+	case "set":
+		field, value, _ := strings.Cut(rest, " ")
+		if field == "" {
+			return false, errors.New("Usage: set <field> <value>")
+		}
+		return false, s.Set(field, value)
+	case "query":
+		return false, s.Replace(rest)
+	case "explain":
+		q, err := s.current()
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(s.Out, pkg.ExplainQuery(q))
+		return false, nil
+	case "undo":
+		return false, s.Undo()
+	case "run":
+		q, err := s.current()
+		if err != nil {
+			return false, err
+		}
+		return false, s.Actions.Run(s.Out, s.Dataset, q)
+	case "open":
+		q, err := s.current()
+		if err != nil {
+			return false, err
+		}
+		return false, s.Actions.Open(s.Out, s.Dataset, q)
+	case "screenshot":
+		if rest == "" {
+			return false, errors.New("Usage: screenshot <file>")
+		}
+		q, err := s.current()
+		if err != nil {
+			return false, err
+		}
+		return false, s.Actions.Screenshot(s.Out, s.Dataset, q, rest)
+	case "columns":
+		for _, c := range s.Columns {
+			if strings.Contains(strings.ToLower(c), strings.ToLower(rest)) {
+				fmt.Fprintln(s.Out, c)
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+// isCommand returns true if the line is the command name with arguments that fit its usage. Other lines are
+// questions even if they start with a command e.g. "show me the slowest endpoints" or "run time by region".
+func isCommand(name string, rest string) bool {
+	args := strings.Fields(rest)
+	switch name {
+	case "ask", "set":
+		return true
+	case "show":
+		if len(args) == 0 {
+			return true
+		}
+		if len(args) > 1 {
+			return false
+		}
+		for _, f := range showFormats {
+			if strings.EqualFold(args[0], f) {
+				return true
+			}
+		}
+		return false
+	case "query":
+		// Without a query the usage is printed.
+		if rest == "" {
+			return true
+		}
+		_, err := pkg.ParseAnyQuery(rest)
+		return err == nil
+	case "columns", "screenshot":
+		return len(args) <= 1
+	case "explain", "undo", "run", "open", "help", "?", "exit", "quit":
+		return len(args) == 0
+	}
+	return false
+}
+
+// Ask translates a new question and makes the result the current query.
+func (s *Session) Ask(question string) error {
+	q, err := s.translate(question)
+	if err != nil {
+		return err
+	}
+	s.Questions = []string{question}
+	s.previous = nil
+	s.Query = q
+	return s.Show("")
+}
+
+// FollowUp changes the current query as described by the follow up e.g. "same as before but for the last hour".
+// The follow up is applied with the Refiner; see pkg.NewRefiner.
+func (s *Session) FollowUp(followUp string) error {
+	current, err := s.current()
+	if err != nil {
+		return err
+	}
+	cols, err := s.PromptColumns(strings.Join(append(append([]string{}, s.Questions...), followUp), ". "))
+	if err != nil {
+		return err
+	}
+	refiner := s.Refiner
+	if refiner == nil {
+		refiner = pkg.NewRefiner(s.Translator)
+	}
+	entry, err := pkg.RunRefinement(refiner, pkg.RefineInput{
+		Questions:   s.Questions,
+		Query:       current,
+		Instruction: followUp,
+		COLS:        cols,
+	})
+	q, err := s.record(entry, cols, err)
+	if err != nil {
+		return err
+	}
+	s.Questions = append(s.Questions, followUp)
+	s.replace(q)
+	return s.Show("")
+}
+
+// Set changes a field of the current query; see pkg.SetQueryField.
+func (s *Session) Set(field string, value string) error {
+	current, err := s.current()
+	if err != nil {
+		return err
+	}
+	if err := pkg.SetQueryField(&current, field, value); err != nil {
+		return err
+	}
+	s.replace(&current)
+	return s.Show("")
+}
+
+// Replace replaces the current query with one in any of the formats accepted by pkg.ParseAnyQuery.
+func (s *Session) Replace(query string) error {
+	if query == "" {
+		return errors.New("Usage: query <query>")
+	}
+	q, err := pkg.ParseAnyQuery(query)
+	if err != nil {
+		return err
+	}
+	s.replace(q)
+	return s.Show("")
+}
+
+// Undo restores the previous version of the query.
+func (s *Session) Undo() error {
+	if len(s.previous) == 0 {
+		return errors.New("There is nothing to undo")
+	}
+	last := s.previous[len(s.previous)-1]
+	s.previous = s.previous[:len(s.previous)-1]
+	s.Query = &last
+	return s.Show("")
+}
+
+// Show prints the current query in the format; one of the formats supported by pkg.FormatQuery.
+func (s *Session) Show(format string) error {
+	q, err := s.current()
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = pkg.FormatText
+	}
+	b, err := pkg.FormatQuery(q, format)
+	if err != nil {
+		return err
+	}
+	_, err = s.Out.Write(b)
+	return err
+}
+
+// Complete returns the completions of the last word of the line and the part of the word that has been typed.
+// Commands are completed at the start of the line, query fields after set and columns everywhere else.
+func (s *Session) Complete(line string) ([]string, string) {
+	start := strings.LastIndexAny(line, " ,()") + 1
+	prefix := line[start:]
+
+	var candidates []string
+	words := strings.Fields(line[:start])
+	switch {
+	case len(words) == 0:
+		candidates = make([]string, 0, len(commands))
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+		}
+	case len(words) == 1 && strings.EqualFold(words[0], "set"):
+		candidates = pkg.QueryFields()
+	case len(words) == 1 && strings.EqualFold(words[0], "show"):
+		candidates = showFormats
+	default:
+		candidates = s.Columns
+	}
+
+	matches := make([]string, 0)
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches, prefix
+}
+
+// current returns a copy of the current query.
+func (s *Session) current() (pkg.HoneycombQuery, error) {
+	if s.Query == nil {
+		return pkg.HoneycombQuery{}, errors.New("There is no query yet; ask a question first")
+	}
+	return *s.Query, nil
+}
+
+// replace makes q the current query and remembers the previous one so it can be undone.
+func (s *Session) replace(q *pkg.HoneycombQuery) {
+	if s.Query != nil {
+		s.previous = append(s.previous, *s.Query)
+	}
+	s.Query = q
+}
+
+// translate translates the question and records it in the history.
+func (s *Session) translate(question string) (*pkg.HoneycombQuery, error) {
+	cols, err := s.PromptColumns(question)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := pkg.RunTranslation(s.Translator, pkg.QueryInput{NLQ: question, COLS: cols})
+	return s.record(entry, cols, err)
+}
+
+// record records the translation in the history and returns the query it produced.
+// err is the error returned by the translation.
+func (s *Session) record(entry *pkg.HistoryEntry, cols string, err error) (*pkg.HoneycombQuery, error) {
+	log := zapr.NewLogger(zap.L())
+	entry.Dataset = s.Dataset
+	entry.Translator = s.TranslatorName
+	if s.History != nil {
+		if err := s.History.Append(entry, cols); err != nil {
+			log.Error(err, "Failed to record translation in history")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if entry.Query == nil {
+		return nil, errors.Errorf("The translator's output couldn't be parsed as a query; %v\n%v", entry.ParseError, entry.Output)
+	}
+	return entry.Query, nil
+}
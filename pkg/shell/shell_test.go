@@ -0,0 +1,200 @@
+package shell
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/jlewi/hccli/pkg"
+)
+
+// fakeTranslator returns the outputs in order and records the questions it was asked.
+type fakeTranslator struct {
+	outputs   []string
+	questions []string
+}
+
+func (f *fakeTranslator) Translate(in pkg.QueryInput) (string, error) {
+	f.questions = append(f.questions, in.NLQ)
+	out := f.outputs[0]
+	f.outputs = f.outputs[1:]
+	return out, nil
+}
+
+// fakeActions records the queries that were run.
+type fakeActions struct {
+	run []pkg.HoneycombQuery
+}
+
+func (f *fakeActions) Run(w io.Writer, dataset string, q pkg.HoneycombQuery) error {
+	f.run = append(f.run, q)
+	return nil
+}
+
+func (f *fakeActions) Open(w io.Writer, dataset string, q pkg.HoneycombQuery) error {
+	return nil
+}
+
+func (f *fakeActions) Screenshot(w io.Writer, dataset string, q pkg.HoneycombQuery, file string) error {
+	return nil
+}
+
+func newTestSession(outputs ...string) (*Session, *fakeTranslator, *fakeActions, *bytes.Buffer) {
+	translator := &fakeTranslator{outputs: outputs}
+	actions := &fakeActions{}
+	out := &bytes.Buffer{}
+	s := &Session{
+		Dataset:    "api",
+		Translator: translator,
+		Columns:    []string{"duration_ms", "error", "http.route", "http.status_code", "service.name"},
+		PromptColumns: func(nlq string) (string, error) {
+			return `[{"key_name":"error"}]`, nil
+		},
+		Actions: actions,
+		Out:     out,
+	}
+	return s, translator, actions, out
+}
+
+func Test_Session(t *testing.T) {
+	s, translator, actions, out := newTestSession(
+		"{'calculations': [{'op': 'COUNT'}], 'breakdowns': ['http.route'], 'time_range': 7200}",
+		"{'calculations': [{'op': 'COUNT'}], 'breakdowns': ['http.route'], 'filters': [{'column': 'error', 'op': 'exists'}], 'time_range': 7200}",
+	)
+
+	lines := []string{
+		"count requests by route",
+		"now only errors",
+		"same as before but for the last hour",
+		"set limit 50",
+		"undo",
+		"explain",
+		"run",
+	}
+	for _, l := range lines {
+		if exit, err := s.Handle(l); err != nil || exit {
+			t.Fatalf("Handle(%q) returned exit=%v err=%v", l, exit, err)
+		}
+	}
+
+	expectedOut := strings.Join([]string{
+		"COUNT GROUP BY http.route LAST 2h",
+		"COUNT WHERE error exists GROUP BY http.route LAST 2h",
+		"COUNT WHERE error exists GROUP BY http.route LAST 1h",
+		"COUNT WHERE error exists GROUP BY http.route LAST 1h LIMIT 50",
+		"COUNT WHERE error exists GROUP BY http.route LAST 1h",
+		"The count of events where error exists, grouped by http.route, over the last hour",
+	}, "\n") + "\n"
+	if d := cmp.Diff(expectedOut, out.String()); d != "" {
+		t.Errorf("Unexpected output;diff:\n%v", d)
+	}
+
+	// The time range is changed by the rules without the translator.
+	if len(translator.questions) != 2 {
+		t.Fatalf("Expected 2 translations; got %v", len(translator.questions))
+	}
+	followUp := translator.questions[1]
+	if !strings.HasPrefix(followUp, "count requests by route. now only errors\n") || !strings.Contains(followUp, `"breakdowns":["http.route"]`) {
+		t.Errorf("Follow up didn't include the question and the previous query; got %v", followUp)
+	}
+	if d := cmp.Diff([]string{"count requests by route", "now only errors", "same as before but for the last hour"}, s.Questions); d != "" {
+		t.Errorf("Unexpected questions;diff:\n%v", d)
+	}
+	if len(actions.run) != 1 || actions.run[0].Limit != 0 {
+		t.Errorf("Expected the undone query to be run; got %+v", actions.run)
+	}
+}
+
+func Test_SessionCommandsAndQuestions(t *testing.T) {
+	s, translator, _, out := newTestSession(
+		"{'calculations': [{'op': 'P99', 'column': 'duration_ms'}], 'breakdowns': ['http.route']}",
+		"{'calculations': [{'op': 'P99', 'column': 'duration_ms'}], 'breakdowns': ['http.route'], 'filters': [{'column': 'error', 'op': 'exists'}]}",
+		"{'calculations': [{'op': 'COUNT'}], 'breakdowns': ['service.name']}",
+	)
+
+	// Lines that start with a command but don't match its usage are questions.
+	for _, l := range []string{"show me the slowest endpoints", "run it again with only errors", "query how many services there are"} {
+		if _, err := s.Handle(l); err != nil {
+			t.Fatalf("Handle(%q) failed; %v", l, err)
+		}
+	}
+	if d := cmp.Diff([]string{"show me the slowest endpoints", "run it again with only errors", "query how many services there are"}, s.Questions); d != "" {
+		t.Errorf("Unexpected questions;diff:\n%v", d)
+	}
+	if len(translator.questions) != 3 {
+		t.Errorf("Expected 3 translations; got %v", translator.questions)
+	}
+
+	// Commands whose arguments match their usage are still run.
+	out.Reset()
+	for _, l := range []string{"show JSON", "columns http", "query COUNT LAST 1h"} {
+		if _, err := s.Handle(l); err != nil {
+			t.Fatalf("Handle(%q) failed; %v", l, err)
+		}
+	}
+	expectedOut := strings.Join([]string{
+		"{",
+		`  "breakdowns": [`,
+		`    "service.name"`,
+		"  ],",
+		`  "calculations": [`,
+		"    {",
+		`      "op": "COUNT"`,
+		"    }",
+		"  ]",
+		"}",
+		"http.route",
+		"http.status_code",
+		"COUNT LAST 1h",
+	}, "\n") + "\n"
+	if d := cmp.Diff(expectedOut, out.String()); d != "" {
+		t.Errorf("Unexpected output;diff:\n%v", d)
+	}
+	if len(translator.questions) != 3 {
+		t.Errorf("Commands shouldn't be translated; got %v", translator.questions)
+	}
+}
+
+func Test_SessionNoQuery(t *testing.T) {
+	s, _, _, _ := newTestSession()
+	for _, l := range []string{"run", "set limit 5", "show", "undo", "explain"} {
+		if _, err := s.Handle(l); err == nil {
+			t.Errorf("Handle(%q) should fail without a query", l)
+		}
+	}
+	if exit, _ := s.Handle("quit"); !exit {
+		t.Errorf("quit should end the session")
+	}
+}
+
+func Test_Complete(t *testing.T) {
+	type testCase struct {
+		line     string
+		expected []string
+		prefix   string
+	}
+
+	cases := []testCase{
+		{line: "sc", expected: []string{"screenshot"}, prefix: "sc"},
+		{line: "set li", expected: []string{"limit"}, prefix: "li"},
+		{line: "set breakdowns http.", expected: []string{"http.route", "http.status_code"}, prefix: "http."},
+		{line: "set calculations COUNT, P99(dur", expected: []string{"duration_ms"}, prefix: "dur"},
+		{line: "group by serv", expected: []string{"service.name"}, prefix: "serv"},
+		{line: "show j", expected: []string{"json"}, prefix: "j"},
+	}
+
+	s, _, _, _ := newTestSession()
+	for _, c := range cases {
+		t.Run(c.line, func(t *testing.T) {
+			actual, prefix := s.Complete(c.line)
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected completions;diff:\n%v", d)
+			}
+			if prefix != c.prefix {
+				t.Errorf("Unexpected prefix; got %q want %q", prefix, c.prefix)
+			}
+		})
+	}
+}
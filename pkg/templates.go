@@ -0,0 +1,398 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// templateExtensions are the file extensions of query templates.
+// Templates can be written in any format accepted by ParseAnyQuery; .txt is used for the text syntax.
+var templateExtensions = []string{".yaml", ".yml", ".json", ".txt"}
+
+// QueryTemplate is a query containing placeholders e.g. {{ .service }} that are filled in when it is rendered.
+type QueryTemplate struct {
+	// Name is the name of the file without the extension.
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Parameters are the names of the values the template references e.g. service for {{ .service }}.
+	Parameters []string `json:"parameters"`
+	// Optional are the parameters used as conditions e.g. service for {{ if .service }}. Missing values are empty
+	// so the condition is false.
+	Optional []string `json:"optional,omitempty"`
+	// Text is the unrendered template.
+	Text string `json:"-"`
+
+	tmpl *template.Template
+}
+
+// TemplateStore is a directory of query templates.
+type TemplateStore struct {
+	Dir string
+}
+
+// List returns the templates in the directory sorted by name.
+// A missing directory is treated as empty.
+func (s *TemplateStore) List() ([]QueryTemplate, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return []QueryTemplate{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read templates directory %v", s.Dir)
+	}
+
+	templates := make([]QueryTemplate, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !isTemplateFile(e.Name()) {
+			continue
+		}
+		t, err := ReadTemplate(filepath.Join(s.Dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// Get returns the template with the given name.
+// The name can include the extension; if it doesn't each of the template extensions is tried.
+func (s *TemplateStore) Get(name string) (*QueryTemplate, error) {
+	if strings.ContainsRune(name, filepath.Separator) {
+		return nil, errors.Errorf("Template name %v should not contain a path separator", name)
+	}
+	candidates := []string{name}
+	if !isTemplateFile(name) {
+		candidates = make([]string, 0, len(templateExtensions))
+		for _, ext := range templateExtensions {
+			candidates = append(candidates, name+ext)
+		}
+	}
+	for _, c := range candidates {
+		path := filepath.Join(s.Dir, c)
+		if _, err := os.Stat(path); err == nil {
+			return ReadTemplate(path)
+		}
+	}
+	return nil, errors.Errorf("Template %v not found in %v", name, s.Dir)
+}
+
+// ReadTemplate reads and parses the template in the file.
+func ReadTemplate(path string) (*QueryTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read template %v", path)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	t, err := NewQueryTemplate(name, string(data))
+	if err != nil {
+		return nil, err
+	}
+	t.Path = path
+	return t, nil
+}
+
+// placeholderFunc is appended to the pipeline of every action that prints a value so Render can escape the values
+// for where they appear in the template.
+const placeholderFunc = "hccliPlaceholder"
+
+// NewQueryTemplate parses the text of a template.
+func NewQueryTemplate(name string, text string) (*QueryTemplate, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(template.FuncMap{placeholderFunc: fmt.Sprint}).Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse template %v", name)
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			markPlaceholders(t.Tree.Root)
+		}
+	}
+	params := make(map[string]bool)
+	optional := make(map[string]bool)
+	if tmpl.Tree != nil {
+		collectParameters(tmpl.Tree.Root, params, optional)
+	}
+	t := &QueryTemplate{
+		Name:       name,
+		Text:       text,
+		Parameters: make([]string, 0, len(params)),
+		tmpl:       tmpl,
+	}
+	for p := range params {
+		t.Parameters = append(t.Parameters, p)
+	}
+	sort.Strings(t.Parameters)
+	for p := range optional {
+		t.Optional = append(t.Optional, p)
+	}
+	sort.Strings(t.Optional)
+	return t, nil
+}
+
+// Render fills in the placeholders of the template.
+// It is an error if the template references a value that isn't provided unless the value is only optional;
+// missing optional values are empty.
+// Values are escaped for where they appear: inside double quotes quotes and backslashes are escaped and outside
+// quotes values that aren't bare words are double quoted e.g. "a: b". Values inside single quotes or backticks
+// can't contain that quote or a backslash.
+func (t *QueryTemplate) Render(values map[string]string) (string, error) {
+	missing := make([]string, 0)
+	for _, p := range t.Parameters {
+		if _, ok := values[p]; !ok && !t.isOptional(p) {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		return "", errors.Errorf("Template %v requires values for %v; set them with --set name=value", t.Name, strings.Join(missing, ", "))
+	}
+	data := make(map[string]string, len(values)+len(t.Optional))
+	for _, p := range t.Optional {
+		data[p] = ""
+	}
+	for k, v := range values {
+		data[k] = v
+	}
+
+	// The printed values are replaced by markers which are escaped once the quotes around them are known.
+	tmpl, err := t.tmpl.Clone()
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to render template %v", t.Name)
+	}
+	printed := make([]string, 0)
+	tmpl.Funcs(template.FuncMap{placeholderFunc: func(v interface{}) string {
+		printed = append(printed, fmt.Sprint(v))
+		return fmt.Sprintf("%c%d%c", placeholderStart, len(printed)-1, placeholderEnd)
+	}})
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", errors.Wrapf(err, "Failed to render template %v", t.Name)
+	}
+	s, err := substitutePlaceholders(b.String(), printed)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to render template %v", t.Name)
+	}
+	return s, nil
+}
+
+func (t *QueryTemplate) isOptional(p string) bool {
+	for _, o := range t.Optional {
+		if o == p {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	placeholderStart = '\x00'
+	placeholderEnd   = '\x01'
+)
+
+// substitutePlaceholders replaces the markers written by Render with the printed values escaped for the quotes
+// they are in.
+func substitutePlaceholders(s string, printed []string) (string, error) {
+	var out strings.Builder
+	var quote rune
+	comment := false
+	prev := '\n'
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == placeholderStart {
+			end := i + 1
+			for end < len(runes) && runes[end] != placeholderEnd {
+				end++
+			}
+			index, err := strconv.Atoi(string(runes[i+1 : end]))
+			if err != nil || index >= len(printed) {
+				return "", errors.Errorf("Invalid placeholder at offset %d", i)
+			}
+			v, err := escapeTemplateValue(printed[index], quote, comment)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(v)
+			i = end
+			prev = 'x'
+			continue
+		}
+
+		out.WriteRune(r)
+		switch {
+		case comment:
+			comment = r != '\n'
+		case quote == '"' && r == '\\' && i+1 < len(runes) && runes[i+1] != placeholderStart:
+			i++
+			out.WriteRune(runes[i])
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '#' && unicode.IsSpace(prev):
+			// YAML comments can contain unbalanced quotes e.g. don't.
+			comment = true
+		}
+		prev = r
+	}
+	return out.String(), nil
+}
+
+// escapeTemplateValue escapes a value for the quote it is in; quote is 0 outside of quotes.
+func escapeTemplateValue(v string, quote rune, comment bool) (string, error) {
+	switch {
+	case comment:
+		return v, nil
+	case quote == '"':
+		return strings.TrimSuffix(strings.TrimPrefix(quoteTemplateValue(v), `"`), `"`), nil
+	case quote != 0:
+		if strings.ContainsRune(v, quote) || strings.ContainsRune(v, '\\') {
+			return "", errors.Errorf("Value %q can't be used inside %c quotes; use double quotes in the template", v, quote)
+		}
+		return v, nil
+	case v == "" || bareWord.MatchString(v):
+		return v, nil
+	}
+	return quoteTemplateValue(v), nil
+}
+
+// quoteTemplateValue double quotes a value using the escapes JSON, YAML and the text syntax have in common.
+func quoteTemplateValue(v string) string {
+	return `"` + templateValueEscaper.Replace(v) + `"`
+}
+
+var templateValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+// RenderQuery renders the template, parses the result and validates the query.
+func (t *QueryTemplate) RenderQuery(values map[string]string) (*HoneycombQuery, error) {
+	s, err := t.Render(values)
+	if err != nil {
+		return nil, err
+	}
+	q, err := ParseAnyQuery(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Rendered template %v isn't a valid query", t.Name)
+	}
+	if err := ValidateQuery(*q); err != nil {
+		return nil, errors.Wrapf(err, "Rendered template %v isn't a valid query", t.Name)
+	}
+	return q, nil
+}
+
+// ParseTemplateValues parses a list of name=value pairs as passed to --set.
+func ParseTemplateValues(pairs []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, p := range pairs {
+		pieces := strings.SplitN(p, "=", 2)
+		if len(pieces) != 2 || strings.TrimSpace(pieces[0]) == "" {
+			return nil, errors.Errorf("Value %q should be of the form name=value", p)
+		}
+		values[strings.TrimSpace(pieces[0])] = pieces[1]
+	}
+	return values, nil
+}
+
+func isTemplateFile(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range templateExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// collectParameters adds the names of the top level fields e.g. service for {{ .service }} referenced by the node.
+// Fields used in the conditions of if, with and range are also added to optional.
+func collectParameters(node parse.Node, params map[string]bool, optional map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectParameters(c, params, optional)
+		}
+	case *parse.ActionNode:
+		collectParameters(n.Pipe, params, optional)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			collectParameters(c, params, optional)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			collectParameters(a, params, optional)
+		}
+	case *parse.FieldNode:
+		params[n.Ident[0]] = true
+	case *parse.IfNode:
+		collectConditionParameters(n.Pipe, params, optional)
+		collectParameters(n.List, params, optional)
+		collectParameters(n.ElseList, params, optional)
+	case *parse.RangeNode:
+		// Dot changes inside the body of range and with so fields there aren't parameters.
+		collectConditionParameters(n.Pipe, params, optional)
+		collectParameters(n.ElseList, params, optional)
+	case *parse.WithNode:
+		collectConditionParameters(n.Pipe, params, optional)
+		collectParameters(n.ElseList, params, optional)
+	}
+}
+
+// collectConditionParameters adds the fields referenced by a condition to both params and optional.
+func collectConditionParameters(pipe *parse.PipeNode, params map[string]bool, optional map[string]bool) {
+	fields := make(map[string]bool)
+	collectParameters(pipe, fields, optional)
+	for f := range fields {
+		params[f] = true
+		optional[f] = true
+	}
+}
+
+// markPlaceholders appends placeholderFunc to the pipelines of the actions that print values.
+func markPlaceholders(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			markPlaceholders(c)
+		}
+	case *parse.ActionNode:
+		// Actions that declare or assign variables don't print anything.
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(placeholderFunc).SetPos(n.Pos)},
+			})
+		}
+	case *parse.IfNode:
+		markPlaceholders(n.List)
+		markPlaceholders(n.ElseList)
+	case *parse.RangeNode:
+		markPlaceholders(n.List)
+		markPlaceholders(n.ElseList)
+	case *parse.WithNode:
+		markPlaceholders(n.List)
+		markPlaceholders(n.ElseList)
+	}
+}
@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_QueryTemplate(t *testing.T) {
+	type testCase struct {
+		name       string
+		text       string
+		values     map[string]string
+		parameters []string
+		optional   []string
+		expected   *HoneycombQuery
+		wantErr    bool
+	}
+
+	cases := []testCase{
+		{
+			name:       "text",
+			text:       `COUNT WHERE service.name = "{{ .service }}" GROUP BY name LAST {{ .window }}`,
+			values:     map[string]string{"service": "checkout", "window": "1d"},
+			parameters: []string{"service", "window"},
+			expected: &HoneycombQuery{
+				Breakdowns:   []string{"name"},
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Op: "=", Column: "service.name", Value: "checkout"}},
+				TimeRange:    86400,
+			},
+		},
+		{
+			name: "yaml",
+			text: `calculations:
+  - op: {{ .op }}
+    column: duration_ms
+{{- if .service }}
+filters:
+  - column: service.name
+    op: "="
+    value: {{ .service }}
+{{- end }}
+`,
+			values:     map[string]string{"op": "P99", "service": "api"},
+			parameters: []string{"op", "service"},
+			optional:   []string{"service"},
+			expected: &HoneycombQuery{
+				Calculations: []Calculation{{Op: "P99", Column: "duration_ms"}},
+				Filters:      []Filter{{Op: "=", Column: "service.name", Value: "api"}},
+			},
+		},
+		{
+			// Parameters used in conditions are optional; missing values are empty so the condition is false.
+			name:       "optional-missing",
+			text:       "COUNT{{ if .service }} WHERE service.name = {{ .service }}{{ end }}{{ with .window }} LAST {{ . }}{{ end }}",
+			values:     map[string]string{},
+			parameters: []string{"service", "window"},
+			optional:   []string{"service", "window"},
+			expected: &HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+			},
+		},
+		{
+			name:       "quoted-value",
+			text:       `{"calculations": [{"op": "COUNT"}], "filters": [{"column": "msg", "op": "=", "value": "{{ .msg }}"}]}`,
+			values:     map[string]string{"msg": `say "hi" \ bye`},
+			parameters: []string{"msg"},
+			expected: &HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Op: "=", Column: "msg", Value: `say "hi" \ bye`}},
+			},
+		},
+		{
+			name:       "text-quoted-value",
+			text:       `COUNT WHERE msg = "{{ .msg }}" LAST {{ .window }}`,
+			values:     map[string]string{"msg": `a: "b"`, "window": "1h"},
+			parameters: []string{"msg", "window"},
+			expected: &HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Op: "=", Column: "msg", Value: `a: "b"`}},
+				TimeRange:    3600,
+			},
+		},
+		{
+			// Unquoted values that aren't bare words are quoted so "a: b" doesn't become a mapping.
+			name:       "yaml-unquoted-value",
+			text:       "# don't forget the op\ncalculations:\n  - op: COUNT\nfilters:\n  - column: msg\n    op: \"=\"\n    value: {{ .msg }}\n",
+			values:     map[string]string{"msg": "a: b"},
+			parameters: []string{"msg"},
+			expected: &HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Op: "=", Column: "msg", Value: "a: b"}},
+			},
+		},
+		{
+			name:       "single-quoted-value",
+			text:       `COUNT WHERE msg = '{{ .msg }}'`,
+			values:     map[string]string{"msg": "it's"},
+			parameters: []string{"msg"},
+			wantErr:    true,
+		},
+		{
+			name:       "missing-value",
+			text:       `COUNT WHERE service.name = "{{ .service }}"`,
+			values:     map[string]string{},
+			parameters: []string{"service"},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid-query",
+			text:       `{"calculations": [{"op": "{{ .op }}"}]}`,
+			values:     map[string]string{"op": "MEDIAN"},
+			parameters: []string{"op"},
+			wantErr:    true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tmpl, err := NewQueryTemplate(c.name, c.text)
+			if err != nil {
+				t.Fatalf("Failed to parse template; %v", err)
+			}
+			if d := cmp.Diff(c.parameters, tmpl.Parameters); d != "" {
+				t.Errorf("Unexpected parameters;diff:\n%v", d)
+			}
+			if d := cmp.Diff(c.optional, tmpl.Optional); d != "" {
+				t.Errorf("Unexpected optional parameters;diff:\n%v", d)
+			}
+
+			actual, err := tmpl.RenderQuery(c.values)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error but got query %+v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to render template; %v", err)
+			}
+			if d := cmp.Diff(c.expected, actual); d != "" {
+				t.Errorf("Unexpected query;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_TemplateStore(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"errors.txt":   `COUNT WHERE error exists LAST {{ .window }}`,
+		"latency.yaml": "calculations:\n  - op: P99\n    column: duration_ms\n",
+		"notes.md":     "not a template",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write %v; %v", name, err)
+		}
+	}
+
+	store := &TemplateStore{Dir: dir}
+	templates, err := store.List()
+	if err != nil {
+		t.Fatalf("Failed to list templates; %v", err)
+	}
+	names := make([]string, 0, len(templates))
+	for _, tmpl := range templates {
+		names = append(names, tmpl.Name)
+	}
+	if d := cmp.Diff([]string{"errors", "latency"}, names); d != "" {
+		t.Errorf("Unexpected templates;diff:\n%v", d)
+	}
+
+	tmpl, err := store.Get("errors")
+	if err != nil {
+		t.Fatalf("Failed to get template; %v", err)
+	}
+	if tmpl.Path != filepath.Join(dir, "errors.txt") {
+		t.Errorf("Unexpected path %v", tmpl.Path)
+	}
+
+	if _, err := store.Get("missing"); err == nil {
+		t.Errorf("Expected an error for a missing template")
+	}
+
+	empty := &TemplateStore{Dir: filepath.Join(dir, "doesnotexist")}
+	templates, err = empty.List()
+	if err != nil || len(templates) != 0 {
+		t.Errorf("Expected no templates for a missing directory; got %v, %v", templates, err)
+	}
+}
+
+func Test_ParseTemplateValues(t *testing.T) {
+	values, err := ParseTemplateValues([]string{"service=checkout", "filter=a=b"})
+	if err != nil {
+		t.Fatalf("Failed to parse values; %v", err)
+	}
+	if d := cmp.Diff(map[string]string{"service": "checkout", "filter": "a=b"}, values); d != "" {
+		t.Errorf("Unexpected values;diff:\n%v", d)
+	}
+	if _, err := ParseTemplateValues([]string{"service"}); err == nil {
+		t.Errorf("Expected an error for a value without =")
+	}
+}
@@ -0,0 +1,663 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The text syntax is a compact way of writing queries e.g.
+//
+//	COUNT, P99(duration_ms) WHERE service.name = api AND error exists GROUP BY http.route ORDER BY COUNT desc LAST 7d LIMIT 100
+//
+// The clauses are
+//
+//	<calc>, ...                          calculations e.g. COUNT or P99(duration_ms); must come first
+//	WHERE <col> <op> [value] AND|OR ...  filters; values for in and not-in are written as (a, b)
+//	GROUP BY <col>, ...                  breakdowns
+//	HAVING <calc> <op> <number>, ...     havings
+//	ORDER BY <calc or col> [asc|desc], ...
+//	LAST <duration>                      relative time range e.g. 2h or 7d
+//	FROM <time> TO <time> | FROM <time> FOR <duration>
+//	GRANULARITY <duration>
+//	LIMIT <n>
+//
+// Keywords are case insensitive. Values and columns containing spaces or special characters can be quoted with
+// double quotes; columns can also be quoted with backticks.
+
+// calculationOps is the set of Honeycomb calculation operators.
+var calculationOps = map[string]bool{
+	"COUNT":          true,
+	"CONCURRENCY":    true,
+	"SUM":            true,
+	"AVG":            true,
+	"MAX":            true,
+	"MIN":            true,
+	"COUNT_DISTINCT": true,
+	"HEATMAP":        true,
+	"RATE_AVG":       true,
+	"RATE_SUM":       true,
+	"RATE_MAX":       true,
+}
+
+func init() {
+	for p := range percentiles {
+		calculationOps[p] = true
+	}
+}
+
+// textKeywords are the words that start or separate clauses.
+var textKeywords = map[string]bool{
+	"WHERE": true, "GROUP": true, "BY": true, "HAVING": true, "ORDER": true, "LAST": true, "FROM": true,
+	"TO": true, "FOR": true, "GRANULARITY": true, "LIMIT": true, "AND": true, "OR": true, "ASC": true, "DESC": true,
+}
+
+// filterOpsWithoutValue are the filter operators that don't take a value.
+var filterOpsWithoutValue = map[string]bool{
+	"exists":         true,
+	"does-not-exist": true,
+}
+
+var bareWord = regexp.MustCompile(`^[A-Za-z0-9_./:@-]+$`)
+
+type textTokenKind int
+
+const (
+	tokenWord textTokenKind = iota
+	tokenQuoted
+	tokenBacktick
+	tokenPunct
+)
+
+type textToken struct {
+	kind  textTokenKind
+	value string
+}
+
+// ParseTextQuery parses a query written in the text syntax.
+func ParseTextQuery(s string) (*HoneycombQuery, error) {
+	tokens, err := tokenizeTextQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &textParser{tokens: tokens}
+	return p.parse()
+}
+
+func tokenizeTextQuery(s string) ([]textToken, error) {
+	tokens := make([]textToken, 0)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+		case r == ',' || r == '(' || r == ')':
+			tokens = append(tokens, textToken{kind: tokenPunct, value: string(r)})
+		case r == '"' || r == '\'':
+			value, end, err := readPythonString(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, textToken{kind: tokenQuoted, value: value})
+			i = end
+		case r == '`':
+			end := strings.IndexRune(string(runes[i+1:]), '`')
+			if end < 0 {
+				return nil, errors.Errorf("Unterminated backtick starting at offset %d", i)
+			}
+			value := string(runes[i+1:])[:end]
+			tokens = append(tokens, textToken{kind: tokenBacktick, value: value})
+			i += len([]rune(value)) + 1
+		default:
+			j := i
+			for j < len(runes) && !strings.ContainsRune(" \t\n\r,()\"'`", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, textToken{kind: tokenWord, value: string(runes[i:j])})
+			i = j - 1
+		}
+	}
+	return tokens, nil
+}
+
+type textParser struct {
+	tokens []textToken
+	pos    int
+}
+
+func (p *textParser) peek() *textToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *textParser) next() (textToken, error) {
+	if p.pos >= len(p.tokens) {
+		return textToken{}, errors.New("Unexpected end of query")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+// isKeyword returns true if the next token is the given keyword.
+func (p *textParser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokenWord && strings.ToUpper(t.value) == keyword
+}
+
+func (p *textParser) isPunct(v string) bool {
+	t := p.peek()
+	return t != nil && t.kind == tokenPunct && t.value == v
+}
+
+func (p *textParser) expectKeyword(keyword string) error {
+	if !p.isKeyword(keyword) {
+		return errors.Errorf("Expected %v at token %d", keyword, p.pos+1)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *textParser) expectPunct(v string) error {
+	if !p.isPunct(v) {
+		return errors.Errorf("Expected %q at token %d", v, p.pos+1)
+	}
+	p.pos++
+	return nil
+}
+
+// atClauseStart returns true if there are no more tokens or the next token starts a new clause.
+func (p *textParser) atClauseStart() bool {
+	t := p.peek()
+	if t == nil {
+		return true
+	}
+	return t.kind == tokenWord && isTextClause(strings.ToUpper(t.value))
+}
+
+// column reads a column name; it can be a bare word or quoted.
+func (p *textParser) column() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.kind == tokenPunct {
+		return "", errors.Errorf("Expected a column but got %q", t.value)
+	}
+	return t.value, nil
+}
+
+func (p *textParser) parse() (*HoneycombQuery, error) {
+	q := &HoneycombQuery{}
+
+	for !p.atClauseStart() {
+		c, err := p.calculation()
+		if err != nil {
+			return nil, err
+		}
+		q.Calculations = append(q.Calculations, c)
+		if !p.isPunct(",") {
+			break
+		}
+		p.pos++
+	}
+
+	seen := make(map[string]bool)
+	for p.peek() != nil {
+		t, _ := p.next()
+		clause := strings.ToUpper(t.value)
+		if t.kind != tokenWord || !isTextClause(clause) {
+			return nil, errors.Errorf("Unexpected %q at token %d", t.value, p.pos)
+		}
+		if seen[clause] {
+			return nil, errors.Errorf("%v can only be specified once", clause)
+		}
+		seen[clause] = true
+
+		var err error
+		switch clause {
+		case "WHERE":
+			err = p.where(q)
+		case "GROUP":
+			if err = p.expectKeyword("BY"); err == nil {
+				err = p.groupBy(q)
+			}
+		case "HAVING":
+			err = p.having(q)
+		case "ORDER":
+			if err = p.expectKeyword("BY"); err == nil {
+				err = p.orderBy(q)
+			}
+		case "LAST", "FOR":
+			if seen["LAST"] && seen["FOR"] {
+				return nil, errors.New("Only one of LAST and FOR can be specified")
+			}
+			q.TimeRange, err = p.durationSeconds()
+		case "FROM":
+			q.StartTime, err = p.timestamp()
+		case "TO":
+			q.EndTime, err = p.timestamp()
+		case "GRANULARITY":
+			q.Granularity, err = p.durationSeconds()
+		case "LIMIT":
+			q.Limit, err = p.integer()
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse %v", clause)
+		}
+	}
+	return q, nil
+}
+
+// isTextClause returns true if the keyword starts a clause.
+func isTextClause(clause string) bool {
+	switch clause {
+	case "WHERE", "GROUP", "HAVING", "ORDER", "LAST", "FROM", "TO", "FOR", "GRANULARITY", "LIMIT":
+		return true
+	}
+	return false
+}
+
+// calculation reads a calculation like COUNT or P99(duration_ms).
+func (p *textParser) calculation() (Calculation, error) {
+	t, err := p.next()
+	if err != nil {
+		return Calculation{}, err
+	}
+	op := strings.ToUpper(t.value)
+	if t.kind != tokenWord || !calculationOps[op] {
+		return Calculation{}, errors.Errorf("%q isn't a calculation", t.value)
+	}
+	c := Calculation{Op: op}
+	if p.isPunct("(") {
+		p.pos++
+		col, err := p.column()
+		if err != nil {
+			return Calculation{}, err
+		}
+		c.Column = col
+		if err := p.expectPunct(")"); err != nil {
+			return Calculation{}, err
+		}
+	}
+	return c, nil
+}
+
+func (p *textParser) where(q *HoneycombQuery) error {
+	for {
+		f, err := p.filter()
+		if err != nil {
+			return err
+		}
+		q.Filters = append(q.Filters, f)
+
+		combination := ""
+		switch {
+		case p.isKeyword("AND"):
+			combination = "AND"
+		case p.isKeyword("OR"):
+			combination = "OR"
+		default:
+			return nil
+		}
+		p.pos++
+		if q.FilterCombination != "" && q.FilterCombination != combination {
+			return errors.New("Filters can't mix AND and OR")
+		}
+		q.FilterCombination = combination
+	}
+}
+
+func (p *textParser) filter() (Filter, error) {
+	col, err := p.column()
+	if err != nil {
+		return Filter{}, err
+	}
+	opToken, err := p.next()
+	if err != nil {
+		return Filter{}, err
+	}
+	op := strings.ToLower(opToken.value)
+	if opToken.kind != tokenWord || !isFilterOp(op) {
+		return Filter{}, errors.Errorf("%q isn't a filter operator", opToken.value)
+	}
+	f := Filter{Column: col, Op: op}
+	if filterOpsWithoutValue[op] {
+		return f, nil
+	}
+
+	if op == "in" || op == "not-in" {
+		if err := p.expectPunct("("); err != nil {
+			return Filter{}, err
+		}
+		values := make([]string, 0)
+		for {
+			v, err := p.value()
+			if err != nil {
+				return Filter{}, err
+			}
+			values = append(values, v)
+			if !p.isPunct(",") {
+				break
+			}
+			p.pos++
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return Filter{}, err
+		}
+		f.Values = values
+		return f, nil
+	}
+
+	f.Value, err = p.value()
+	return f, err
+}
+
+func (p *textParser) value() (string, error) {
+	t, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if t.kind == tokenPunct {
+		return "", errors.Errorf("Expected a value but got %q", t.value)
+	}
+	return t.value, nil
+}
+
+func (p *textParser) groupBy(q *HoneycombQuery) error {
+	for {
+		col, err := p.column()
+		if err != nil {
+			return err
+		}
+		q.Breakdowns = append(q.Breakdowns, col)
+		if !p.isPunct(",") {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *textParser) having(q *HoneycombQuery) error {
+	for {
+		c, err := p.calculation()
+		if err != nil {
+			return err
+		}
+		opToken, err := p.next()
+		if err != nil {
+			return err
+		}
+		if opToken.kind != tokenWord || !isHavingOp(opToken.value) {
+			return errors.Errorf("%q isn't a having operator; it should be one of =, !=, >, >=, < or <=", opToken.value)
+		}
+		value, err := p.number()
+		if err != nil {
+			return err
+		}
+		q.Havings = append(q.Havings, Having{CalculateOp: c.Op, Column: c.Column, Op: opToken.value, Value: value})
+		if !p.isPunct(",") {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *textParser) orderBy(q *HoneycombQuery) error {
+	for {
+		o := Order{}
+		t := p.peek()
+		if t == nil {
+			return errors.New("Unexpected end of query")
+		}
+		if t.kind == tokenWord && calculationOps[strings.ToUpper(t.value)] {
+			c, err := p.calculation()
+			if err != nil {
+				return err
+			}
+			o.Op = c.Op
+			o.Column = columnName(c.Column)
+		} else {
+			col, err := p.column()
+			if err != nil {
+				return err
+			}
+			o.Column = col
+		}
+
+		switch {
+		case p.isKeyword("ASC"):
+			o.Order = "ascending"
+			p.pos++
+		case p.isKeyword("DESC"):
+			o.Order = "descending"
+			p.pos++
+		}
+		q.Orders = append(q.Orders, o)
+		if !p.isPunct(",") {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *textParser) integer() (int, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(t.value)
+	if err != nil {
+		return 0, errors.Errorf("%q isn't an integer", t.value)
+	}
+	return v, nil
+}
+
+func (p *textParser) number() (float64, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(t.value, 64)
+	if err != nil {
+		return 0, errors.Errorf("%q isn't a number", t.value)
+	}
+	return v, nil
+}
+
+func (p *textParser) durationSeconds() (int, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	d, err := parseRelativeDuration(t.value)
+	if err != nil {
+		return 0, err
+	}
+	return int(d.Seconds()), nil
+}
+
+// timestamp reads a time that is either an RFC3339 timestamp or seconds since the epoch.
+func (p *textParser) timestamp() (int, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	if v, err := strconv.Atoi(t.value); err == nil {
+		return v, nil
+	}
+	ts, err := time.Parse(time.RFC3339, t.value)
+	if err != nil {
+		return 0, errors.Errorf("%q isn't an RFC3339 timestamp or seconds since the epoch", t.value)
+	}
+	return int(ts.Unix()), nil
+}
+
+// parseRelativeDuration parses a duration such as 30s, 2h or 7d. In addition to the units supported by
+// time.ParseDuration it supports d for days and w for weeks.
+func parseRelativeDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil {
+				return 0, errors.Errorf("%q isn't a valid duration", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Errorf("%q isn't a valid duration", s)
+	}
+	return d, nil
+}
+
+// formatRelativeDuration formats seconds using the largest unit that divides it evenly e.g. 604800 is 7d.
+func formatRelativeDuration(seconds int) string {
+	units := []struct {
+		suffix  string
+		seconds int
+	}{{"d", 86400}, {"h", 3600}, {"m", 60}}
+	for _, u := range units {
+		if seconds%u.seconds == 0 {
+			return fmt.Sprintf("%d%s", seconds/u.seconds, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+// FormatTextQuery formats a query using the text syntax. It is the inverse of ParseTextQuery.
+func FormatTextQuery(q HoneycombQuery) string {
+	clauses := make([]string, 0)
+
+	calcs := make([]string, 0, len(q.Calculations))
+	for _, c := range q.Calculations {
+		calcs = append(calcs, formatTextCalculation(c.Op, c.Column))
+	}
+	if len(calcs) > 0 {
+		clauses = append(clauses, strings.Join(calcs, ", "))
+	}
+
+	if len(q.Filters) > 0 {
+		filters := make([]string, 0, len(q.Filters))
+		for _, f := range q.Filters {
+			filters = append(filters, formatTextFilter(f))
+		}
+		combination := " AND "
+		if strings.ToUpper(q.FilterCombination) == "OR" {
+			combination = " OR "
+		}
+		clauses = append(clauses, "WHERE "+strings.Join(filters, combination))
+	}
+
+	if len(q.Breakdowns) > 0 {
+		cols := make([]string, 0, len(q.Breakdowns))
+		for _, b := range q.Breakdowns {
+			cols = append(cols, formatTextColumn(b))
+		}
+		clauses = append(clauses, "GROUP BY "+strings.Join(cols, ", "))
+	}
+
+	if len(q.Havings) > 0 {
+		havings := make([]string, 0, len(q.Havings))
+		for _, h := range q.Havings {
+			havings = append(havings, fmt.Sprintf("%s %s %s", formatTextCalculation(h.CalculateOp, h.Column), h.Op, formatValue(h.Value)))
+		}
+		clauses = append(clauses, "HAVING "+strings.Join(havings, ", "))
+	}
+
+	if len(q.Orders) > 0 {
+		orders := make([]string, 0, len(q.Orders))
+		for _, o := range q.Orders {
+			s := formatTextColumn(o.Column)
+			if o.Op != "" {
+				var col interface{}
+				if o.Column != "" {
+					col = o.Column
+				}
+				s = formatTextCalculation(o.Op, col)
+			}
+			switch {
+			case strings.HasPrefix(strings.ToLower(o.Order), "desc"):
+				s += " desc"
+			case strings.HasPrefix(strings.ToLower(o.Order), "asc"):
+				s += " asc"
+			}
+			orders = append(orders, s)
+		}
+		clauses = append(clauses, "ORDER BY "+strings.Join(orders, ", "))
+	}
+
+	switch {
+	case q.StartTime != 0:
+		clauses = append(clauses, "FROM "+time.Unix(int64(q.StartTime), 0).UTC().Format(time.RFC3339))
+		if q.EndTime != 0 {
+			clauses = append(clauses, "TO "+time.Unix(int64(q.EndTime), 0).UTC().Format(time.RFC3339))
+		}
+		if q.TimeRange != 0 {
+			clauses = append(clauses, "FOR "+formatRelativeDuration(q.TimeRange))
+		}
+	default:
+		if q.TimeRange != 0 {
+			clauses = append(clauses, "LAST "+formatRelativeDuration(q.TimeRange))
+		}
+		if q.EndTime != 0 {
+			clauses = append(clauses, "TO "+time.Unix(int64(q.EndTime), 0).UTC().Format(time.RFC3339))
+		}
+	}
+
+	if q.Granularity != 0 {
+		clauses = append(clauses, "GRANULARITY "+formatRelativeDuration(q.Granularity))
+	}
+	if q.Limit != 0 {
+		clauses = append(clauses, fmt.Sprintf("LIMIT %d", q.Limit))
+	}
+	return strings.Join(clauses, " ")
+}
+
+func formatTextCalculation(op string, column interface{}) string {
+	col := columnName(column)
+	if col == "" {
+		return op
+	}
+	return fmt.Sprintf("%s(%s)", op, formatTextColumn(col))
+}
+
+func formatTextFilter(f Filter) string {
+	s := formatTextColumn(columnName(f.Column)) + " " + f.Op
+	switch {
+	case filterOpsWithoutValue[f.Op]:
+	case f.Op == "in" || f.Op == "not-in":
+		values := make([]string, 0)
+		for _, v := range f.ListValues() {
+			values = append(values, formatTextValue(v))
+		}
+		s += " (" + strings.Join(values, ", ") + ")"
+	default:
+		s += " " + formatTextValue(f.Value)
+	}
+	return s
+}
+
+// formatTextColumn quotes a column with backticks if it can't be written as a bare word.
+func formatTextColumn(col string) string {
+	if bareWord.MatchString(col) && !textKeywords[strings.ToUpper(col)] && !calculationOps[strings.ToUpper(col)] {
+		return col
+	}
+	return "`" + col + "`"
+}
+
+// formatTextValue quotes a value if it can't be written as a bare word.
+func formatTextValue(v string) string {
+	if bareWord.MatchString(v) && !textKeywords[strings.ToUpper(v)] {
+		return v
+	}
+	return strconv.Quote(v)
+}
@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_TextQuery(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected HoneycombQuery
+		// canonical is the expected output of FormatTextQuery; defaults to input
+		canonical string
+	}
+
+	cases := []testCase{
+		{
+			name:  "full",
+			input: "COUNT, P99(duration_ms) WHERE service.name = api AND error exists GROUP BY http.route HAVING COUNT > 10 ORDER BY COUNT desc, http.route LAST 7d GRANULARITY 1h LIMIT 100",
+			expected: HoneycombQuery{
+				Calculations:      []Calculation{{Op: "COUNT"}, {Op: "P99", Column: "duration_ms"}},
+				Filters:           []Filter{{Column: "service.name", Op: "=", Value: "api"}, {Column: "error", Op: "exists"}},
+				FilterCombination: "AND",
+				Breakdowns:        []string{"http.route"},
+				Havings:           []Having{{CalculateOp: "COUNT", Op: ">", Value: 10}},
+				Orders:            []Order{{Op: "COUNT", Order: "descending"}, {Column: "http.route"}},
+				TimeRange:         604800,
+				Granularity:       3600,
+				Limit:             100,
+			},
+		},
+		{
+			name:      "quoting-and-in",
+			input:     `count where name in ("GET /", POST) or "http.target" contains 'a b' group by ` + "`order`" + ` from 2024-03-21T10:00:00Z to 2024-03-21T12:00:00Z`,
+			canonical: `COUNT WHERE name in ("GET /", POST) OR http.target contains "a b" GROUP BY ` + "`order`" + ` FROM 2024-03-21T10:00:00Z TO 2024-03-21T12:00:00Z`,
+			expected: HoneycombQuery{
+				Calculations:      []Calculation{{Op: "COUNT"}},
+				Filters:           []Filter{{Column: "name", Op: "in", Values: []string{"GET /", "POST"}}, {Column: "http.target", Op: "contains", Value: "a b"}},
+				FilterCombination: "OR",
+				Breakdowns:        []string{"order"},
+				StartTime:         1711015200,
+				EndTime:           1711022400,
+			},
+		},
+		{
+			name:  "fractional-having",
+			input: "P99(duration_ms) GROUP BY name HAVING P99(duration_ms) > 1.5",
+			expected: HoneycombQuery{
+				Calculations: []Calculation{{Op: "P99", Column: "duration_ms"}},
+				Breakdowns:   []string{"name"},
+				Havings:      []Having{{CalculateOp: "P99", Column: "duration_ms", Op: ">", Value: 1.5}},
+			},
+		},
+		{
+			name:  "escapes",
+			input: `COUNT WHERE msg = "a\x01b\r\n\u200bé\\d\"" LAST 2h`,
+			expected: HoneycombQuery{
+				Calculations: []Calculation{{Op: "COUNT"}},
+				Filters:      []Filter{{Column: "msg", Op: "=", Value: "a\x01b\r\n\u200bé\\d\""}},
+				TimeRange:    7200,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := ParseTextQuery(c.input)
+			if err != nil {
+				t.Fatalf("Failed to parse query; %v", err)
+			}
+			if d := cmp.Diff(c.expected, *actual); d != "" {
+				t.Fatalf("Unexpected query;diff:\n%v", d)
+			}
+
+			canonical := c.canonical
+			if canonical == "" {
+				canonical = c.input
+			}
+			if d := cmp.Diff(canonical, FormatTextQuery(*actual)); d != "" {
+				t.Fatalf("Unexpected text;diff:\n%v", d)
+			}
+		})
+	}
+}
+
+func Test_ParseTextQueryErrors(t *testing.T) {
+	inputs := []string{
+		"COUNT WHERE a = 1 AND b = 2 OR c = 3",
+		"NOTACALC",
+		"COUNT LIMIT ten",
+		"COUNT WHERE a",
+		"COUNT HAVING COUNT => 10",
+		"COUNT HAVING COUNT contains 10",
+	}
+	for _, input := range inputs {
+		if _, err := ParseTextQuery(input); err == nil {
+			t.Errorf("Expected an error parsing %q", input)
+		}
+	}
+}
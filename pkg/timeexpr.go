@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimeSpec is a human friendly description of the time window of a query.
+// Exactly one of the following combinations can be used
+//
+//	Since                 the last Since e.g. 2h
+//	Since and To          the Since before To
+//	From and optionally To (defaults to now)
+//	Around and Window     Window before and after Around
+//
+// Times can be RFC3339 timestamps, dates (2006-01-02), seconds since the epoch, now or now-<duration>
+// e.g. now-1h. Durations are written like 30s, 2h, 7d or 1w.
+type TimeSpec struct {
+	Since  string
+	From   string
+	To     string
+	Around string
+	Window string
+}
+
+// IsEmpty returns true if none of the fields are set.
+func (s TimeSpec) IsEmpty() bool {
+	return s.Since == "" && s.From == "" && s.To == "" && s.Around == "" && s.Window == ""
+}
+
+// Apply replaces the time fields of the query with the window described by the spec.
+// If the query doesn't set a granularity, or its granularity doesn't fit the window, one is picked based on the
+// length of the window.
+// Apply does nothing if the spec is empty.
+func (s TimeSpec) Apply(q *HoneycombQuery, now time.Time) error {
+	if s.IsEmpty() {
+		return nil
+	}
+
+	var start, end time.Time
+	timeRange := 0
+	switch {
+	case s.Around != "" || s.Window != "":
+		if s.Around == "" || s.Window == "" {
+			return errors.New("--around and --window must be used together")
+		}
+		if s.Since != "" || s.From != "" || s.To != "" {
+			return errors.New("--around and --window can't be combined with --since, --from or --to")
+		}
+		around, err := ParseTimeExpression(s.Around, now)
+		if err != nil {
+			return err
+		}
+		window, err := parseRelativeDuration(s.Window)
+		if err != nil {
+			return err
+		}
+		start = around.Add(-window)
+		end = around.Add(window)
+	case s.From != "":
+		if s.Since != "" {
+			return errors.New("--since and --from can't be used together")
+		}
+		var err error
+		start, err = ParseTimeExpression(s.From, now)
+		if err != nil {
+			return err
+		}
+		end = now
+		if s.To != "" {
+			end, err = ParseTimeExpression(s.To, now)
+			if err != nil {
+				return err
+			}
+		}
+	case s.Since != "":
+		since, err := parseRelativeDuration(s.Since)
+		if err != nil {
+			return err
+		}
+		if since <= 0 {
+			return errors.New("--since must be positive")
+		}
+		timeRange = int(since.Seconds())
+		if s.To != "" {
+			end, err = ParseTimeExpression(s.To, now)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.New("--to must be combined with --from or --since")
+	}
+
+	q.StartTime = 0
+	q.EndTime = 0
+	q.TimeRange = 0
+	switch {
+	case timeRange != 0:
+		q.TimeRange = timeRange
+		if !end.IsZero() {
+			q.EndTime = int(end.Unix())
+		}
+	default:
+		if !start.Before(end) {
+			return errors.Errorf("Start time %v must be before end time %v", start.Format(time.RFC3339), end.Format(time.RFC3339))
+		}
+		q.StartTime = int(start.Unix())
+		q.EndTime = int(end.Unix())
+		timeRange = q.EndTime - q.StartTime
+	}
+
+	// Honeycomb rejects granularities outside time_range/1000 and time_range so a granularity that doesn't fit the
+	// new window is replaced.
+	if q.Granularity == 0 || q.Granularity > timeRange || q.Granularity < timeRange/1000 {
+		q.Granularity = PickGranularity(timeRange)
+	}
+	return nil
+}
+
+// ParseTimeExpression parses a point in time. It can be an RFC3339 timestamp, a date (2006-01-02),
+// seconds since the epoch, now or now-<duration> e.g. now-1h.
+func ParseTimeExpression(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "now" {
+		return now, nil
+	}
+	if strings.HasPrefix(s, "now-") {
+		d, err := parseRelativeDuration(strings.TrimPrefix(s, "now-"))
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(epoch, 0), nil
+	}
+	return time.Time{}, errors.Errorf("%q isn't a valid time; use an RFC3339 timestamp, a date, seconds since the epoch, now or now-<duration>", s)
+}
+
+// PickGranularity picks a granularity in seconds that divides a time range into roughly 100 buckets.
+// Honeycomb requires the granularity to be between time_range/1000 and time_range which this always satisfies.
+func PickGranularity(rangeSeconds int) int {
+	steps := []int{1, 5, 10, 15, 30, 60, 120, 300, 600, 900, 1800, 3600, 7200, 10800, 21600, 43200, 86400}
+	target := rangeSeconds / 100
+	for _, s := range steps {
+		if s >= target {
+			if s > rangeSeconds && rangeSeconds > 0 {
+				return rangeSeconds
+			}
+			return s
+		}
+	}
+	return steps[len(steps)-1]
+}
@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_TimeSpecApply(t *testing.T) {
+	type testCase struct {
+		name        string
+		spec        TimeSpec
+		granularity int
+		expected    HoneycombQuery
+		wantErr     bool
+	}
+
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	unix := func(s string) int {
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatalf("Failed to parse time; %v", err)
+		}
+		return int(ts.Unix())
+	}
+
+	cases := []testCase{
+		{
+			name:     "since",
+			spec:     TimeSpec{Since: "2h"},
+			expected: HoneycombQuery{TimeRange: 7200, Granularity: 120},
+		},
+		{
+			name:     "since-days",
+			spec:     TimeSpec{Since: "7d"},
+			expected: HoneycombQuery{TimeRange: 604800, Granularity: 7200},
+		},
+		{
+			name:     "since-to",
+			spec:     TimeSpec{Since: "1h", To: "now-1h"},
+			expected: HoneycombQuery{TimeRange: 3600, EndTime: unix("2026-10-01T11:00:00Z"), Granularity: 60},
+		},
+		{
+			name:     "from-to",
+			spec:     TimeSpec{From: "2026-10-01T10:00:00Z", To: "now-1h"},
+			expected: HoneycombQuery{StartTime: unix("2026-10-01T10:00:00Z"), EndTime: unix("2026-10-01T11:00:00Z"), Granularity: 60},
+		},
+		{
+			name:     "around",
+			spec:     TimeSpec{Around: "2026-10-01T10:00:00Z", Window: "30m"},
+			expected: HoneycombQuery{StartTime: unix("2026-10-01T09:30:00Z"), EndTime: unix("2026-10-01T10:30:00Z"), Granularity: 60},
+		},
+		{
+			name:        "keep-granularity",
+			spec:        TimeSpec{Since: "7d"},
+			granularity: 3600,
+			expected:    HoneycombQuery{TimeRange: 604800, Granularity: 3600},
+		},
+		{
+			name:        "granularity-longer-than-window",
+			spec:        TimeSpec{Since: "10m"},
+			granularity: 3600,
+			expected:    HoneycombQuery{TimeRange: 600, Granularity: 10},
+		},
+		{
+			name:        "granularity-too-short-for-window",
+			spec:        TimeSpec{Since: "7d"},
+			granularity: 60,
+			expected:    HoneycombQuery{TimeRange: 604800, Granularity: 7200},
+		},
+		{
+			name:    "since-and-from",
+			spec:    TimeSpec{Since: "1h", From: "now-2h"},
+			wantErr: true,
+		},
+		{
+			name:    "window-without-around",
+			spec:    TimeSpec{Window: "30m"},
+			wantErr: true,
+		},
+		{
+			name:    "to-only",
+			spec:    TimeSpec{To: "now"},
+			wantErr: true,
+		},
+		{
+			name:    "start-after-end",
+			spec:    TimeSpec{From: "now", To: "now-1h"},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			q := HoneycombQuery{TimeRange: 100, Granularity: c.granularity}
+			err := c.spec.Apply(&q, now)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to apply time spec; %v", err)
+			}
+			if d := cmp.Diff(c.expected, q); d != "" {
+				t.Fatalf("Unexpected query;diff:\n%v", d)
+			}
+		})
+	}
+}
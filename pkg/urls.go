@@ -1,31 +1,113 @@
 package pkg
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/chromedp/chromedp"
 	"github.com/go-logr/zapr"
 	"go.uber.org/zap"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
-// QueryToURL converts a query to a URL.
-// It uses Honeycomb's query parameter and template links feature
+// QueryURLBuilder builds template links to queries in the Honeycomb UI
 // https://docs.honeycomb.io/investigate/collaborate/share-query/
-func QueryToURL(query HoneycombQuery, baseURL string, dataset string) (string, error) {
+// e.g. https://ui.honeycomb.io/<team>/environments/<env>/datasets/<dataset>?query={...}
+type QueryURLBuilder struct {
+	// UIURL is the scheme and host of the UI e.g. https://ui.honeycomb.io
+	UIURL string
+	Team  string
+	// Environment is empty for classic teams which don't have environments.
+	Environment string
+	// Dataset is the dataset slug; if it is empty or AllDatasets the link is for an environment wide query.
+	Dataset string
+	// OmitMissingValues hides the groups of a breakdown that don't have a value for the column.
+	OmitMissingValues bool
+	// Params are any other parameters of the link e.g. vis=table.
+	Params url.Values
+}
+
+// NewQueryURLBuilder creates a builder from a base URL in the Honeycomb UI e.g.
+// https://ui.honeycomb.io/<team>/environments/<env>. The base URL can also include the dataset or be for a classic
+// team e.g. https://ui.honeycomb.io/<team>/datasets/<dataset>.
+func NewQueryURLBuilder(baseURL string) (*QueryURLBuilder, error) {
 	if baseURL == "" {
-		return "", errors.New("baseURL must be specified")
+		return nil, errors.New("baseURL must be specified")
 	}
-	b, err := json.Marshal(query)
+	u, err := url.Parse(strings.TrimSpace(baseURL))
 	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse baseURL %v", baseURL)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.Errorf("baseURL %v should be something like https://ui.honeycomb.io/<team>/environments/<env>", baseURL)
+	}
+	l := &QueryLink{}
+	if err := parseUIPath(u, l); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse baseURL %v", baseURL)
+	}
+	if l.Team == "" {
+		return nil, errors.Errorf("baseURL %v doesn't include the team; it should be something like https://ui.honeycomb.io/<team>/environments/<env>", baseURL)
+	}
+	return &QueryURLBuilder{
+		UIURL:       u.Scheme + "://" + u.Host,
+		Team:        l.Team,
+		Environment: l.Environment,
+		Dataset:     l.Dataset,
+	}, nil
+}
+
+// Build returns the link to the query. The query is percent encoded so values containing characters like &, # or +
+// survive.
+func (b *QueryURLBuilder) Build(query HoneycombQuery) (string, error) {
+	if b.Team == "" {
+		return "", errors.New("The team must be specified")
+	}
+	// Don't escape <, > and & as unicode escapes; they are percent encoded so this keeps the links readable.
+	var j bytes.Buffer
+	enc := json.NewEncoder(&j)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(query); err != nil {
 		return "", errors.Wrapf(err, "Failed to serialize query to JSON")
 	}
 
-	return baseURL + "/datasets/" + dataset + "?query=" + string(b), nil
+	u := strings.TrimSuffix(b.UIURL, "/") + "/" + url.PathEscape(b.Team)
+	if b.Environment != "" {
+		u += "/environments/" + url.PathEscape(b.Environment)
+	}
+	if b.Dataset != "" && b.Dataset != AllDatasets {
+		u += "/datasets/" + url.PathEscape(b.Dataset)
+	} else if b.Environment == "" {
+		return "", errors.Errorf("Team %v doesn't have environments so queries must be in a dataset", b.Team)
+	}
+
+	u += "?query=" + url.QueryEscape(strings.TrimSpace(j.String()))
+	if b.OmitMissingValues {
+		u += "&omitMissingValues"
+	}
+	if len(b.Params) > 0 {
+		u += "&" + b.Params.Encode()
+	}
+	return u, nil
+}
+
+// QueryToURL converts a query to a URL; see QueryURLBuilder.
+// If dataset is empty the dataset of the baseURL, if any, is used. If it is AllDatasets the URL is for an
+// environment wide query.
+func QueryToURL(query HoneycombQuery, baseURL string, dataset string) (string, error) {
+	b, err := NewQueryURLBuilder(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if dataset != "" {
+		b.Dataset = dataset
+	}
+	return b.Build(query)
 }
 
 // SaveHoneycombGraph saves a screenshot of a Honeycomb graph to a file
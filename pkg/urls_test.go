@@ -1,8 +1,11 @@
 package pkg
 
 import (
+	"net/url"
 	"os"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func Test_ChromeDP(t *testing.T) {
@@ -17,3 +20,159 @@ func Test_ChromeDP(t *testing.T) {
 		t.Fatalf("Failed to run; %v", err)
 	}
 }
+
+func Test_QueryToURL(t *testing.T) {
+	type testCase struct {
+		name     string
+		baseURL  string
+		dataset  string
+		expected string
+		err      bool
+	}
+
+	q := HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}, TimeRange: 3600}
+	query := "?query=" + url.QueryEscape(`{"calculations":[{"op":"COUNT"}],"filters":null,"time_range":3600}`)
+	cases := []testCase{
+		{
+			name:     "dataset",
+			baseURL:  "https://ui.honeycomb.io/team/environments/prod",
+			dataset:  "api",
+			expected: "https://ui.honeycomb.io/team/environments/prod/datasets/api" + query,
+		},
+		{
+			name:     "trailing-slash",
+			baseURL:  "https://ui.honeycomb.io/team/environments/prod/",
+			dataset:  "api",
+			expected: "https://ui.honeycomb.io/team/environments/prod/datasets/api" + query,
+		},
+		{
+			name:     "environment",
+			baseURL:  "https://ui.honeycomb.io/team/environments/prod",
+			dataset:  AllDatasets,
+			expected: "https://ui.honeycomb.io/team/environments/prod" + query,
+		},
+		{
+			name:     "base-url-dataset",
+			baseURL:  "https://ui.honeycomb.io/team/environments/prod/datasets/web",
+			expected: "https://ui.honeycomb.io/team/environments/prod/datasets/web" + query,
+		},
+		{
+			name:     "dataset-replaces-base-url-dataset",
+			baseURL:  "https://ui.honeycomb.io/team/environments/prod/datasets/web",
+			dataset:  "api",
+			expected: "https://ui.honeycomb.io/team/environments/prod/datasets/api" + query,
+		},
+		{
+			name:     "classic",
+			baseURL:  "https://ui.honeycomb.io/team",
+			dataset:  "api",
+			expected: "https://ui.honeycomb.io/team/datasets/api" + query,
+		},
+		{
+			name:    "classic-environment-wide",
+			baseURL: "https://ui.honeycomb.io/team",
+			dataset: AllDatasets,
+			err:     true,
+		},
+		{
+			name:     "escaped-components",
+			baseURL:  "https://ui.honeycomb.io/my%20team/environments/prod%231",
+			dataset:  "a/b",
+			expected: "https://ui.honeycomb.io/my%20team/environments/prod%231/datasets/a%2Fb" + query,
+		},
+		{
+			name:    "no-team",
+			baseURL: "https://ui.honeycomb.io",
+			dataset: "api",
+			err:     true,
+		},
+		{
+			name:    "relative",
+			baseURL: "team/environments/prod",
+			dataset: "api",
+			err:     true,
+		},
+		{
+			name:    "empty",
+			dataset: "api",
+			err:     true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := QueryToURL(q, c.baseURL, c.dataset)
+			if c.err {
+				if err == nil {
+					t.Fatalf("Expected an error; got %v", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to create URL; %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Unexpected URL; got %v want %v", actual, c.expected)
+			}
+		})
+	}
+}
+
+func Test_QueryURLBuilder(t *testing.T) {
+	type testCase struct {
+		name     string
+		builder  QueryURLBuilder
+		query    HoneycombQuery
+		expected string
+	}
+
+	base := QueryURLBuilder{UIURL: "https://ui.honeycomb.io", Team: "team", Environment: "prod", Dataset: "api"}
+	count := HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}}
+	countQuery := "?query=%7B%22calculations%22%3A%5B%7B%22op%22%3A%22COUNT%22%7D%5D%2C%22filters%22%3Anull%7D"
+
+	withOmit := base
+	withOmit.OmitMissingValues = true
+	withParams := withOmit
+	withParams.Params = url.Values{"vis": []string{"table"}, "tab": []string{"raw data"}}
+
+	cases := []testCase{
+		{
+			name:     "special-characters",
+			builder:  base,
+			query:    HoneycombQuery{Calculations: []Calculation{{Op: "COUNT"}}, Filters: []Filter{{Column: "name", Op: "=", Value: "a&b #1+2 50%"}}},
+			expected: "https://ui.honeycomb.io/team/environments/prod/datasets/api?query=%7B%22calculations%22%3A%5B%7B%22op%22%3A%22COUNT%22%7D%5D%2C%22filters%22%3A%5B%7B%22op%22%3A%22%3D%22%2C%22column%22%3A%22name%22%2C%22value%22%3A%22a%26b+%231%2B2+50%25%22%7D%5D%7D",
+		},
+		{
+			name:     "omit-missing-values",
+			builder:  withOmit,
+			query:    count,
+			expected: "https://ui.honeycomb.io/team/environments/prod/datasets/api" + countQuery + "&omitMissingValues",
+		},
+		{
+			name:     "params",
+			builder:  withParams,
+			query:    count,
+			expected: "https://ui.honeycomb.io/team/environments/prod/datasets/api" + countQuery + "&omitMissingValues&tab=raw+data&vis=table",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := c.builder.Build(c.query)
+			if err != nil {
+				t.Fatalf("Failed to create URL; %v", err)
+			}
+			if actual != c.expected {
+				t.Errorf("Unexpected URL; got %v want %v", actual, c.expected)
+			}
+			// The links should parse back into the same query.
+			l, err := URLToQuery(actual, nil)
+			if err != nil {
+				t.Fatalf("Failed to parse URL; %v", err)
+			}
+			if d := cmp.Diff(&c.query, l.Query); d != "" {
+				t.Errorf("Query didn't survive the round trip;diff:\n%v", d)
+			}
+		})
+	}
+}
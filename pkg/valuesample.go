@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-logr/zapr"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// valueSampleTimeRange is the time range of the queries used to sample values from Honeycomb.
+const valueSampleTimeRange = 24 * 60 * 60
+
+// ValueSampler returns the most common values of a column.
+type ValueSampler interface {
+	TopValues(dataset string, column string, n int) ([]string, error)
+}
+
+// topValuesQuery returns a query for the n most common values of the column.
+func topValuesQuery(column string, n int) HoneycombQuery {
+	return HoneycombQuery{
+		Breakdowns:   []string{column},
+		Calculations: []Calculation{{Op: "COUNT"}},
+		Filters:      []Filter{{Op: "exists", Column: column}},
+		Orders:       []Order{{Op: "COUNT", Order: "descending"}},
+		Limit:        n,
+		TimeRange:    valueSampleTimeRange,
+	}
+}
+
+// topValues extracts the values of the column from the results of a topValuesQuery.
+func topValues(column string, result *QueryResult) []string {
+	values := make([]string, 0, len(result.Results))
+	for _, r := range result.Results {
+		v, ok := r.Data[column]
+		if !ok || v == nil {
+			continue
+		}
+		values = append(values, formatValue(v))
+	}
+	return values
+}
+
+// QueryDataSampler samples values by running a COUNT by column query with Honeycomb's Query Data API.
+type QueryDataSampler struct {
+	Client *HoneycombClient
+}
+
+// TopValues returns the most common values of the column over the last day.
+func (s *QueryDataSampler) TopValues(dataset string, column string, n int) ([]string, error) {
+	result, err := s.Client.RunQuery(dataset, topValuesQuery(column, n))
+	if err != nil {
+		return nil, err
+	}
+	return topValues(column, result), nil
+}
+
+// MultiDatasetSampler samples the values of a column in each of several datasets and merges them.
+// It is used for questions about a list of datasets so datasets that weren't asked about don't contribute values as
+// they would with an environment wide query.
+type MultiDatasetSampler struct {
+	Sampler  ValueSampler
+	Datasets []string
+}
+
+// TopValues returns up to n of the most common values of the column across the datasets. The values are taken from
+// each dataset in turn so every dataset is represented. The dataset is ignored.
+func (s *MultiDatasetSampler) TopValues(dataset string, column string, n int) ([]string, error) {
+	perDataset := make([][]string, 0, len(s.Datasets))
+	var firstErr error
+	for _, d := range s.Datasets {
+		values, err := s.Sampler.TopValues(d, column, n)
+		if err != nil {
+			// The column might not exist in every dataset; only fail if none of them could be sampled.
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		perDataset = append(perDataset, values)
+	}
+	if len(perDataset) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	merged := make([]string, 0, n)
+	seen := make(map[string]bool)
+	for i := 0; len(merged) < n; i++ {
+		added := false
+		for _, values := range perDataset {
+			if i >= len(values) {
+				continue
+			}
+			added = true
+			if v := values[i]; !seen[v] && len(merged) < n {
+				seen[v] = true
+				merged = append(merged, v)
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return merged, nil
+}
+
+// LocalValueSampler samples values from a local file of events using the local query engine.
+type LocalValueSampler struct {
+	Events []Event
+}
+
+// TopValues returns the most common values of the column in the events. The dataset is ignored.
+func (s *LocalValueSampler) TopValues(dataset string, column string, n int) ([]string, error) {
+	q := topValuesQuery(column, n)
+	// Query every event regardless of when it happened.
+	opts := LocalQueryOptions{}
+	if latest := LatestEventTime(s.Events); !latest.IsZero() {
+		earliest := latest
+		for _, e := range s.Events {
+			if !e.Time.IsZero() && e.Time.Before(earliest) {
+				earliest = e.Time
+			}
+		}
+		q.TimeRange = 0
+		q.StartTime = int(earliest.Unix())
+		q.EndTime = int(latest.Add(time.Second).Unix())
+	}
+	result, err := ExecuteLocalQuery(q, s.Events, opts)
+	if err != nil {
+		return nil, err
+	}
+	return topValues(column, result), nil
+}
+
+// AddTopValues samples the most common values of the string columns and adds them to the columns.
+// Only the first maxColumns string columns are sampled; since columns are ordered by relevance these are the
+// columns most likely to be filtered on. Failures are logged and the column is left without values; if the
+// API rejects the request because the plan or key doesn't allow running queries sampling stops.
+func AddTopValues(columns []PromptColumn, sampler ValueSampler, dataset string, maxValues int, maxColumns int) {
+	log := zapr.NewLogger(zap.L())
+	sampled := 0
+	for i := range columns {
+		if sampled >= maxColumns {
+			return
+		}
+		if columns[i].Type != "string" {
+			continue
+		}
+		sampled++
+		values, err := sampler.TopValues(dataset, columns[i].KeyName, maxValues)
+		if err != nil {
+			log.Error(err, "Failed to sample values", "column", columns[i].KeyName)
+			var apiErr *HoneycombAPIError
+			if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+				log.Info("Query Data API isn't available; not sampling any more values")
+				return
+			}
+			continue
+		}
+		columns[i].TopValues = values
+	}
+}
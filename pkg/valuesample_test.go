@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+// fakeValueSampler returns canned values and records the columns it was asked about.
+type fakeValueSampler struct {
+	values  map[string][]string
+	err     error
+	sampled []string
+}
+
+func (f *fakeValueSampler) TopValues(dataset string, column string, n int) ([]string, error) {
+	f.sampled = append(f.sampled, column)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.values[column], nil
+}
+
+func Test_LocalValueSampler(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	services := []string{"checkout", "frontend", "checkout", "cart", "checkout", "frontend"}
+	events := make([]Event, 0, len(services)+1)
+	for i, s := range services {
+		events = append(events, Event{
+			// Spread the events over more than a day to check the sampler isn't limited to a time range.
+			Time: start.Add(time.Duration(i) * 12 * time.Hour),
+			Data: map[string]interface{}{"service.name": s},
+		})
+	}
+	events = append(events, Event{Time: start, Data: map[string]interface{}{"name": "no service"}})
+
+	sampler := &LocalValueSampler{Events: events}
+	values, err := sampler.TopValues("", "service.name", 2)
+	if err != nil {
+		t.Fatalf("Failed to sample values; %v", err)
+	}
+	if d := cmp.Diff([]string{"checkout", "frontend"}, values); d != "" {
+		t.Errorf("Unexpected values;diff:\n%v", d)
+	}
+}
+
+func Test_AddTopValues(t *testing.T) {
+	columns := []PromptColumn{
+		{KeyName: "service.name", Type: "string"},
+		{KeyName: "duration_ms", Type: "float"},
+		{KeyName: "http.route", Type: "string"},
+		{KeyName: "name", Type: "string"},
+	}
+	sampler := &fakeValueSampler{
+		values: map[string][]string{
+			"service.name": {"checkout", "frontend"},
+			"http.route":   {"/cart"},
+		},
+	}
+	AddTopValues(columns, sampler, "prod", 5, 2)
+
+	if d := cmp.Diff([]string{"service.name", "http.route"}, sampler.sampled); d != "" {
+		t.Errorf("Unexpected columns sampled;diff:\n%v", d)
+	}
+	if d := cmp.Diff([]string{"checkout", "frontend"}, columns[0].TopValues); d != "" {
+		t.Errorf("Unexpected values;diff:\n%v", d)
+	}
+	if columns[3].TopValues != nil {
+		t.Errorf("Expected columns past the limit not to be sampled")
+	}
+
+	forbidden := &fakeValueSampler{err: &HoneycombAPIError{StatusCode: 403}}
+	AddTopValues(columns, forbidden, "prod", 5, 10)
+	if len(forbidden.sampled) != 1 {
+		t.Errorf("Expected sampling to stop after the API rejected the request; sampled %v", forbidden.sampled)
+	}
+}
+
+// datasetValueSampler returns canned values per dataset.
+type datasetValueSampler struct {
+	values map[string][]string
+}
+
+func (s *datasetValueSampler) TopValues(dataset string, column string, n int) ([]string, error) {
+	values, ok := s.values[dataset]
+	if !ok {
+		return nil, errors.Errorf("Dataset %v doesn't exist", dataset)
+	}
+	return values, nil
+}
+
+func Test_MultiDatasetSampler(t *testing.T) {
+	sampler := &MultiDatasetSampler{
+		Sampler: &datasetValueSampler{values: map[string][]string{
+			"api":       {"checkout", "frontend", "cart"},
+			"worker":    {"email", "checkout"},
+			"unrelated": {"billing"},
+		}},
+		Datasets: []string{"api", "worker", "missing"},
+	}
+	values, err := sampler.TopValues(AllDatasets, "service.name", 4)
+	if err != nil {
+		t.Fatalf("Failed to sample values; %v", err)
+	}
+	if d := cmp.Diff([]string{"checkout", "email", "frontend", "cart"}, values); d != "" {
+		t.Errorf("Unexpected values;diff:\n%v", d)
+	}
+
+	sampler.Datasets = []string{"missing"}
+	if _, err := sampler.TopValues(AllDatasets, "service.name", 4); err == nil {
+		t.Errorf("Expected an error when no dataset could be sampled")
+	}
+}